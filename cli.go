@@ -0,0 +1,501 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/go-resty/resty/v2"
+	"github.com/transmissionsdev/cosmosis/core"
+	"github.com/transmissionsdev/cosmosis/wallet"
+	"golang.org/x/term"
+	"io"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Where the commands find a node's JSON endpoints by default.
+const defaultNodeURL = "http://localhost:9000"
+
+// Where the commands keep keys by default.
+const defaultKeystorePath = "keystore.json"
+
+// A command is a cosmosis subcommand (other than node, which runs a node).
+type command struct {
+	usage       string
+	description string
+	run         func(args []string, out io.Writer) error
+}
+
+var commands map[string]command
+
+func init() {
+	commands = map[string]command{
+		"keys":        {"keys new|list [-keystore PATH]", "Create a new key or list your keys (as ADDRESS PUBLIC_KEY)", keysCommand},
+		"balance":     {"balance [-node URL] PUBLIC_KEY|ADDRESS", "Show how many coins a public key or address can spend (and how many are immature coinbase rewards)", balanceCommand},
+		"send":        {"send [-node URL] [-keystore PATH] [-from PUBLIC_KEY] -to ADDRESS|PUBLIC_KEY -amount AMOUNT [-lockTime HEIGHT|UNIX_TIME]", "Sign a transaction with one of your keys and send it to a node", sendCommand},
+		"batch":       {"batch [-node URL] [-keystore PATH] [-from PUBLIC_KEY] FILE", "Pay everyone in a file (with a RECIPIENT AMOUNT line for each payment) in one signed transaction", batchCommand},
+		"block":       {"block [-node URL] HASH|HEIGHT", "Show a block", blockCommand},
+		"transaction": {"transaction [-node URL] SIGNATURE|HASH", "Show a transaction (and the block it is in)", transactionCommand},
+		"peers":       {"peers [-node URL]", "List a node's peers", peersCommand},
+		"mempool":     {"mempool [-node URL]", "List the transactions waiting to be mined", memPoolCommand},
+		"help":        {"help", "Show this help", helpCommand},
+	}
+}
+
+// runCommand runs a subcommand with its arguments, writing its output to out.
+func runCommand(name string, args []string, out io.Writer) error {
+	cmd, ok := commands[name]
+	if !ok {
+		helpCommand(nil, os.Stderr)
+		return fmt.Errorf("unknown command %q", name)
+	}
+
+	return cmd.run(args, out)
+}
+
+func helpCommand(args []string, out io.Writer) error {
+	fmt.Fprintln(out, "Usage:")
+	fmt.Fprintln(out, "  cosmosis node [flags]    Run a node (see cosmosis node -h)")
+
+	names := []string{"keys", "balance", "send", "batch", "block", "transaction", "peers", "mempool", "help"}
+	for _, name := range names {
+		fmt.Fprintf(out, "  cosmosis %s\n      %s\n", commands[name].usage, commands[name].description)
+	}
+
+	return nil
+}
+
+// newFlagSet creates the flags for a command. Commands return flag errors instead of exiting.
+func newFlagSet(name string) *flag.FlagSet {
+	flags := flag.NewFlagSet(name, flag.ContinueOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: cosmosis %s\n", commands[name].usage)
+		flags.PrintDefaults()
+	}
+
+	return flags
+}
+
+func keysCommand(args []string, out io.Writer) error {
+	if len(args) == 0 || (args[0] != "new" && args[0] != "list") {
+		return fmt.Errorf("usage: cosmosis %s", commands["keys"].usage)
+	}
+
+	flags := newFlagSet("keys")
+	keystorePath := flags.String("keystore", defaultKeystorePath, "The file your keys are kept in")
+	if err := flags.Parse(args[1:]); err != nil {
+		return err
+	}
+
+	keystore, err := wallet.OpenKeystore(*keystorePath)
+	if err != nil {
+		return err
+	}
+
+	if args[0] == "list" {
+		for _, publicKey := range keystore.PublicKeys() {
+			address, err := core.PublicKeyToAddress(publicKey)
+			if err != nil {
+				return err
+			}
+
+			fmt.Fprintf(out, "%s %s\n", address, publicKey)
+		}
+
+		return nil
+	}
+
+	passphrase, err := readPassphrase("Passphrase for the new key: ")
+	if err != nil {
+		return err
+	}
+
+	confirmation, err := readPassphrase("Repeat the passphrase: ")
+	if err != nil {
+		return err
+	}
+
+	if passphrase != confirmation {
+		return errors.New("the passphrases don't match")
+	}
+
+	key, err := wallet.GenerateKey()
+	if err != nil {
+		return err
+	}
+
+	if err := keystore.Add(key, passphrase); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(out, "%s %s\n", key.Address(), key.PublicKey())
+
+	return nil
+}
+
+func balanceCommand(args []string, out io.Writer) error {
+	flags := newFlagSet("balance")
+	node := nodeFlag(flags)
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	if flags.NArg() != 1 {
+		return fmt.Errorf("usage: cosmosis %s", commands["balance"].usage)
+	}
+
+	var accountBalance balance
+	if err := node.get("getBalance/"+url.PathEscape(flags.Arg(0)), &accountBalance); err != nil {
+		return err
+	}
+
+	fmt.Fprintln(out, accountBalance.Spendable)
+
+	if accountBalance.Immature > 0 {
+		fmt.Fprintf(out, "(and %d in coinbase rewards that can't be spent until they mature)\n", accountBalance.Immature)
+	}
+
+	if accountBalance.Outputs > 0 {
+		fmt.Fprintf(out, "(and %d in unspent outputs)\n", accountBalance.Outputs)
+	}
+
+	return nil
+}
+
+func sendCommand(args []string, out io.Writer) error {
+	flags := newFlagSet("send")
+	node := nodeFlag(flags)
+	keystorePath := flags.String("keystore", defaultKeystorePath, "The file your keys are kept in")
+	from := flags.String("from", "", "The public key to send from (can be left out if your keystore only has one key)")
+	to := flags.String("to", "", "The address (or public key) to send to")
+	amount := flags.Uint64("amount", 0, "How many coins to send")
+	lockTime := flags.Int64("lockTime", 0, "The block height (or Unix time, if it is at least 500000000) before which the transaction can't be mined")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	if *to == "" || *amount == 0 {
+		return fmt.Errorf("usage: cosmosis %s", commands["send"].usage)
+	}
+
+	if !core.IsValidRecipient(*to) {
+		return fmt.Errorf("%s is not a valid address or public key (check it for typos)", *to)
+	}
+
+	key, err := unlockKey(*keystorePath, from)
+	if err != nil {
+		return err
+	}
+
+	return signAndSend(node, core.Transaction{Sender: *from, Recipient: *to, Amount: *amount, Timestamp: time.Now().Unix(), LockTime: *lockTime}, key, out)
+}
+
+func batchCommand(args []string, out io.Writer) error {
+	flags := newFlagSet("batch")
+	node := nodeFlag(flags)
+	keystorePath := flags.String("keystore", defaultKeystorePath, "The file your keys are kept in")
+	from := flags.String("from", "", "The public key to send from (can be left out if your keystore only has one key)")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	if flags.NArg() != 1 {
+		return fmt.Errorf("usage: cosmosis %s", commands["batch"].usage)
+	}
+
+	payments, err := readPayments(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	var total uint64
+	for _, payment := range payments {
+		if total+payment.Amount < total {
+			return fmt.Errorf("the payments in %s add up to more coins than can be sent", flags.Arg(0))
+		}
+
+		total += payment.Amount
+	}
+
+	key, err := unlockKey(*keystorePath, from)
+	if err != nil {
+		return err
+	}
+
+	return signAndSend(node, core.Transaction{Sender: *from, Amount: total, Timestamp: time.Now().Unix(), Payments: payments}, key, out)
+}
+
+// readPayments reads the payments for a batch transaction from a file with a RECIPIENT AMOUNT line for each payment.
+// Empty lines and lines starting with # are skipped.
+func readPayments(path string) ([]core.Payment, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var payments []core.Payment
+
+	scanner := bufio.NewScanner(file)
+	for line := 1; scanner.Scan(); line++ {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("line %d of %s should be RECIPIENT AMOUNT", line, path)
+		}
+
+		amount, err := strconv.ParseUint(fields[1], 10, 64)
+		if err != nil || amount == 0 {
+			return nil, fmt.Errorf("line %d of %s doesn't have a valid amount (%s)", line, path, fields[1])
+		}
+
+		if !core.IsValidRecipient(fields[0]) {
+			return nil, fmt.Errorf("line %d of %s doesn't have a valid address or public key (check it for typos)", line, path)
+		}
+
+		payments = append(payments, core.Payment{Recipient: fields[0], Amount: amount})
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(payments) == 0 || len(payments) > core.MaxBatchPayments {
+		return nil, fmt.Errorf("a batch must have between 1 and %d payments (%s has %d)", core.MaxBatchPayments, path, len(payments))
+	}
+
+	return payments, nil
+}
+
+// unlockKey gets a key from a keystore, asking for its passphrase. If from is empty, it is set to the keystore's only key.
+func unlockKey(keystorePath string, from *string) (*wallet.Key, error) {
+	keystore, err := wallet.OpenKeystore(keystorePath)
+	if err != nil {
+		return nil, err
+	}
+
+	if *from == "" {
+		publicKeys := keystore.PublicKeys()
+		if len(publicKeys) != 1 {
+			return nil, fmt.Errorf("your keystore has %d keys, so choose one to send from with -from", len(publicKeys))
+		}
+
+		*from = publicKeys[0]
+	}
+
+	passphrase, err := readPassphrase("Passphrase: ")
+	if err != nil {
+		return nil, err
+	}
+
+	return keystore.Key(*from, passphrase)
+}
+
+// signAndSend signs a transaction with a key and sends it to a node, printing the signed transaction.
+func signAndSend(node nodeClient, transaction core.Transaction, key *wallet.Key, out io.Writer) error {
+	transaction, err := wallet.SignTransaction(transaction, key)
+	if err != nil {
+		return err
+	}
+
+	if err := node.post("newTransaction", transaction); err != nil {
+		return err
+	}
+
+	return printJSON(out, transaction)
+}
+
+func blockCommand(args []string, out io.Writer) error {
+	flags := newFlagSet("block")
+	node := nodeFlag(flags)
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	if flags.NArg() != 1 {
+		return fmt.Errorf("usage: cosmosis %s", commands["block"].usage)
+	}
+
+	var chain []core.Block
+	if err := node.get("getChain", &chain); err != nil {
+		return err
+	}
+
+	if height, err := strconv.Atoi(flags.Arg(0)); err == nil {
+		if height < 0 || height >= len(chain) {
+			return fmt.Errorf("there is no block at height %d (the chain has %d blocks)", height, len(chain))
+		}
+
+		return printJSON(out, chain[height])
+	}
+
+	for _, block := range chain {
+		if core.SHA256(block) == flags.Arg(0) {
+			return printJSON(out, block)
+		}
+	}
+
+	return fmt.Errorf("there is no block with the hash %s", flags.Arg(0))
+}
+
+func transactionCommand(args []string, out io.Writer) error {
+	flags := newFlagSet("transaction")
+	node := nodeFlag(flags)
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	if flags.NArg() != 1 {
+		return fmt.Errorf("usage: cosmosis %s", commands["transaction"].usage)
+	}
+
+	matches := func(transaction core.Transaction) bool {
+		return transaction.Signature == flags.Arg(0) || core.SHA256(transaction) == flags.Arg(0)
+	}
+
+	// A transaction and where it is
+	type foundTransaction struct {
+		core.Transaction
+		BlockHeight int  // The height of the block the transaction is in (-1 if it is in the MemPool)
+		Confirmed   bool // Whether the transaction is in a block
+	}
+
+	var chain []core.Block
+	if err := node.get("getChain", &chain); err != nil {
+		return err
+	}
+
+	for height, block := range chain {
+		for _, transaction := range block.Transactions {
+			if matches(transaction) {
+				return printJSON(out, foundTransaction{transaction, height, true})
+			}
+		}
+	}
+
+	var memPool []core.Transaction
+	if err := node.get("getMemPool", &memPool); err != nil {
+		return err
+	}
+
+	for _, transaction := range memPool {
+		if matches(transaction) {
+			return printJSON(out, foundTransaction{transaction, -1, false})
+		}
+	}
+
+	return fmt.Errorf("there is no transaction with the signature or hash %s", flags.Arg(0))
+}
+
+func peersCommand(args []string, out io.Writer) error {
+	flags := newFlagSet("peers")
+	node := nodeFlag(flags)
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	var peers map[string]core.Hello
+	if err := node.get("getPeers", &peers); err != nil {
+		return err
+	}
+
+	return printJSON(out, peers)
+}
+
+func memPoolCommand(args []string, out io.Writer) error {
+	flags := newFlagSet("mempool")
+	node := nodeFlag(flags)
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	var memPool []core.Transaction
+	if err := node.get("getMemPool", &memPool); err != nil {
+		return err
+	}
+
+	return printJSON(out, memPool)
+}
+
+// A nodeClient talks to a node over its JSON endpoints.
+type nodeClient struct {
+	url *string
+}
+
+// nodeFlag adds the -node flag to a command.
+func nodeFlag(flags *flag.FlagSet) nodeClient {
+	return nodeClient{url: flags.String("node", defaultNodeURL, "The URL of a node hosting its JSON endpoints (see cosmosis node -hostJSONEndpoints)")}
+}
+
+// get gets an endpoint and decodes its JSON into result.
+func (n nodeClient) get(endpoint string, result interface{}) error {
+	resp, err := resty.New().R().SetResult(result).Get(n.endpoint(endpoint))
+	if err != nil {
+		return err
+	}
+
+	if resp.IsError() {
+		return fmt.Errorf("the node returned %s: %s", resp.Status(), resp.String())
+	}
+
+	return nil
+}
+
+// post posts body as JSON to an endpoint.
+func (n nodeClient) post(endpoint string, body interface{}) error {
+	resp, err := resty.New().R().SetHeader("Content-Type", "application/json").SetBody(body).Post(n.endpoint(endpoint))
+	if err != nil {
+		return err
+	}
+
+	if resp.IsError() {
+		return fmt.Errorf("the node returned %s: %s", resp.Status(), resp.String())
+	}
+
+	return nil
+}
+
+func (n nodeClient) endpoint(endpoint string) string {
+	return strings.TrimSuffix(*n.url, "/") + "/cosmosis/" + endpoint
+}
+
+func printJSON(out io.Writer, v interface{}) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintln(out, string(data))
+
+	return err
+}
+
+// readPassphrase asks for a passphrase, without echoing it if we are in a terminal.
+// Otherwise (like when piping it in) it reads a line from stdin.
+var readPassphrase = func(prompt string) (string, error) {
+	fmt.Fprint(os.Stderr, prompt)
+	defer fmt.Fprintln(os.Stderr)
+
+	if term.IsTerminal(int(os.Stdin.Fd())) {
+		passphrase, err := term.ReadPassword(int(os.Stdin.Fd()))
+		return string(passphrase), err
+	}
+
+	line, err := stdin.ReadString('\n')
+	if err != nil && (err != io.EOF || line == "") {
+		return "", err
+	}
+
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+// Buffered once so piped passphrases can be read one line at a time.
+var stdin = bufio.NewReader(os.Stdin)
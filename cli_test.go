@@ -0,0 +1,282 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/transmissionsdev/cosmosis/core"
+	"github.com/transmissionsdev/cosmosis/wallet"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// startTestNode hosts the JSON endpoints (and getwork API) of a node with just the genesis block (which accepts every signature).
+func startTestNode(t *testing.T) (*httptest.Server, *api) {
+	gin.SetMode(gin.TestMode)
+
+	validationServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"valid_signature": true}`))
+	}))
+
+	self := &core.LocalNode{Chain: []core.Block{core.GenesisBlock}, MemPool: make([]core.Transaction, 0), UTXO: core.UTXO{core.GenesisBlock.Transactions[0].Recipient: {Spendable: core.GenesisBlock.Transactions[0].Amount}}, ValidationServerURL: validationServer.URL}
+
+	a := newAPI(self)
+
+	node := httptest.NewServer(newRouter(a))
+
+	t.Cleanup(func() {
+		node.Close()
+		validationServer.Close()
+	})
+
+	return node, a
+}
+
+// useKeystore creates a keystore in a temporary directory, and answers every passphrase prompt with passphrase.
+func useKeystore(t *testing.T, passphrase string) string {
+	dir, err := ioutil.TempDir("", "cosmosis")
+	assert.NoError(t, err)
+
+	originalReadPassphrase := readPassphrase
+	readPassphrase = func(prompt string) (string, error) { return passphrase, nil }
+
+	t.Cleanup(func() {
+		readPassphrase = originalReadPassphrase
+		os.RemoveAll(dir)
+	})
+
+	return filepath.Join(dir, "keystore.json")
+}
+
+func run(t *testing.T, args ...string) (string, error) {
+	var out bytes.Buffer
+	err := runCommand(args[0], args[1:], &out)
+
+	return strings.TrimSpace(out.String()), err
+}
+
+func TestKeysCommand(t *testing.T) {
+	keystorePath := useKeystore(t, "passphrase")
+
+	created, err := run(t, "keys", "new", "-keystore", keystorePath)
+	assert.NoError(t, err)
+
+	fields := strings.Fields(created)
+	assert.Len(t, fields, 2)
+	assert.True(t, core.IsAddress(fields[0]))
+	assert.True(t, strings.HasPrefix(fields[1], "04"))
+
+	address, err := core.PublicKeyToAddress(fields[1])
+	assert.NoError(t, err)
+	assert.Equal(t, address, fields[0])
+
+	list, err := run(t, "keys", "list", "-keystore", keystorePath)
+	assert.NoError(t, err)
+	assert.Equal(t, created, list)
+
+	_, err = run(t, "keys", "delete", "-keystore", keystorePath)
+	assert.Error(t, err)
+}
+
+func TestSendCommand(t *testing.T) {
+	node, a := startTestNode(t)
+	keystorePath := useKeystore(t, "passphrase")
+
+	created, err := run(t, "keys", "new", "-keystore", keystorePath)
+	assert.NoError(t, err)
+
+	from := strings.Fields(created)[1]
+
+	output, err := run(t, "send", "-node", node.URL, "-keystore", keystorePath, "-to", core.GenesisBlock.Transactions[0].Recipient, "-amount", "15")
+	assert.NoError(t, err)
+
+	var sent core.Transaction
+	assert.NoError(t, json.Unmarshal([]byte(output), &sent))
+	assert.Equal(t, from, sent.Sender)
+	assert.Equal(t, uint64(15), sent.Amount)
+	assert.True(t, wallet.VerifySignature(sent))
+
+	// The node got it
+	assert.Equal(t, []core.Transaction{sent}, a.node.MemPool)
+
+	// It can be looked up by its signature or hash
+	found, err := run(t, "transaction", "-node", node.URL, sent.Signature)
+	assert.NoError(t, err)
+	assert.Contains(t, found, `"BlockHeight": -1`)
+
+	found, err = run(t, "transaction", "-node", node.URL, core.SHA256(sent))
+	assert.NoError(t, err)
+	assert.Contains(t, found, sent.Signature)
+
+	memPool, err := run(t, "mempool", "-node", node.URL)
+	assert.NoError(t, err)
+	assert.Contains(t, memPool, sent.Signature)
+
+	// Locked transactions wait in the MemPool
+	locked, err := run(t, "send", "-node", node.URL, "-keystore", keystorePath, "-to", core.GenesisBlock.Transactions[0].Recipient, "-amount", "15", "-lockTime", "100")
+	assert.NoError(t, err)
+
+	var sentLocked core.Transaction
+	assert.NoError(t, json.Unmarshal([]byte(locked), &sentLocked))
+	assert.Equal(t, int64(100), sentLocked.LockTime)
+	assert.True(t, wallet.VerifySignature(sentLocked))
+	assert.Len(t, a.node.MemPool, 2)
+
+	// A wrong passphrase can't sign
+	readPassphrase = func(prompt string) (string, error) { return "wrong", nil }
+	_, err = run(t, "send", "-node", node.URL, "-keystore", keystorePath, "-to", core.GenesisBlock.Transactions[0].Recipient, "-amount", "15")
+	assert.Equal(t, wallet.ErrWrongPassphrase, err)
+
+	// Mistyped addresses are caught before anything is signed
+	_, err = run(t, "send", "-node", node.URL, "-keystore", keystorePath, "-to", "CettMfBeEQXFWV4QV2vbyYKVfhGP2qGXSN", "-amount", "15")
+	assert.Error(t, err)
+
+	// Nothing to send
+	_, err = run(t, "send", "-node", node.URL, "-keystore", keystorePath, "-to", core.GenesisBlock.Transactions[0].Recipient)
+	assert.Error(t, err)
+}
+
+func TestSendCommand_Rejected(t *testing.T) {
+	node, a := startTestNode(t)
+	keystorePath := useKeystore(t, "passphrase")
+
+	_, err := run(t, "keys", "new", "-keystore", keystorePath)
+	assert.NoError(t, err)
+
+	// The node's validation server rejects every signature
+	rejectingServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"valid_signature": false}`))
+	}))
+	defer rejectingServer.Close()
+
+	a.node.ValidationServerURL = rejectingServer.URL
+
+	output, err := run(t, "send", "-node", node.URL, "-keystore", keystorePath, "-to", core.GenesisBlock.Transactions[0].Recipient, "-amount", "15")
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "400")
+	assert.Empty(t, output)
+	assert.Empty(t, a.node.MemPool)
+
+	genesisAddress, err := core.PublicKeyToAddress(core.GenesisBlock.Transactions[0].Recipient)
+	assert.NoError(t, err)
+
+	payments := filepath.Join(filepath.Dir(keystorePath), "payments.txt")
+	assert.NoError(t, ioutil.WriteFile(payments, []byte(genesisAddress+" 10\n"), 0600))
+
+	output, err = run(t, "batch", "-node", node.URL, "-keystore", keystorePath, payments)
+	assert.Error(t, err)
+	assert.Empty(t, output)
+	assert.Empty(t, a.node.MemPool)
+}
+
+func TestBatchCommand(t *testing.T) {
+	node, a := startTestNode(t)
+	keystorePath := useKeystore(t, "passphrase")
+
+	created, err := run(t, "keys", "new", "-keystore", keystorePath)
+	assert.NoError(t, err)
+
+	genesisRecipient := core.GenesisBlock.Transactions[0].Recipient
+	genesisAddress, err := core.PublicKeyToAddress(genesisRecipient)
+	assert.NoError(t, err)
+
+	payments := filepath.Join(filepath.Dir(keystorePath), "payments.txt")
+	assert.NoError(t, ioutil.WriteFile(payments, []byte("# Payroll\n"+genesisAddress+" 10\n\n"+genesisRecipient+" 5\n"), 0600))
+
+	output, err := run(t, "batch", "-node", node.URL, "-keystore", keystorePath, payments)
+	assert.NoError(t, err)
+
+	var sent core.Transaction
+	assert.NoError(t, json.Unmarshal([]byte(output), &sent))
+	assert.Equal(t, strings.Fields(created)[1], sent.Sender)
+	assert.Equal(t, uint64(15), sent.Amount)
+	assert.Equal(t, []core.Payment{{Recipient: genesisAddress, Amount: 10}, {Recipient: genesisRecipient, Amount: 5}}, sent.Payments)
+	assert.True(t, wallet.VerifySignature(sent))
+	assert.Equal(t, []core.Transaction{sent}, a.node.MemPool)
+
+	// Mistyped payments are caught before anything is signed
+	for _, contents := range []string{"", genesisAddress + "\n", genesisAddress + " ten\n", genesisAddress + " 0\n", "CettMfBeEQXFWV4QV2vbyYKVfhGP2qGXSN 10\n", genesisAddress + " 18446744073709551615\n" + genesisAddress + " 1\n"} {
+		assert.NoError(t, ioutil.WriteFile(payments, []byte(contents), 0600))
+
+		_, err = run(t, "batch", "-node", node.URL, "-keystore", keystorePath, payments)
+		assert.Error(t, err)
+	}
+
+	_, err = run(t, "batch", "-node", node.URL, "-keystore", keystorePath)
+	assert.Error(t, err)
+}
+
+func TestNodeQueryCommands(t *testing.T) {
+	node, a := startTestNode(t)
+	genesisRecipient := core.GenesisBlock.Transactions[0].Recipient
+
+	balance, err := run(t, "balance", "-node", node.URL, genesisRecipient)
+	assert.NoError(t, err)
+	assert.Equal(t, "100000000000000", balance)
+
+	// An address only has the coins sent to it (the genesis coins were sent to the public key itself)
+	genesisAddress, err := core.PublicKeyToAddress(genesisRecipient)
+	assert.NoError(t, err)
+
+	balance, err = run(t, "balance", "-node", node.URL, genesisAddress)
+	assert.NoError(t, err)
+	assert.Equal(t, "0", balance)
+
+	balance, err = run(t, "balance", "-node", node.URL, "nobody")
+	assert.NoError(t, err)
+	assert.Equal(t, "0", balance)
+
+	// Coinbase rewards that haven't matured and unspent outputs are shown separately
+	a.node.UTXO["miner"] = core.Funds{Spendable: 5, Immature: []core.ImmatureCoins{{Amount: 1000, MaturesAt: 100}}, Outputs: map[string]uint64{"hash:0": 7}}
+
+	balance, err = run(t, "balance", "-node", node.URL, "miner")
+	assert.NoError(t, err)
+	assert.Equal(t, "5\n(and 1000 in coinbase rewards that can't be spent until they mature)\n(and 7 in unspent outputs)", balance)
+
+	// Blocks by height or hash
+	byHeight, err := run(t, "block", "-node", node.URL, "0")
+	assert.NoError(t, err)
+
+	var block core.Block
+	assert.NoError(t, json.Unmarshal([]byte(byHeight), &block))
+	assert.Equal(t, core.GenesisBlock, block)
+
+	byHash, err := run(t, "block", "-node", node.URL, core.SHA256(core.GenesisBlock))
+	assert.NoError(t, err)
+	assert.Equal(t, byHeight, byHash)
+
+	_, err = run(t, "block", "-node", node.URL, "1")
+	assert.Error(t, err)
+
+	_, err = run(t, "block", "-node", node.URL, "not a hash")
+	assert.Error(t, err)
+
+	// Confirmed transactions
+	found, err := run(t, "transaction", "-node", node.URL, core.SHA256(core.GenesisBlock.Transactions[0]))
+	assert.NoError(t, err)
+	assert.Contains(t, found, `"Confirmed": true`)
+
+	_, err = run(t, "transaction", "-node", node.URL, "nothing")
+	assert.Error(t, err)
+
+	peers, err := run(t, "peers", "-node", node.URL)
+	assert.NoError(t, err)
+	assert.Equal(t, "{}", peers)
+
+	// Unreachable nodes
+	_, err = run(t, "mempool", "-node", "http://127.0.0.1:1")
+	assert.Error(t, err)
+}
+
+func TestRunCommand_Unknown(t *testing.T) {
+	_, err := run(t, "unknown")
+	assert.Error(t, err)
+}
@@ -0,0 +1,167 @@
+package core
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"github.com/decred/dcrd/dcrec/secp256k1/v4"
+	"golang.org/x/crypto/ripemd160"
+)
+
+// The version byte at the start of every address, so other kinds of base58 strings can't be mistaken for addresses.
+const AddressVersion byte = 0x1c
+
+// How many bytes of the double SHA256 hash of an address are used as its checksum.
+const addressChecksumLength = 4
+
+// How long a decoded address is: its version, the hash of its public key and its checksum.
+const addressLength = 1 + ripemd160.Size + addressChecksumLength
+
+// Converts a public key into its address. An address is a shorter, checksummed form of a public key that coins can be sent to:
+// base58(version + RIPEMD160(SHA256(public key)) + checksum), where the checksum is the first 4 bytes of SHA256(SHA256(version + hash)).
+// A typo in an address (almost certainly) breaks its checksum, so it is rejected instead of sending coins to a key nobody owns.
+func PublicKeyToAddress(publicKey string) (string, error) {
+	key, err := parsePublicKey(publicKey)
+	if err != nil {
+		return "", err
+	}
+
+	return encodeAddress(AddressVersion, key), nil
+}
+
+// Checks whether a string is an address with a valid version and checksum.
+func IsAddress(address string) bool {
+	return isAddressWithVersion(address, AddressVersion)
+}
+
+// Encodes the hash of some data as an address with a version.
+func encodeAddress(version byte, data []byte) string {
+	dataHash := sha256.Sum256(data)
+
+	hasher := ripemd160.New()
+	hasher.Write(dataHash[:])
+
+	payload := append([]byte{version}, hasher.Sum(nil)...)
+
+	return base58Encode(append(payload, addressChecksum(payload)...))
+}
+
+// Checks whether a string is an address with a version and a valid checksum.
+func isAddressWithVersion(address string, version byte) bool {
+	// Decoding takes time quadratic in the length of a string, so anything longer than an address can be isn't decoded at all
+	if len(address) > maxBase58Length(addressLength) {
+		return false
+	}
+
+	decoded, err := base58Decode(address)
+	if err != nil || len(decoded) != addressLength || decoded[0] != version {
+		return false
+	}
+
+	payload, checksum := decoded[:addressLength-addressChecksumLength], decoded[addressLength-addressChecksumLength:]
+
+	return bytes.Equal(checksum, addressChecksum(payload))
+}
+
+// Checks whether a string is a public key (compressed or uncompressed).
+func IsPublicKey(publicKey string) bool {
+	_, err := parsePublicKey(publicKey)
+	return err == nil
+}
+
+// Converts a public key into the one form we use for it: uncompressed lowercase hex (like the keys in GenesisBlock).
+// The same key can be written compressed or uncompressed, so it is always canonicalized before being used as an account.
+func CanonicalPublicKey(publicKey string) (string, error) {
+	key, err := parsePublicKey(publicKey)
+	if err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(key), nil
+}
+
+// Checks whether coins can be sent to a recipient: it must be an address, a multisig address or a public key.
+func IsValidRecipient(recipient string) bool {
+	return IsAddress(recipient) || IsMultisigAddress(recipient) || IsPublicKey(recipient)
+}
+
+// Checks whether coins can be sent to a transaction's recipient, or every recipient of an output-based transaction's outputs
+// or a batch transaction's payments.
+func (t Transaction) HasValidRecipients() bool {
+	var recipients []string
+
+	switch {
+	case t.isOutputBased() && t.isBatch():
+		return false
+	case t.isOutputBased():
+		for _, output := range t.Outputs {
+			recipients = append(recipients, output.Recipient)
+		}
+	case t.isBatch():
+		for _, payment := range t.Payments {
+			recipients = append(recipients, payment.Recipient)
+		}
+	default:
+		return IsValidRecipient(t.Recipient)
+	}
+
+	for _, recipient := range recipients {
+		if !IsValidRecipient(recipient) {
+			return false
+		}
+	}
+
+	return t.Recipient == "" && len(recipients) > 0
+}
+
+// Decodes a hex public key into its uncompressed bytes. Public keys are either uncompressed (65 bytes starting with 0x04)
+// or compressed (33 bytes starting with 0x02 or 0x03), and must be a point on the secp256k1 curve.
+func parsePublicKey(publicKey string) ([]byte, error) {
+	key, err := hex.DecodeString(publicKey)
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case len(key) == secp256k1.PubKeyBytesLenUncompressed && key[0] == secp256k1.PubKeyFormatUncompressed:
+	case len(key) == secp256k1.PubKeyBytesLenCompressed && (key[0] == secp256k1.PubKeyFormatCompressedEven || key[0] == secp256k1.PubKeyFormatCompressedOdd):
+	default:
+		// Hybrid keys (0x06 and 0x07) are also rejected
+		return nil, errors.New("public keys must be 65 bytes starting with 04 or 33 bytes starting with 02 or 03")
+	}
+
+	parsed, err := secp256k1.ParsePubKey(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return parsed.SerializeUncompressed(), nil
+}
+
+func addressChecksum(payload []byte) []byte {
+	first := sha256.Sum256(payload)
+	second := sha256.Sum256(first[:])
+
+	return second[:addressChecksumLength]
+}
+
+// Gets the address coins sent to an account (a public key or an address) are kept under.
+// Anything else (like the coinbase sender) is its own account.
+func accountAddress(account string) string {
+	if address, err := PublicKeyToAddress(account); err == nil {
+		return address
+	}
+
+	return account
+}
+
+// Gets the key coins sent directly to an account are kept under in a UTXO: public keys are canonicalized
+// (so a key has one entry however it is written), and anything else is its own key.
+func accountKey(account string) string {
+	if publicKey, err := CanonicalPublicKey(account); err == nil {
+		return publicKey
+	}
+
+	return account
+}
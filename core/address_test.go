@@ -0,0 +1,162 @@
+package core
+
+import (
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+var testGenesisAddress = "CettMfBeEQXFWV4QV2vbyYKVfhGP2qGXSM"
+
+func TestPublicKeyToAddress(t *testing.T) {
+	address, err := PublicKeyToAddress(testGenesisBlock.Transactions[0].Recipient)
+	assert.NoError(t, err)
+	assert.Equal(t, testGenesisAddress, address)
+	assert.True(t, IsAddress(address))
+
+	// Different keys have different addresses
+	other, err := PublicKeyToAddress(harnessRecipient)
+	assert.NoError(t, err)
+	assert.NotEqual(t, address, other)
+
+	// Not public keys
+	_, err = PublicKeyToAddress("miner")
+	assert.Error(t, err)
+
+	_, err = PublicKeyToAddress(testGenesisBlock.Transactions[0].Recipient[:128])
+	assert.Error(t, err)
+
+	_, err = PublicKeyToAddress("05" + testGenesisBlock.Transactions[0].Recipient[2:])
+	assert.Error(t, err)
+}
+
+func TestIsAddress(t *testing.T) {
+	assert.True(t, IsAddress(testGenesisAddress))
+
+	// A typo breaks the checksum
+	assert.False(t, IsAddress("CettMfBeEQXFWV4QV2vbyYKVfhGP2qGXSN"))
+	assert.False(t, IsAddress("CettMfBeEQXFWV4QV2vbyYKVfhGP2qGXS"))
+	assert.False(t, IsAddress("CettMfBeEQXFWV4QV2vbyYKVfhGP2qGXSM0"))
+
+	// Other versions aren't addresses
+	payload := append([]byte{AddressVersion + 1}, make([]byte, 20)...)
+	assert.False(t, IsAddress(base58Encode(append(payload, addressChecksum(payload)...))))
+
+	assert.False(t, IsAddress(""))
+	assert.False(t, IsAddress(testGenesisBlock.Transactions[0].Recipient))
+
+	// Strings far too long to be addresses are rejected without decoding them
+	assert.False(t, IsAddress(strings.Repeat("z", MaxMessageSize)))
+}
+
+func TestIsValidRecipient(t *testing.T) {
+	assert.True(t, IsValidRecipient(testGenesisAddress))
+	assert.True(t, IsValidRecipient(testGenesisBlock.Transactions[0].Recipient))
+	assert.False(t, IsValidRecipient("CettMfBeEQXFWV4QV2vbyYKVfhGP2qGXSN"))
+	assert.False(t, IsValidRecipient("OTHERNOTREALPERSON"))
+	assert.False(t, IsValidRecipient(""))
+}
+
+func TestValidateTransaction_Recipient(t *testing.T) {
+	fakeValidationServer := newFakeValidationServer(true)
+	defer fakeValidationServer.Close()
+
+	sender := testGenesisBlock.Transactions[0].Recipient
+	utxo := UTXO{sender: {Spendable: 100}}
+
+	assert.True(t, ValidateTransaction(Transaction{Sender: sender, Recipient: harnessRecipient, Amount: 10}, utxo, fakeValidationServer.URL))
+	assert.True(t, ValidateTransaction(Transaction{Sender: sender, Recipient: testGenesisAddress, Amount: 10}, utxo, fakeValidationServer.URL))
+	assert.False(t, ValidateTransaction(Transaction{Sender: sender, Recipient: "CettMfBeEQXFWV4QV2vbyYKVfhGP2qGXSN", Amount: 10}, utxo, fakeValidationServer.URL))
+	assert.False(t, ValidateTransaction(Transaction{Sender: sender, Recipient: harnessRecipient[:129], Amount: 10}, utxo, fakeValidationServer.URL))
+
+	// Coins sent to a public key's address can be spent by the public key
+	assert.True(t, ValidateTransaction(Transaction{Sender: sender, Recipient: harnessRecipient, Amount: 10}, UTXO{testGenesisAddress: {Spendable: 10}}, fakeValidationServer.URL))
+	assert.False(t, ValidateTransaction(Transaction{Sender: sender, Recipient: harnessRecipient, Amount: 11}, UTXO{testGenesisAddress: {Spendable: 10}}, fakeValidationServer.URL))
+}
+
+func TestValidateBlock_CoinbaseRecipient(t *testing.T) {
+	fakeValidationServer := newFakeValidationServer(true)
+	defer fakeValidationServer.Close()
+
+	defer func(height int) { coinbaseRecipientHeight = height }(coinbaseRecipientHeight)
+
+	// harnessBlock1 pays its reward to "miner1", which was fine before the rule existed
+	valid, _ := ValidateChain([]Block{testGenesisBlock, harnessBlock1}, fakeValidationServer.URL)
+	assert.True(t, valid)
+
+	// But not after
+	coinbaseRecipientHeight = 0
+	valid, _ = ValidateChain([]Block{testGenesisBlock, harnessBlock1}, fakeValidationServer.URL)
+	assert.False(t, valid)
+
+	valid, _ = ValidateChain([]Block{testGenesisBlock, maturityBlock1}, fakeValidationServer.URL)
+	assert.True(t, valid)
+}
+
+// The compressed form of testGenesisBlock's key.
+var testGenesisCompressedKey = "0258adabe2c014de6c3fd2f2c865c2ca7fe823a4131a4d22f98dcc77f1bffc8aea"
+
+func TestCanonicalPublicKey(t *testing.T) {
+	uncompressed := testGenesisBlock.Transactions[0].Recipient
+
+	canonical, err := CanonicalPublicKey(uncompressed)
+	assert.NoError(t, err)
+	assert.Equal(t, uncompressed, canonical)
+
+	// Compressed and uppercase keys are the same key
+	canonical, err = CanonicalPublicKey(testGenesisCompressedKey)
+	assert.NoError(t, err)
+	assert.Equal(t, uncompressed, canonical)
+
+	canonical, err = CanonicalPublicKey(strings.ToUpper(uncompressed))
+	assert.NoError(t, err)
+	assert.Equal(t, uncompressed, canonical)
+
+	// They have the same address
+	address, err := PublicKeyToAddress(testGenesisCompressedKey)
+	assert.NoError(t, err)
+	assert.Equal(t, testGenesisAddress, address)
+
+	// Malformed keys
+	for _, malformed := range []string{
+		"",
+		"not hex",
+		uncompressed[:len(uncompressed)-2],       // Too short
+		uncompressed[:len(uncompressed)-1] + "1", // Not on the curve
+		"0358adabe2c014de6c3fd2f2c865c2ca7fe823a4131a4d22f98dcc77f1bffc8aea" + "00", // Compressed with extra bytes
+		"06" + uncompressed[2:],             // Hybrid
+		"05" + testGenesisCompressedKey[2:], // Unknown prefix
+	} {
+		_, err := CanonicalPublicKey(malformed)
+		assert.Error(t, err, malformed)
+		assert.False(t, IsValidRecipient(malformed), malformed)
+	}
+}
+
+func TestValidateTransaction_CompressedSender(t *testing.T) {
+	// Record the public key the validation server is asked to check signatures with
+	var checkedPublicKey string
+	validationServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var request map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&request)
+		checkedPublicKey, _ = request["publicKey"].(string)
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"valid_signature": true}`))
+	}))
+	defer validationServer.Close()
+
+	utxo := UTXO{testGenesisBlock.Transactions[0].Recipient: {Spendable: 100}}
+
+	// A compressed key spends the coins of its uncompressed form, and its signature is checked with the canonical key
+	assert.True(t, ValidateTransaction(Transaction{Sender: testGenesisCompressedKey, Recipient: harnessRecipient, Amount: 100}, utxo, validationServer.URL))
+	assert.Equal(t, testGenesisBlock.Transactions[0].Recipient, checkedPublicKey)
+
+	// Malformed senders are rejected without asking the validation server
+	checkedPublicKey = ""
+	assert.False(t, ValidateTransaction(Transaction{Sender: "06" + testGenesisBlock.Transactions[0].Recipient[2:], Recipient: harnessRecipient, Amount: 1}, utxo, validationServer.URL))
+	assert.Empty(t, checkedPublicKey)
+}
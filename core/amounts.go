@@ -0,0 +1,78 @@
+package core
+
+import "math/bits"
+
+// Adds two amounts of coins. It returns false if the total is too big for a uint64 (instead of wrapping around).
+func addAmounts(a uint64, b uint64) (uint64, bool) {
+	sum, carry := bits.Add64(a, b, 0)
+	return sum, carry == 0
+}
+
+// Subtracts an amount of coins from another. It returns false if b is bigger than a (instead of wrapping around).
+func subtractAmounts(a uint64, b uint64) (uint64, bool) {
+	difference, borrow := bits.Sub64(a, b, 0)
+	return difference, borrow == 0
+}
+
+// Totals amounts of coins. It returns false if the total is too big for a uint64.
+func sumAmounts(amounts ...uint64) (uint64, bool) {
+	var total uint64
+	for _, amount := range amounts {
+		var ok bool
+		if total, ok = addAmounts(total, amount); !ok {
+			return 0, false
+		}
+	}
+
+	return total, true
+}
+
+// Gets how many coins a chain has minted: the coins in its genesis block and every coinbase reward.
+// It returns false if that is too many for a uint64. Every balance is part of these coins, so if they fit, every balance does.
+func mintedCoins(blocks []Block) (uint64, bool) {
+	amounts := make([]uint64, 0, len(blocks))
+	for _, block := range blocks {
+		if len(block.Transactions) > 0 {
+			amounts = append(amounts, block.Transactions[0].Amount)
+		}
+	}
+
+	return sumAmounts(amounts...)
+}
+
+// Gets how many coins our Chain has minted (see mintedCoins). The count is kept as blocks are added, and only recounted
+// from the whole chain if our Chain was set without it (like when a node is created). The state must be locked.
+func (l *LocalNode) chainMinted() (uint64, bool) {
+	tip := LastBlock(l.Chain).hash()
+	if l.mintedTip == tip {
+		return l.minted, true
+	}
+
+	minted, ok := mintedCoins(l.Chain)
+	if !ok {
+		return 0, false
+	}
+
+	l.minted, l.mintedTip = minted, tip
+
+	return minted, true
+}
+
+// Gets how many coins there are in a UTXO: every account's spendable coins, immature coinbase rewards and unspent outputs.
+// It returns false if that is too many for a uint64.
+func (u UTXO) supply() (uint64, bool) {
+	var amounts []uint64
+	for _, funds := range u {
+		amounts = append(amounts, funds.Spendable)
+
+		for _, coins := range funds.Immature {
+			amounts = append(amounts, coins.Amount)
+		}
+
+		for _, amount := range funds.Outputs {
+			amounts = append(amounts, amount)
+		}
+	}
+
+	return sumAmounts(amounts...)
+}
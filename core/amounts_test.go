@@ -0,0 +1,215 @@
+package core
+
+import (
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"math"
+	"math/rand"
+	"testing"
+	"testing/quick"
+)
+
+func TestAmounts(t *testing.T) {
+	sum, ok := addAmounts(math.MaxUint64-1, 1)
+	assert.True(t, ok)
+	assert.Equal(t, uint64(math.MaxUint64), sum)
+
+	_, ok = addAmounts(math.MaxUint64, 1)
+	assert.False(t, ok)
+
+	difference, ok := subtractAmounts(5, 5)
+	assert.True(t, ok)
+	assert.Equal(t, uint64(0), difference)
+
+	_, ok = subtractAmounts(5, 6)
+	assert.False(t, ok)
+
+	total, ok := sumAmounts(1, 2, 3)
+	assert.True(t, ok)
+	assert.Equal(t, uint64(6), total)
+
+	// Amounts that wrap around to a small total
+	_, ok = sumAmounts(math.MaxUint64, 2, 3)
+	assert.False(t, ok)
+
+	minted, ok := mintedCoins([]Block{testGenesisBlock, harnessBlock1, harnessBlock2})
+	assert.True(t, ok)
+	assert.Equal(t, testGenesisBlock.Transactions[0].Amount+2*coinbaseReward, minted)
+}
+
+func TestOverflowingTransactions(t *testing.T) {
+	sender := testGenesisBlock.Transactions[0].Recipient
+
+	// A batch whose payments wrap around to its Amount
+	assert.False(t, validateBatch(Transaction{Sender: sender, Amount: 1, Payments: []Payment{{harnessRecipient, math.MaxUint64}, {harnessRecipient, 2}}}, UTXO{sender: {Spendable: 10}}))
+
+	// Outputs that wrap around to less than is spent
+	assert.False(t, validateOutputs(Transaction{Sender: sender, Amount: 1, Outputs: []Output{{harnessRecipient, math.MaxUint64}, {harnessRecipient, 2}}}, UTXO{sender: {Spendable: 10}}))
+
+	// Inputs that wrap around
+	utxo := UTXO{sender: {Spendable: math.MaxUint64, Outputs: map[string]uint64{"a:0": math.MaxUint64}}}
+	assert.False(t, validateOutputs(Transaction{Sender: sender, Amount: math.MaxUint64, Inputs: []Input{{"a", 0}}, Outputs: []Output{{harnessRecipient, 1}}}, utxo))
+
+	// Balances that would overflow aren't changed
+	utxo = UTXO{harnessRecipient: {Spendable: math.MaxUint64}}
+	assert.False(t, utxo.credit(harnessRecipient, 1))
+	assert.Equal(t, UTXO{harnessRecipient: {Spendable: math.MaxUint64}}, utxo)
+
+	assert.False(t, UTXO{sender: {Spendable: 10}, harnessRecipient: {Spendable: math.MaxUint64}}.applyTransaction(Transaction{Sender: sender, Recipient: harnessRecipient, Amount: 1}))
+	paysRecipient := []Block{{BlockHeader: BlockHeader{Transactions: []Transaction{{Sender: "0", Recipient: harnessRecipient, Amount: 1}}}}}
+	assert.False(t, UTXO{harnessRecipient: {Spendable: math.MaxUint64, Immature: []ImmatureCoins{{Amount: 1, MaturesAt: coinbaseMaturity}}}}.mature(coinbaseMaturity, paysRecipient))
+}
+
+func TestValidateBlock_OverflowingCoinbase(t *testing.T) {
+	fakeValidationServer := newFakeValidationServer(true)
+	defer fakeValidationServer.Close()
+
+	defer func(reward uint64) { coinbaseReward = reward }(coinbaseReward)
+
+	// A coinbase reward that would make more coins than a uint64 can hold (with the genesis block's coins) is invalid
+	coinbaseReward = math.MaxUint64
+	block := Block{BlockHeader: BlockHeader{Timestamp: 1586201500, Transactions: []Transaction{{Sender: "0", Recipient: "miner1", Amount: coinbaseReward, Timestamp: 1586201500}, harnessBlock1.Transactions[1]}, PreviousHash: testGenesisBlock.hash()}}
+	_, utxo := ValidateChain([]Block{testGenesisBlock}, fakeValidationServer.URL)
+	_, ok, _ := validateBlockTransactions(1, []Block{testGenesisBlock, block}, utxo, testGenesisBlock.Transactions[0].Amount, fakeValidationServer.URL)
+	assert.False(t, ok)
+
+	// Even when every balance on its own would fit
+	coinbaseReward = math.MaxUint64 - testGenesisBlock.Transactions[0].Amount + 1
+	block.Transactions[0].Amount = coinbaseReward
+	_, utxo = ValidateChain([]Block{testGenesisBlock}, fakeValidationServer.URL)
+	_, ok, _ = validateBlockTransactions(1, []Block{testGenesisBlock, block}, utxo, testGenesisBlock.Transactions[0].Amount, fakeValidationServer.URL)
+	assert.False(t, ok)
+
+	coinbaseReward = math.MaxUint64 - testGenesisBlock.Transactions[0].Amount
+	block.Transactions[0].Amount = coinbaseReward
+	_, utxo = ValidateChain([]Block{testGenesisBlock}, fakeValidationServer.URL)
+	minted, ok, err := validateBlockTransactions(1, []Block{testGenesisBlock, block}, utxo, testGenesisBlock.Transactions[0].Amount, fakeValidationServer.URL)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, uint64(math.MaxUint64), minted)
+}
+
+// Makes a random transaction between the test accounts. Amounts are either small or close to the most a uint64 can hold.
+func randomTransaction(random *rand.Rand, signature string) Transaction {
+	accounts := []string{testGenesisBlock.Transactions[0].Recipient, testGenesisAddress, testGenesisCompressedKey, harnessRecipient}
+	account := func() string {
+		return accounts[random.Intn(len(accounts))]
+	}
+
+	amount := func() uint64 {
+		if random.Intn(4) == 0 {
+			return math.MaxUint64 - uint64(random.Intn(1000))
+		}
+
+		return uint64(random.Intn(1000)) + 1
+	}
+
+	transaction := Transaction{Sender: account(), Timestamp: 1586201490, Signature: signature}
+
+	switch random.Intn(3) {
+	case 0:
+		transaction.Recipient = account()
+		transaction.Amount = amount()
+	case 1:
+		for i := random.Intn(3); i >= 0; i-- {
+			payment := Payment{account(), amount()}
+			transaction.Payments = append(transaction.Payments, payment)
+			transaction.Amount += payment.Amount
+		}
+	case 2:
+		transaction.Amount = amount()
+		for i := random.Intn(3); i >= 0; i-- {
+			transaction.Outputs = append(transaction.Outputs, Output{account(), amount()})
+		}
+	}
+
+	return transaction
+}
+
+func TestSupply(t *testing.T) {
+	fakeValidationServer := newFakeValidationServer(true)
+	defer fakeValidationServer.Close()
+
+	defer func(reward uint64, maturity int) { coinbaseReward, coinbaseMaturity = reward, maturity }(coinbaseReward, coinbaseMaturity)
+	coinbaseMaturity = 2
+
+	// The coins in the fixture chains are the genesis block's coins and their coinbase rewards
+	for _, chain := range [][]Block{{testGenesisBlock, harnessBlock1, harnessBlock2}, {testGenesisBlock, outputsBlock1, outputsBlock2}, {testGenesisBlock, batchBlock}} {
+		valid, utxo := ValidateChain(chain, fakeValidationServer.URL)
+		assert.True(t, valid)
+
+		supply, ok := utxo.supply()
+		assert.True(t, ok)
+		assert.Equal(t, testGenesisBlock.Transactions[0].Amount+uint64(len(chain)-1)*coinbaseReward, supply)
+	}
+
+	var accepted int
+
+	// After any valid chain (including ones with huge amounts), the supply is the genesis block's coins plus every coinbase reward
+	supplyIsMinted := func(seed int64) bool {
+		random := rand.New(rand.NewSource(seed))
+
+		// Sometimes use a reward big enough that only a few coinbase rewards fit in a uint64
+		coinbaseReward = 1000
+		if random.Intn(2) == 0 {
+			coinbaseReward = math.MaxUint64 / 4
+		}
+
+		chain := []Block{testGenesisBlock}
+		_, utxo, minted, _ := validateChain(chain, fakeValidationServer.URL)
+
+		for i := 0; i < 8; i++ {
+			block := Block{BlockHeader: BlockHeader{Timestamp: 1586201500, Transactions: []Transaction{{Sender: "0", Recipient: harnessRecipient, Amount: coinbaseReward, Timestamp: 1586201500}}}}
+			for j := random.Intn(3); j >= 0; j-- {
+				block.Transactions = append(block.Transactions, randomTransaction(random, fmt.Sprintf("signature-%v-%v-%v", seed, i, j)))
+			}
+
+			// Invalid blocks aren't added to the chain
+			newUTXO := utxo.copy()
+			newMinted, ok, _ := validateBlockTransactions(len(chain), append(chain, block), newUTXO, minted, fakeValidationServer.URL)
+			if !ok {
+				continue
+			}
+
+			chain = append(chain, block)
+			utxo, minted = newUTXO, newMinted
+			accepted++
+
+			// The running count of minted coins matches a recount of the chain
+			supply, supplyOK := utxo.supply()
+			recounted, mintedOK := mintedCoins(chain)
+			if !supplyOK || !mintedOK || supply != minted || recounted != minted {
+				return false
+			}
+		}
+
+		return true
+	}
+
+	assert.NoError(t, quick.Check(supplyIsMinted, &quick.Config{MaxCount: 50, Rand: rand.New(rand.NewSource(1))}))
+	assert.NotZero(t, accepted)
+}
+
+func TestLocalNode_ChainMinted(t *testing.T) {
+	fakeValidationServer := newFakeValidationServer(true)
+	defer fakeValidationServer.Close()
+
+	// A node that was created without a count recounts its chain
+	node := newTestMinerNode(fakeValidationServer.URL)
+	minted, ok := node.chainMinted()
+	assert.True(t, ok)
+	assert.Equal(t, testGenesisBlock.Transactions[0].Amount, minted)
+
+	// Each new block only adds its reward to the count
+	assert.True(t, node.AddMinedBlockToChain(harnessBlock1))
+	assert.Equal(t, harnessBlock1.hash(), node.mintedTip)
+	assert.Equal(t, testGenesisBlock.Transactions[0].Amount+coinbaseReward, node.minted)
+
+	// Switching chains replaces the count
+	valid, utxo, minted, err := validateChain([]Block{testGenesisBlock, harnessBlock1, harnessBlock2}, fakeValidationServer.URL)
+	assert.NoError(t, err)
+	assert.True(t, valid)
+	assert.True(t, node.switchChain([]Block{testGenesisBlock, harnessBlock1, harnessBlock2}, utxo, minted))
+	assert.Equal(t, harnessBlock2.hash(), node.mintedTip)
+	assert.Equal(t, testGenesisBlock.Transactions[0].Amount+2*coinbaseReward, node.minted)
+}
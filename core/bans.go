@@ -0,0 +1,304 @@
+package core
+
+import (
+	"encoding/json"
+	"github.com/perlin-network/noise"
+	log "github.com/sirupsen/logrus"
+	"io/ioutil"
+	"os"
+	"sync"
+	"time"
+)
+
+// How much misbehaviour a peer can get away with before we ban them if LocalNode.BanThreshold is not set
+const DefaultBanThreshold = 100
+
+// How long peers are banned for if LocalNode.BanDuration is not set
+const DefaultBanDuration = 24 * time.Hour
+
+// How long it takes a peer's misbehaviour score to drop by one, so honest peers that occasionally relay something bad aren't banned
+const scoreDecayInterval = time.Minute
+
+// How much each kind of misbehaviour adds to a peer's score
+const (
+	penaltyUndecodableMessage      = 25  // The peer sent us a message we couldn't decode
+	penaltyInvalidTransaction      = 10  // The peer sent us a transaction with an invalid signature (each costs us a call to the validation server)
+	penaltyUnsolicitedTransactions = 25  // The peer sent us more MemPool transactions than we could have asked them for
+	penaltyInvalidBlock            = 20  // The peer sent us a block that wasn't valid
+	penaltyInvalidChain            = 100 // The peer sent us a chain with a different (or missing) genesis block, or an invalid (like tampered) chain
+)
+
+// banList keeps track of how much each peer has misbehaved, and which peers are banned (and until when).
+// Peers are kept under their peer key (see peerKey). The bans are saved to a file (if one is set) so they persist between restarts.
+type banList struct {
+	sync.Mutex
+
+	scores map[string]misbehaviour // Peer key -> misbehaviour score
+	bans   map[string]time.Time    // Peer key -> when their ban expires
+	path   string                  // Where the bans are saved (nothing is saved if this is empty)
+}
+
+// A misbehaviour score, which drops by one every scoreDecayInterval.
+type misbehaviour struct {
+	score   int
+	decayed time.Time // When the score last dropped (or was first given)
+}
+
+// decay gets a misbehaviour score after it has dropped for the time that has passed up to now.
+func (m misbehaviour) decay(now time.Time) misbehaviour {
+	drop := int(now.Sub(m.decayed) / scoreDecayInterval)
+	if drop >= m.score {
+		return misbehaviour{decayed: now}
+	}
+
+	return misbehaviour{score: m.score - drop, decayed: m.decayed.Add(time.Duration(drop) * scoreDecayInterval)}
+}
+
+// newBanList creates a ban list, loading any saved bans from the file at path (if there is one).
+func newBanList(path string) (*banList, error) {
+	b := &banList{scores: make(map[string]misbehaviour), bans: make(map[string]time.Time), path: path}
+
+	if path == "" {
+		return b, nil
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return b, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(data, &b.bans); err != nil {
+		return nil, err
+	}
+
+	return b, nil
+}
+
+// penalize adds to a peer's (decayed) misbehaviour score. It returns true if the peer's score has reached the threshold
+// (at which point their score is reset, as they should be banned).
+func (b *banList) penalize(key string, penalty int, threshold int) bool {
+	if b == nil {
+		return false
+	}
+
+	b.Lock()
+	defer b.Unlock()
+
+	m := b.scores[key].decay(time.Now())
+	m.score += penalty
+
+	if m.score >= threshold {
+		delete(b.scores, key)
+		return true
+	}
+
+	b.scores[key] = m
+
+	return false
+}
+
+// score gets a peer's current (decayed) misbehaviour score.
+func (b *banList) score(key string) int {
+	if b == nil {
+		return 0
+	}
+
+	b.Lock()
+	defer b.Unlock()
+
+	return b.scores[key].decay(time.Now()).score
+}
+
+// ban bans a peer for a duration and saves the ban list.
+func (b *banList) ban(key string, duration time.Duration) error {
+	if b == nil {
+		return nil
+	}
+
+	b.Lock()
+	defer b.Unlock()
+
+	b.bans[key] = time.Now().Add(duration)
+
+	return b.save()
+}
+
+// unban lifts a peer's ban (and clears their score) and saves the ban list.
+func (b *banList) unban(key string) error {
+	if b == nil {
+		return nil
+	}
+
+	b.Lock()
+	defer b.Unlock()
+
+	delete(b.bans, key)
+	delete(b.scores, key)
+
+	return b.save()
+}
+
+// isBanned checks whether a peer is currently banned. Expired bans are removed.
+func (b *banList) isBanned(key string) bool {
+	if b == nil {
+		return false
+	}
+
+	b.Lock()
+	defer b.Unlock()
+
+	expiry, ok := b.bans[key]
+	if !ok {
+		return false
+	}
+
+	if time.Now().After(expiry) {
+		delete(b.bans, key)
+		return false
+	}
+
+	return true
+}
+
+// banned gets a copy of every current ban (peer key -> when their ban expires).
+func (b *banList) banned() map[string]time.Time {
+	bans := make(map[string]time.Time)
+
+	if b == nil {
+		return bans
+	}
+
+	b.Lock()
+	defer b.Unlock()
+
+	now := time.Now()
+	for key, expiry := range b.bans {
+		if now.Before(expiry) {
+			bans[key] = expiry
+		}
+	}
+
+	return bans
+}
+
+// flush saves the ban list to its file.
+func (b *banList) flush() error {
+	if b == nil {
+		return nil
+	}
+
+	b.Lock()
+	defer b.Unlock()
+
+	return b.save()
+}
+
+// save writes the bans to the ban list's file. The ban list must be locked.
+func (b *banList) save() error {
+	if b.path == "" {
+		return nil
+	}
+
+	data, err := json.Marshal(b.bans)
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(b.path, data, 0644)
+}
+
+// peerKey gets the key we keep a peer's score and ban under: the hex public key they proved they hold in the noise handshake.
+// A peer's address is only what they tell us about themselves, so keying on it would let them get another peer banned.
+func peerKey(id noise.ID) string {
+	return id.ID.String()
+}
+
+// penalizePeer adds to a peer's misbehaviour score, and bans (and disconnects) them if it reaches BanThreshold.
+func (l *LocalNode) penalizePeer(peer noise.ID, penalty int, reason string) {
+	threshold := l.BanThreshold
+	if threshold == 0 {
+		threshold = DefaultBanThreshold
+	}
+
+	log.Warnf("Penalizing peer %s: %s", peer.Address, reason)
+
+	if l.bans.penalize(peerKey(peer), penalty, threshold) {
+		duration := l.BanDuration
+		if duration == 0 {
+			duration = DefaultBanDuration
+		}
+
+		log.Warnf("Peer %s misbehaved too much and has been banned for %s.", peer.Address, duration)
+
+		if err := l.BanPeer(peerKey(peer), duration); err != nil {
+			log.Errorf("Failed to save the ban list: %s", err)
+		}
+	}
+}
+
+// BanPeer bans a peer (by their peer key, see PeerKey) for a duration and disconnects from them. Messages from banned peers are ignored.
+func (l *LocalNode) BanPeer(key string, duration time.Duration) error {
+	err := l.bans.ban(key, duration)
+
+	l.disconnectPeer(key)
+
+	return err
+}
+
+// UnbanPeer lifts a peer's ban.
+func (l *LocalNode) UnbanPeer(key string) error {
+	return l.bans.unban(key)
+}
+
+// BannedPeers gets every banned peer's key and when their ban expires.
+func (l *LocalNode) BannedPeers() map[string]time.Time {
+	return l.bans.banned()
+}
+
+// ConnectedPeerKeys gets the peer key of every peer we are connected to (by the address they gave us), so they can be banned.
+func (l *LocalNode) ConnectedPeerKeys() map[string]string {
+	keys := make(map[string]string)
+
+	// We aren't connected to the P2P network yet
+	if l.node == nil {
+		return keys
+	}
+
+	for _, client := range append(l.node.Inbound(), l.node.Outbound()...) {
+		if id := client.ID(); id.Address != "" {
+			keys[id.Address] = peerKey(id)
+		}
+	}
+
+	return keys
+}
+
+// IsPeerBanned checks whether a peer (by their peer key) is currently banned.
+func (l *LocalNode) IsPeerBanned(key string) bool {
+	return l.bans.isBanned(key)
+}
+
+// disconnectPeer closes all of our connections to a peer (by their peer key) and removes them from our routing table.
+func (l *LocalNode) disconnectPeer(key string) {
+	// We aren't connected to the P2P network yet
+	if l.node == nil {
+		return
+	}
+
+	for _, client := range append(l.node.Inbound(), l.node.Outbound()...) {
+		if id := client.ID(); peerKey(id) == key {
+			client.Close()
+
+			l.inventory.forget(id.Address)
+			l.peers.forget(id.Address)
+		}
+	}
+
+	for _, id := range l.kademliaProtocol.Table().Entries() {
+		if peerKey(id) == key {
+			l.kademliaProtocol.Table().Delete(id.ID)
+		}
+	}
+}
@@ -0,0 +1,103 @@
+package core
+
+import (
+	"github.com/perlin-network/noise"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestBanList(t *testing.T) {
+	bans, err := newBanList("")
+	assert.NoError(t, err)
+
+	// Scores add up until they reach the threshold
+	assert.False(t, bans.penalize("peer1", 60, 100))
+	assert.Equal(t, 60, bans.score("peer1"))
+	assert.True(t, bans.penalize("peer1", 60, 100))
+	assert.Equal(t, 0, bans.score("peer1"))
+
+	assert.False(t, bans.isBanned("peer1"))
+	assert.NoError(t, bans.ban("peer1", time.Hour))
+	assert.True(t, bans.isBanned("peer1"))
+	assert.Contains(t, bans.banned(), "peer1")
+
+	assert.NoError(t, bans.unban("peer1"))
+	assert.False(t, bans.isBanned("peer1"))
+
+	// Scores drop over time
+	assert.False(t, bans.penalize("peer3", 60, 100))
+	bans.scores["peer3"] = misbehaviour{score: 60, decayed: time.Now().Add(-10*scoreDecayInterval - time.Second)}
+	assert.Equal(t, 50, bans.score("peer3"))
+	assert.False(t, bans.penalize("peer3", 45, 100))
+	assert.Equal(t, 95, bans.score("peer3"))
+
+	bans.scores["peer3"] = misbehaviour{score: 95, decayed: time.Now().Add(-200 * scoreDecayInterval)}
+	assert.Equal(t, 0, bans.score("peer3"))
+	assert.False(t, bans.penalize("peer3", 60, 100))
+
+	// Expired bans are lifted
+	assert.NoError(t, bans.ban("peer2", -time.Second))
+	assert.False(t, bans.isBanned("peer2"))
+	assert.NotContains(t, bans.banned(), "peer2")
+}
+
+func TestBanList_Persistence(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cosmosis")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "bans.json")
+
+	bans, err := newBanList(path)
+	assert.NoError(t, err)
+	assert.NoError(t, bans.ban("peer1", time.Hour))
+
+	// Bans are loaded back in from the file
+	loadedBans, err := newBanList(path)
+	assert.NoError(t, err)
+	assert.True(t, loadedBans.isBanned("peer1"))
+
+	// Corrupt ban lists return an error
+	assert.NoError(t, ioutil.WriteFile(path, []byte("not json"), 0644))
+	_, err = newBanList(path)
+	assert.Error(t, err)
+}
+
+// newTestPeer creates the ID of a peer (with a new key pair) that says it is at address.
+func newTestPeer(t *testing.T, address string) noise.ID {
+	publicKey, _, err := noise.GenerateKeys(nil)
+	assert.NoError(t, err)
+
+	return noise.ID{ID: publicKey, Address: address}
+}
+
+func TestLocalNode_PenalizePeer(t *testing.T) {
+	localNode := LocalNode{Chain: []Block{testGenesisBlock}, MemPool: make([]Transaction, 0), UTXO: make(UTXO), ValidationServerURL: validationServer, OperatorPublicKey: "0", MinimumChainsForConsensus: 1, BanThreshold: 50, BanDuration: time.Hour}
+	localNode.bans, _ = newBanList("")
+
+	peer := newTestPeer(t, "1.2.3.4:7000")
+
+	localNode.penalizePeer(peer, penaltyInvalidBlock, "test")
+	assert.False(t, localNode.IsPeerBanned(peerKey(peer)))
+
+	// Reaching the threshold bans the peer
+	localNode.penalizePeer(peer, penaltyInvalidChain, "test")
+	assert.True(t, localNode.IsPeerBanned(peerKey(peer)))
+	assert.Contains(t, localNode.BannedPeers(), peerKey(peer))
+
+	// Bans are by key, so a peer that claims another peer's address can't get them banned
+	impostor := newTestPeer(t, "5.6.7.8:7000")
+	honest := newTestPeer(t, impostor.Address)
+
+	localNode.penalizePeer(impostor, penaltyInvalidChain, "test")
+	assert.True(t, localNode.IsPeerBanned(peerKey(impostor)))
+	assert.False(t, localNode.IsPeerBanned(peerKey(honest)))
+	assert.NotContains(t, localNode.BannedPeers(), impostor.Address)
+
+	assert.NoError(t, localNode.UnbanPeer(peerKey(peer)))
+	assert.False(t, localNode.IsPeerBanned(peerKey(peer)))
+}
@@ -0,0 +1,68 @@
+package core
+
+import (
+	"errors"
+	"math/big"
+	"strings"
+)
+
+// The base58 alphabet used by Bitcoin (it leaves out 0, O, I and l so they can't be confused with each other).
+const base58Alphabet = "123456789ABCDEFGHJKLMNPQRSTUVWXYZabcdefghijkmnopqrstuvwxyz"
+
+var bigRadix = big.NewInt(58)
+
+// Encodes bytes as base58. Leading zero bytes are kept as leading 1s.
+func base58Encode(input []byte) string {
+	x := new(big.Int).SetBytes(input)
+	mod := new(big.Int)
+
+	var encoded []byte
+	for x.Sign() > 0 {
+		x.DivMod(x, bigRadix, mod)
+		encoded = append(encoded, base58Alphabet[mod.Int64()])
+	}
+
+	for _, b := range input {
+		if b != 0 {
+			break
+		}
+		encoded = append(encoded, base58Alphabet[0])
+	}
+
+	// Reverse the digits (we built them least significant first)
+	for i, j := 0, len(encoded)-1; i < j; i, j = i+1, j-1 {
+		encoded[i], encoded[j] = encoded[j], encoded[i]
+	}
+
+	return string(encoded)
+}
+
+// Gets the most characters n bytes can take up when encoded as base58 (log(256) / log(58) is just under 1.38).
+func maxBase58Length(n int) int {
+	return n*138/100 + 1
+}
+
+// Decodes a base58 string. It returns an error if the string has characters outside of the base58 alphabet.
+func base58Decode(input string) ([]byte, error) {
+	x := new(big.Int)
+
+	for _, c := range input {
+		digit := strings.IndexRune(base58Alphabet, c)
+		if digit < 0 {
+			return nil, errors.New("invalid base58 character")
+		}
+
+		x.Mul(x, bigRadix)
+		x.Add(x, big.NewInt(int64(digit)))
+	}
+
+	decoded := x.Bytes()
+
+	// Leading 1s are leading zero bytes
+	leadingZeros := 0
+	for leadingZeros < len(input) && input[leadingZeros] == base58Alphabet[0] {
+		leadingZeros++
+	}
+
+	return append(make([]byte, leadingZeros), decoded...), nil
+}
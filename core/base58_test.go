@@ -0,0 +1,28 @@
+package core
+
+import (
+	"bytes"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestBase58(t *testing.T) {
+	assert.Equal(t, "StV1DL6CwTryKyV", base58Encode([]byte("hello world")))
+	assert.Equal(t, "", base58Encode(nil))
+
+	// Leading zero bytes are kept
+	assert.Equal(t, "11StV1DL6CwTryKyV", base58Encode(append([]byte{0, 0}, []byte("hello world")...)))
+
+	decoded, err := base58Decode("11StV1DL6CwTryKyV")
+	assert.NoError(t, err)
+	assert.Equal(t, append([]byte{0, 0}, []byte("hello world")...), decoded)
+
+	// 0, O, I and l aren't base58
+	_, err = base58Decode("StV1DL6CwTryKy0")
+	assert.Error(t, err)
+
+	// No address is longer than maxBase58Length
+	largest := bytes.Repeat([]byte{0xff}, addressLength)
+	assert.Len(t, base58Encode(largest), maxBase58Length(addressLength))
+	assert.True(t, len(base58Encode(make([]byte, addressLength))) <= maxBase58Length(addressLength))
+}
@@ -0,0 +1,69 @@
+package core
+
+import (
+	"fmt"
+	"strings"
+)
+
+// The most payments a batch transaction can make.
+const MaxBatchPayments = 1000
+
+// A Payment is one of the payments made by a batch transaction.
+type Payment struct {
+	Recipient string // The address or public key the coins are paid to
+	Amount    uint64 // How many coins are paid
+}
+
+// Checks whether a transaction is a batch transaction: instead of paying Amount to Recipient, it pays each of its Payments
+// (with one signature), and Amount is their total.
+func (t Transaction) isBatch() bool {
+	return len(t.Payments) > 0
+}
+
+// Puts a batch transaction's payments into the format they are signed in: [BATCH AMOUNT TO RECIPIENT, ...]
+func batchRepresentation(transaction Transaction) string {
+	payments := make([]string, 0, len(transaction.Payments))
+	for _, payment := range transaction.Payments {
+		payments = append(payments, fmt.Sprintf("%v TO %v", payment.Amount, payment.Recipient))
+	}
+
+	return fmt.Sprintf(" [BATCH %v]", strings.Join(payments, ", "))
+}
+
+// Checks the coins of a batch transaction: it must not have a Recipient (or inputs and outputs), it must make between 1 and MaxBatchPayments payments
+// of a positive amount to valid recipients, Amount must be their total, and the Sender's balance must cover all of them.
+func validateBatch(transaction Transaction, utxo UTXO) bool {
+	if transaction.Recipient != "" || transaction.isOutputBased() || len(transaction.Payments) > MaxBatchPayments {
+		return false
+	}
+
+	amounts := make([]uint64, 0, len(transaction.Payments))
+	for _, payment := range transaction.Payments {
+		if payment.Amount == 0 || !IsValidRecipient(payment.Recipient) {
+			return false
+		}
+
+		amounts = append(amounts, payment.Amount)
+	}
+
+	// Payments that add up to more than a uint64 can hold are invalid (instead of wrapping around to a smaller total)
+	total, ok := sumAmounts(amounts...)
+
+	return ok && total == transaction.Amount && transaction.Amount <= utxo.Balance(transaction.Sender)
+}
+
+// Applies a (valid) batch transaction in one step: its Amount is taken from the Sender, and each payment is given to its recipient.
+// It returns false if a recipient's coins would overflow.
+func (u UTXO) applyBatch(transaction Transaction) bool {
+	if !u.debit(transaction.Sender, transaction.Amount) {
+		return false
+	}
+
+	for _, payment := range transaction.Payments {
+		if !u.credit(payment.Recipient, payment.Amount) {
+			return false
+		}
+	}
+
+	return true
+}
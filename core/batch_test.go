@@ -0,0 +1,130 @@
+package core
+
+import (
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+)
+
+// A batch transaction from testGenesisBlock's key, and one from harnessRecipient that pays more than it gets in harnessBlock1.
+var batchTransaction = Transaction{Sender: testGenesisBlock.Transactions[0].Recipient, Amount: 15, Timestamp: 1586201490, Signature: "signature14", Payments: []Payment{{harnessRecipient, 10}, {testGenesisAddress, 5}}}
+var overspendingBatchTransaction = Transaction{Sender: harnessRecipient, Amount: 12, Timestamp: 1586201490, Signature: "signature15", Payments: []Payment{{testGenesisAddress, 6}, {testGenesisAddress, 6}}}
+
+var batchBlock = Block{BlockHeader: BlockHeader{Timestamp: 1586201500, Transactions: []Transaction{{Sender: "0", Recipient: "miner1", Amount: 1000, Timestamp: 1586201500}, batchTransaction}, PreviousHash: testGenesisBlock.hash()}, Proof: Proof{Nonce: 331, DifficultyThreshold: 5}}
+var overspendingBatchBlock = Block{BlockHeader: BlockHeader{Timestamp: 1586201500, Transactions: []Transaction{{Sender: "0", Recipient: "miner1", Amount: 1000, Timestamp: 1586201500}, overspendingBatchTransaction}, PreviousHash: harnessBlock1.hash()}, Proof: Proof{Nonce: 1639097, DifficultyThreshold: 5}}
+
+func TestTransaction_Batch(t *testing.T) {
+	assert.False(t, harnessBlock1.Transactions[1].isBatch())
+	assert.True(t, batchTransaction.isBatch())
+
+	// The payments are signed
+	assert.Equal(t, batchTransaction.Sender+" -15->  (1586201490) [BATCH 10 TO "+harnessRecipient+", 5 TO "+testGenesisAddress+"]", TransactionRepresentation(batchTransaction))
+
+	// And hashed
+	changed := batchTransaction
+	changed.Payments = []Payment{{harnessRecipient, 5}, {testGenesisAddress, 10}}
+	assert.NotEqual(t, batchTransaction.hash(), changed.hash())
+
+	assert.True(t, batchTransaction.HasValidRecipients())
+	assert.False(t, Transaction{Sender: harnessRecipient, Payments: []Payment{{harnessRecipient, 1}, {"nobody", 1}}}.HasValidRecipients())
+	assert.False(t, Transaction{Sender: harnessRecipient, Recipient: harnessRecipient, Payments: []Payment{{harnessRecipient, 1}}}.HasValidRecipients())
+	assert.False(t, Transaction{Sender: harnessRecipient, Payments: []Payment{{harnessRecipient, 1}}, Outputs: []Output{{harnessRecipient, 1}}}.HasValidRecipients())
+}
+
+func TestValidateBatch(t *testing.T) {
+	sender := testGenesisBlock.Transactions[0].Recipient
+	utxo := UTXO{sender: {Spendable: 10}, testGenesisAddress: {Spendable: 5}}
+
+	valid := func(transaction Transaction) bool {
+		transaction.Sender = sender
+		return validateBatch(transaction, utxo)
+	}
+
+	// The sender's balance (including their address) must cover every payment
+	assert.True(t, valid(Transaction{Amount: 15, Payments: []Payment{{harnessRecipient, 7}, {harnessRecipient, 8}}}))
+	assert.False(t, valid(Transaction{Amount: 16, Payments: []Payment{{harnessRecipient, 8}, {harnessRecipient, 8}}}))
+
+	// Amount must be the total of the payments
+	assert.False(t, valid(Transaction{Amount: 10, Payments: []Payment{{harnessRecipient, 7}, {harnessRecipient, 8}}}))
+	assert.False(t, valid(Transaction{Amount: 15, Payments: []Payment{{harnessRecipient, 7}}}))
+
+	// Invalid payments
+	assert.False(t, valid(Transaction{Amount: 7, Payments: []Payment{{harnessRecipient, 7}, {harnessRecipient, 0}}}))
+	assert.False(t, valid(Transaction{Amount: 7, Payments: []Payment{{"nobody", 7}}}))
+	assert.False(t, valid(Transaction{Recipient: harnessRecipient, Amount: 7, Payments: []Payment{{harnessRecipient, 7}}}))
+	assert.False(t, valid(Transaction{Amount: 7, Payments: []Payment{{harnessRecipient, 7}}, Outputs: []Output{{harnessRecipient, 7}}}))
+
+	tooMany := make([]Payment, MaxBatchPayments+1)
+	for i := range tooMany {
+		tooMany[i] = Payment{harnessRecipient, 1}
+	}
+
+	assert.False(t, validateBatch(Transaction{Sender: sender, Amount: MaxBatchPayments + 1, Payments: tooMany}, UTXO{sender: {Spendable: 2 * MaxBatchPayments}}))
+	assert.True(t, validateBatch(Transaction{Sender: sender, Amount: MaxBatchPayments, Payments: tooMany[1:]}, UTXO{sender: {Spendable: 2 * MaxBatchPayments}}))
+}
+
+func TestValidateTransaction_Batch(t *testing.T) {
+	var requests int32
+	countingValidationServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"valid_signature": true}`))
+	}))
+	defer countingValidationServer.Close()
+
+	sender := testGenesisBlock.Transactions[0].Recipient
+
+	payroll := Transaction{Sender: sender, Amount: 200, Timestamp: 1586201490, Signature: "signature"}
+	for i := 0; i < 200; i++ {
+		payroll.Payments = append(payroll.Payments, Payment{harnessRecipient, 1})
+	}
+
+	// 200 payments are checked with one signature
+	assert.True(t, ValidateTransaction(payroll, UTXO{sender: {Spendable: 200}}, countingValidationServer.URL))
+	assert.Equal(t, int32(1), atomic.LoadInt32(&requests))
+
+	assert.False(t, ValidateTransaction(payroll, UTXO{sender: {Spendable: 199}}, countingValidationServer.URL))
+}
+
+func TestUTXO_ApplyBatch(t *testing.T) {
+	sender := testGenesisBlock.Transactions[0].Recipient
+	utxo := UTXO{sender: {Spendable: 10}, testGenesisAddress: {Spendable: 5}}
+
+	utxo.applyTransaction(Transaction{Sender: sender, Amount: 14, Payments: []Payment{{harnessRecipient, 7}, {harnessRecipient, 3}, {testGenesisCompressedKey, 4}}})
+
+	assert.Equal(t, UTXO{sender: {Spendable: 4}, testGenesisAddress: {Spendable: 1}, harnessRecipient: {Spendable: 10}}, utxo)
+}
+
+func TestValidateBlock_Batch(t *testing.T) {
+	fakeValidationServer := newFakeValidationServer(true)
+	defer fakeValidationServer.Close()
+
+	valid, utxo := ValidateChain([]Block{testGenesisBlock, batchBlock}, fakeValidationServer.URL)
+	assert.True(t, valid)
+	assert.Equal(t, testGenesisBlock.Transactions[0].Amount-10, utxo.Balance(testGenesisBlock.Transactions[0].Recipient))
+	assert.Equal(t, uint64(10), utxo.Balance(harnessRecipient))
+
+	// A batch that the sender can't pay all of is invalid (even though they could pay some of it)
+	valid, _ = ValidateChain([]Block{testGenesisBlock, harnessBlock1, overspendingBatchBlock}, fakeValidationServer.URL)
+	assert.False(t, valid)
+}
+
+func TestNewBlockTemplate_Batch(t *testing.T) {
+	fakeValidationServer := newFakeValidationServer(true)
+	defer fakeValidationServer.Close()
+
+	node := newTestMinerNode(fakeValidationServer.URL)
+
+	assert.True(t, node.AddTransactionToMemPool(batchTransaction))
+	assert.True(t, node.AddTransactionToMemPool(overspendingBatchTransaction))
+
+	// harnessRecipient gets 10 coins from the first batch, which isn't enough for the second
+	template := node.NewBlockTemplate()
+	assert.NotNil(t, template)
+	assert.Equal(t, []Transaction{batchTransaction}, template.Transactions[1:])
+
+	// Batches with invalid payments aren't accepted
+	assert.False(t, node.AddTransactionToMemPool(Transaction{Sender: harnessRecipient, Amount: 10, Timestamp: 1586201490, Signature: "signature16", Payments: []Payment{{"nobody", 10}}}))
+}
@@ -1,38 +1,94 @@
 package core
 
 import (
+	"errors"
+	"github.com/perlin-network/noise"
 	log "github.com/sirupsen/logrus"
 	"reflect"
 	"sort"
+	"sync/atomic"
 	"time"
 )
 
+// Why a transaction wasn't added to our MemPool (see addTransactionToMemPool).
+var (
+	errInvalidRecipient = errors.New("the transaction has an invalid recipient")
+	errInvalidSignature = errors.New("the transaction has an invalid signature")
+	errKnownTransaction = errors.New("the transaction is already in our MemPool or chain")
+	errLockTooLong      = errors.New("the transaction is locked for too long (or forever)")
+	errMemPoolFull      = errors.New("our MemPool is full")
+)
+
 // Adds a transaction to the MemPool (but will do nothing to incorporate it into a block or verify it).
-func (l *LocalNode) AddTransactionToMemPool(transaction Transaction, doNotBroadcast ...bool) {
-	//TODO: If performance becomes a problem run this in a separate goroutine
+// It returns whether the transaction was added.
+func (l *LocalNode) AddTransactionToMemPool(transaction Transaction, doNotBroadcast ...bool) bool {
+	// Only broadcast if we aren't passed a doNotBroadcast param
+	err := l.addTransactionToMemPool(transaction, len(doNotBroadcast) == 0)
 
-	// Don't accept transactions with invalid signatures
-	if !ValidateSignature(transaction, l.ValidationServerURL) {
+	switch err {
+	case nil:
+		return true
+	case errInvalidRecipient:
+		log.Warn("We just got a transaction with an invalid recipient. It was not added.")
+	case errInvalidSignature:
 		log.Warn("We just got a transaction with an invalid signature. It was not added.")
-		return
+	case errKnownTransaction:
+		log.Warn("We just got a duplicate transaction. It was not added.")
+	case errLockTooLong:
+		log.Warn("We just got a transaction that won't unlock for too long. It was not added.")
+	case errMemPoolFull:
+		log.Warn("We just got a transaction, but our MemPool is full. It was not added.")
+	default:
+		log.Errorf("We couldn't check the signatures of a transaction. It was not added. [error: %s]", err)
 	}
 
-	// If transaction is not already in MemPool/Chain:
-	if IsTransactionAlreadyInMemPoolOrChain(transaction, l.MemPool, l.Chain) {
-		log.Warn("We just got a duplicate transaction. It was not added.")
-		return
+	return false
+}
+
+// Adds a transaction to the MemPool, broadcasting it if broadcast is set (see AddTransactionToMemPool).
+// It returns why the transaction wasn't added: errInvalidRecipient, errLockTooLong, errInvalidSignature, errKnownTransaction, errMemPoolFull,
+// or any other error if the validation server couldn't tell us whether its signatures are valid (which isn't the fault of whoever sent it).
+func (l *LocalNode) addTransactionToMemPool(transaction Transaction, broadcast bool) error {
+	//TODO: If performance becomes a problem run this in a separate goroutine
+
+	// Don't accept transactions to recipients nobody can own (like a mistyped address)
+	if !transaction.HasValidRecipients() {
+		return errInvalidRecipient
 	}
 
-	// Add transaction to MemPool.
-	l.MemPool = append(l.MemPool, transaction)
+	state := l.Snapshot()
 
-	// Only broadcast if we aren't passed a doNotBroadcast param
-	if len(doNotBroadcast) == 0 {
+	// Don't keep transactions that won't be valid for a long time (or ever) in the MemPool (see RemoveStaleTransactions)
+	if !transaction.unlocksWithinHorizon(len(state.Chain), time.Now()) {
+		return errLockTooLong
+	}
+
+	// Don't bother the validation server with transactions we already have
+	if IsTransactionAlreadyInMemPoolOrChain(transaction, state.MemPool, state.Chain) {
+		return errKnownTransaction
+	}
+
+	// Don't accept transactions with invalid signatures (or from malformed public keys)
+	if valid, err := validateTransactionSignatures(transaction, l.ValidationServerURL); err != nil {
+		return err
+	} else if !valid {
+		return errInvalidSignature
+	}
+
+	// Add transaction to MemPool (if it wasn't added while we were checking its signatures).
+	if err := l.addToMemPool(transaction); err != nil {
+		return err
+	}
+
+	if broadcast {
 		l.BroadcastTransaction(transaction)
 	}
 
 	log.Info("We just got a new transaction!")
 
+	l.events.publish(memPoolChanged)
+
+	return nil
 }
 
 // Adds a new block to the chain (by first verifying it and getting its UTXO). It has side effects:
@@ -40,43 +96,59 @@ func (l *LocalNode) AddTransactionToMemPool(transaction Transaction, doNotBroadc
 //  - It removes the transactions inside the block from the MemPool
 //  - It updates the UTXO
 func (l *LocalNode) AddMinedBlockToChain(block Block, alternativePeerConsensusFunction ...func()) bool {
-	// Cancel mining processes as a new block has been found
-	l.IsMining = false
-
 	// If the previous hash is not the previous block's hash:
-	if block.PreviousHash != LastBlock(l.Chain).hash() {
+	if block.PreviousHash != LastBlock(l.Snapshot().Chain).hash() {
 		// We might have missed a previous block that was broadcast to us.
+		// Blocks from peers with missing parents are held in our orphan pool until their parents arrive (see handleBlockFromPeer),
+		// so we don't block here waiting on peer consensus. This block will simply fail validation below.
 
-		// The else is only for tests. By default, only the success case will run.
-		if len(alternativePeerConsensusFunction) == 0 {
-			// We'll run peer consensus to get the missing block.
-			l.GetPeerConsensus()
-		} else {
+		// This is only for tests.
+		if len(alternativePeerConsensusFunction) != 0 {
 			// Run the alternative peer consensus function
 			alternativePeerConsensusFunction[0]()
 		}
 	}
 
-	// Create a copy of the chain with the new block
-	tempChain := append(l.Chain, block)
+	added, err := l.addMinedBlockToChain(block)
+	if err != nil {
+		log.Errorf("We couldn't check the signatures in a block. It was not added. [error: %s]", err)
+	}
 
-	// Check if that block is valid
-	isValid, newUTXO := ValidateBlock(len(tempChain)-1, tempChain, l.UTXO, l.ValidationServerURL)
+	return added
+}
 
-	if isValid {
-		// Clear Mempool of confirmed transactions (transactions that are now in this block)
-		l.MemPool = RemoveConfirmedTransactions(l.MemPool, block.Transactions)
+// Adds a new block to the chain (see AddMinedBlockToChain).
+// It returns an error if the validation server couldn't tell us whether its signatures are valid (which isn't the fault of whoever made it).
+func (l *LocalNode) addMinedBlockToChain(block Block) (bool, error) {
+	// Check the block against a snapshot of our chain, so we don't hold our state while the validation server checks its signatures
+	state, chainMinted := l.mintedSnapshot()
 
-		// Update UTXO
-		l.UTXO = newUTXO
+	// Create a copy of the chain with the new block (that can't write into the snapshot's chain)
+	tempChain := append(state.Chain[:len(state.Chain):len(state.Chain)], block)
 
-		// Update chain
-		l.Chain = tempChain
+	// Check if that block is valid (with a copy of our UTXO, so an invalid block can't change it)
+	isValid, newUTXO, minted, err := validateBlock(len(tempChain)-1, tempChain, state.UTXO.copy(), chainMinted, l.ValidationServerURL)
+	if !isValid {
+		return false, err
+	}
 
-		return true
-	} else {
-		return false
+	// Our chain might have changed while we were checking the block, in which case it doesn't build on our chain anymore
+	if !l.addValidatedBlock(tempChain, newUTXO, minted) {
+		return false, nil
 	}
+
+	// Cancel mining processes, as the block they were mining doesn't build on our chain anymore
+	l.cancelMining()
+
+	l.events.publish(tipChanged)
+
+	return true, nil
+}
+
+// A chain sent to us by a peer for consensus.
+type peerChain struct {
+	blocks []Block
+	from   *noise.ID // The peer that sent it (nil if it didn't come from a peer)
 }
 
 // Takes a slice of chains and finds the longest, valid chain and sets our chain to that chain.
@@ -84,34 +156,62 @@ func (l *LocalNode) AddMinedBlockToChain(block Block, alternativePeerConsensusFu
 //  - It removes the transactions inside the chain's blocks from the MemPool
 //  - It updates the UTXO
 func (l *LocalNode) Consensus(chains ...[]Block) bool {
+	peerChains := make([]peerChain, len(chains))
+	for i, chain := range chains {
+		peerChains[i] = peerChain{blocks: chain}
+	}
+
+	return l.consensus(peerChains)
+}
+
+// Runs consensus on chains from our peers (see Consensus). Peers that sent us an invalid (like a tampered) chain are penalized.
+func (l *LocalNode) consensus(chains []peerChain) bool {
 	// Sort the changes by longest first
 	sort.Slice(chains, func(index1, index2 int) bool {
-		return len(chains[index1]) > len(chains[index2])
+		return len(chains[index1].blocks) > len(chains[index2].blocks)
 	})
 
-	for _, chain := range chains {
+	// Chains are checked against our genesis block, which is only GenesisBlock if we aren't a test node (see validateBlock)
+	var useMainGenesisBlock []bool
+	if reflect.DeepEqual(l.Snapshot().Chain[0], GenesisBlock) {
+		useMainGenesisBlock = []bool{true}
+	}
+
+	for _, peerChain := range chains {
+		chain := peerChain.blocks
+
 		// If the chain is smaller than our current chain, our chain was the longest, so stop.
-		if len(chain) < len(l.Chain) {
+		if len(chain) < len(l.Snapshot().Chain) {
 			log.Info("Our chain is longest, so our consensus function terminated.")
 			return false
 		}
 
-		if valid, utxo := ValidateChain(chain, l.ValidationServerURL); valid == true {
-			l.Chain = chain
-			l.UTXO = utxo
+		valid, utxo, minted, err := validateChain(chain, l.ValidationServerURL, useMainGenesisBlock...)
+		if err != nil {
+			log.Errorf("We couldn't check the signatures in a chain. Skipping it... [error: %s]", err)
+			continue
+		}
 
-			// Clear the MemPool of any confirmed transactions
-			for _, block := range chain {
-				l.MemPool = RemoveConfirmedTransactions(l.MemPool, block.Transactions)
+		if valid == true {
+			// Switch to the chain (and clear it out of the MemPool), unless our chain grew while we were validating it
+			if !l.switchChain(chain, utxo, minted) {
+				log.Info("Our chain is longest, so our consensus function terminated.")
+				return false
 			}
 
-			// Cancel mining
-			l.IsMining = false
+			l.events.publish(tipChanged)
+
+			// The orphans we were holding on to from this chain aren't orphans anymore
+			l.orphans.removeInChain(chain)
 
 			// We found a longer, valid chain.
 			log.Info("We found a valid chain through our consensus function!")
 			return true
 		}
+
+		if peerChain.from != nil {
+			l.penalizePeer(*peerChain.from, penaltyInvalidChain, "sent us an invalid chain")
+		}
 	}
 
 	// No chain was valid or chosen.
@@ -119,86 +219,157 @@ func (l *LocalNode) Consensus(chains ...[]Block) bool {
 	return false
 }
 
+// Removes transactions that have been in the MemPool for longer than maxAge (they are probably never going to be valid).
+// Locked transactions are kept while they are locked (which is bounded, see unlocksWithinHorizon), and their age is counted from when they unlocked.
+func (l *LocalNode) RemoveStaleTransactions(maxAge time.Duration) {
+	l.state.Lock()
+	defer l.state.Unlock()
+
+	// Save all young transactions and filter out stale transactions (into a new MemPool, as snapshots of the old one may be in use).
+	memPool := make([]Transaction, 0, len(l.MemPool))
+	for _, transaction := range l.MemPool {
+		if unlockTime, unlocked := transaction.unlockTime(l.Chain); !unlocked || time.Now().Sub(time.Unix(unlockTime, 0)) < maxAge {
+			memPool = append(memPool, transaction)
+		} else {
+			log.Warnf("Removing a stale transaction from the MemPool.... (%+v)", transaction)
+		}
+	}
+	l.MemPool = memPool
+}
+
 // Finds a valid proof for a block and validates transactions from the MemPool. It removes invalid transactions.
 // It returns a pointer to a new block that will be nil if the mining process was canceled.
 // It does not add this block to the chain itself.
-func (l LocalNode) MineBlock(shouldMine *bool) *Block {
+// Mining is canceled when a block is added to our chain, or our chain is replaced (see cancelMining).
+func (l *LocalNode) MineBlock() *Block {
 	// Ensure that we are mining
-	*shouldMine = true
+	atomic.StoreInt32(&l.mining, 1)
 
-	// Make copy of UTXO
-	newUTXO := make(UTXO)
-	for k, v := range l.UTXO {
-		newUTXO[k] = v
+	template := l.NewBlockTemplate()
+
+	// Don't mine if there's only one transaction (the coinbase transaction)
+	if template == nil {
+		log.Warn("There was only one transaction (the coinbase transaction) in a block we started mining. Canceling...")
+		l.cancelMining()
+		return nil
+	}
+
+	// Cancel mining if we are having this mine terminated
+	return template.Mine(func() bool { return !l.IsMining() })
+}
+
+// Creates a template for the next block in our chain from the valid transactions in the MemPool (sorted by timestamp),
+// with a coinbase transaction that pays this node's OperatorPublicKey.
+// It returns nil if there are no valid transactions to put in a block.
+func (l *LocalNode) NewBlockTemplate() *BlockTemplate {
+	return l.newBlockTemplate(l.Snapshot())
+}
+
+// Creates a template for the block after a snapshot of our chain from the snapshot's MemPool (see NewBlockTemplate).
+func (l *LocalNode) newBlockTemplate(state NodeState) *BlockTemplate {
+	// Make copy of UTXO (with the coinbase rewards that mature in the new block)
+	newUTXO := state.UTXO.copy()
+	if !newUTXO.mature(len(state.Chain), state.Chain) {
+		log.Warn("Coinbase rewards that mature in the next block would overflow a balance, so no block can be made!")
+		return nil
 	}
 
 	// Create a copy of the MemPool
-	memPool := make([]Transaction, len(l.MemPool))
-	copy(memPool, l.MemPool)
+	memPool := make([]Transaction, len(state.MemPool))
+	copy(memPool, state.MemPool)
 
 	// Sort the MemPool by each transaction's timestamp
 	sort.Slice(memPool, func(index1, index2 int) bool {
 		return memPool[index1].Timestamp < memPool[index2].Timestamp
 	})
 
+	// Our clock might be behind the rest of the network, but our block can't be before the median of the last blocks
+	timestamp := maxInt64(time.Now().Unix(), medianTimePast(state.Chain, len(state.Chain)))
+
 	// Create a newTransactions slice and prepend a "coinbase" transaction that mints the correct amount of coins to the miner (this node's public key)
-	newTransactions := []Transaction{{"0", l.OperatorPublicKey, coinbaseReward, time.Now().Unix(), ""}}
+	newTransactions := []Transaction{{Sender: "0", Recipient: l.OperatorPublicKey, Amount: coinbaseReward, Timestamp: timestamp, Signature: ""}}
 
 	// Add all valid memPool transactions to the newTransactions slice
 	for _, transaction := range memPool {
+		// Skip transactions that are still locked (they stay in the MemPool until they unlock)
+		if !transaction.IsFinal(len(state.Chain), timestamp) {
+			continue
+		}
+
 		// If the transaction is valid
 		if ValidateTransaction(transaction, newUTXO, l.ValidationServerURL) {
-			// Update the balances of both parties
-			newUTXO[transaction.Sender] -= transaction.Amount
-			newUTXO[transaction.Recipient] += transaction.Amount
+			// Update the balances of both parties (or spend and pay the outputs, or make every payment of a batch).
+			// If that would overflow a balance, newUTXO may have been partly changed, so stop adding transactions.
+			if !newUTXO.applyTransaction(transaction) {
+				break
+			}
+
 			// Add transaction to block's newTransactions
 			newTransactions = append(newTransactions, transaction)
 		}
 	}
 
-	// Don't mine if there's only one transaction (the coinbase transaction)
+	// There's only one transaction (the coinbase transaction)
 	if len(newTransactions) == 1 {
-		log.Warn("There was only one transaction (the coinbase transaction) in a block we started mining. Canceling...")
-		*shouldMine = false
 		return nil
 	}
 
-	blockHeader := BlockHeader{time.Now().Unix(), newTransactions, LastBlock(l.Chain).hash()}
+	return &BlockTemplate{
+		BlockHeader:         BlockHeader{timestamp, newTransactions, LastBlock(state.Chain).hash()},
+		DifficultyThreshold: DetermineDifficultyForChainIndex(state.Chain, len(state.Chain)),
+	}
+}
 
+// Searches for a nonce that gives a block template a valid proof. It checks shouldStop between nonces,
+// and returns nil if it told us to stop before we found a proof.
+func (t BlockTemplate) Mine(shouldStop func() bool) *Block {
 	// Create a proof with the appropriate difficulty
-	proof := Proof{Nonce: 0, DifficultyThreshold: DetermineDifficultyForChainIndex(l.Chain, len(l.Chain))}
+	proof := Proof{Nonce: 0, DifficultyThreshold: t.DifficultyThreshold}
 
 	// Keep incrementing the nonce until we have a valid proof
-	for !ValidateProof(Block{blockHeader, proof}) {
-		// Cancel mining if we are having this mine terminated
-		if *shouldMine == false {
+	for !ValidateProof(Block{t.BlockHeader, proof}) {
+		if shouldStop() {
 			return nil
 		}
 		proof.Nonce += 1
 	}
 
 	// We found a valid block!
-	return &Block{blockHeader, proof}
+	return &Block{t.BlockHeader, proof}
 }
 
 // Runs the ValidateBlock function on each block in the chain (except the genesis block), and checks that the genesis block has not changed.
 // It returns whether the chain is valid and an updated UTXO (or nil if not valid).
+// If the validation server can't be reached, the chain is treated as invalid.
 func ValidateChain(blocks []Block, validationServerURL string) (bool, UTXO) {
+	valid, utxo, _, err := validateChain(blocks, validationServerURL)
+	if err != nil {
+		log.Error(err)
+	}
+
+	return valid, utxo
+}
+
+// Validates a chain (see ValidateChain), keeping a running count of the coins it has minted so each block only adds its own reward.
+// It also returns how many coins the chain minted, and an error if the validation server couldn't tell us whether its signatures are valid.
+func validateChain(blocks []Block, validationServerURL string, shouldUseAltGenesisBlock ...bool) (bool, UTXO, uint64, error) {
 	utxo := make(UTXO)
+	var minted uint64
 
 	// Iterate over all blocks and check if they are valid (and update UTXO)
 	for index, _ := range blocks {
 
-		valid, newUTXO := ValidateBlock(index, blocks, utxo, validationServerURL)
+		valid, newUTXO, newMinted, err := validateBlock(index, blocks, utxo, minted, validationServerURL, shouldUseAltGenesisBlock...)
 
 		if !valid {
-			return false, nil
+			return false, nil, 0, err
 		} else {
 			utxo = newUTXO
+			minted = newMinted
 		}
 	}
 
-	return true, utxo
+	return true, utxo, minted, nil
 }
 
 // ValidateBlock takes the index of a block, the full Blockchain, a UTXO of the Blockchain up to that point, and a validationServerURL.
@@ -206,12 +377,36 @@ func ValidateChain(blocks []Block, validationServerURL string) (bool, UTXO) {
 // Does these checks to ensure the chain is valid:
 //  - Check that previous hashes are valid
 //  - Check that users have enough UTXO to afford transactions
+//  - Check that coinbase rewards aren't spent before they mature
+//  - Check that unspent outputs aren't spent twice
 //  - Check that proofs are valid
 //  - Check that there are not more than one coinbase transaction in each block
 //  - Check that signatures are valid
 //  - Check that difficulty threshold is valid
 //  - Check that there are not duplicate transactions in the block that appear earlier in the chain
+//  - Check that transactions aren't locked until a later height or time
+//  - Check that the timestamp isn't before the median of the last 11 blocks or too far in the future
+//  - Check that no balance overflows (and that the coins minted so far fit in a uint64)
+// If the validation server can't be reached, the block is treated as invalid.
 func ValidateBlock(blockIndex int, blocks []Block, utxo UTXO, validationServerURL string, shouldUseAltGenesisBlock ...bool) (bool, UTXO) {
+	// Count the coins minted before this block (so its reward can be checked)
+	minted, ok := mintedCoins(blocks[:blockIndex])
+	if !ok {
+		return false, nil
+	}
+
+	valid, newUTXO, _, err := validateBlock(blockIndex, blocks, utxo, minted, validationServerURL, shouldUseAltGenesisBlock...)
+	if err != nil {
+		log.Error(err)
+	}
+
+	return valid, newUTXO
+}
+
+// Validates the block at an index (see ValidateBlock), given how many coins the blocks before it minted.
+// It also returns how many coins the chain up to and including the block minted, and an error if the validation server
+// couldn't tell us whether the signatures in the block are valid (which isn't the fault of whoever gave us the block).
+func validateBlock(blockIndex int, blocks []Block, utxo UTXO, minted uint64, validationServerURL string, shouldUseAltGenesisBlock ...bool) (bool, UTXO, uint64, error) {
 	block := blocks[blockIndex]
 
 	// If the block is the genesis block:
@@ -227,68 +422,141 @@ func ValidateBlock(blockIndex int, blocks []Block, utxo UTXO, validationServerUR
 		if reflect.DeepEqual(block, genesisBlock) {
 			genesisTransaction := block.Transactions[0]
 
-			utxo[genesisTransaction.Recipient] += genesisTransaction.Amount
+			utxo.credit(genesisTransaction.Recipient, genesisTransaction.Amount)
 
-			return true, utxo
+			return true, utxo, genesisTransaction.Amount, nil
 		} else {
 			// The genesis block has been tampered with! This is an invalid block!
-			return false, nil
+			return false, nil, 0, nil
 		}
 	}
 
-	// Invalid if there's only one transaction (the coinbase transaction)
-	if len(block.Transactions) == 1 {
-		return false, nil
+	// Invalid if there's only one transaction (the coinbase transaction), or no transactions at all
+	if len(block.Transactions) <= 1 {
+		return false, nil, 0, nil
 	}
 
 	// Check that difficulty threshold is valid
 	if block.Proof.DifficultyThreshold != DetermineDifficultyForChainIndex(blocks, blockIndex) {
-		return false, nil
+		return false, nil, 0, nil
 	}
 
 	lastBlock := blocks[blockIndex-1]
 
 	// Check previous hash is valid and that proof is valid
 	if block.PreviousHash != lastBlock.hash() || !ValidateProof(block) {
-		return false, nil
+		return false, nil, 0, nil
+	}
+
+	// Check the timestamp (which time locks are checked against) is plausible
+	if !hasValidTimestamp(blocks, blockIndex, time.Now()) {
+		return false, nil, 0, nil
+	}
+
+	// Check the transactions in it are valid (and update the UTXO with them)
+	minted, ok, err := validateBlockTransactions(blockIndex, blocks, utxo, minted, validationServerURL)
+	if !ok {
+		return false, nil, 0, err
+	}
+
+	return true, utxo, minted, nil
+}
+
+// Checks that the transactions in the block at an index are valid, and updates a UTXO of the chain up to that block with them
+// (the UTXO may have been partly updated if they aren't valid). It doesn't check the block's proof or previous hash (see ValidateBlock).
+// minted is how many coins the blocks before it minted, and it returns how many coins the chain up to and including the block minted.
+// It returns an error if the validation server couldn't tell us whether the signatures in the block are valid.
+func validateBlockTransactions(blockIndex int, blocks []Block, utxo UTXO, minted uint64, validationServerURL string) (uint64, bool, error) {
+	block := blocks[blockIndex]
+
+	// Coinbase rewards that mature in this block can be spent in it
+	if !utxo.mature(blockIndex, blocks) {
+		return 0, false, nil
 	}
 
 	// Check the transactions in it are valid
 	for transactionIndex, transaction := range block.Transactions {
 		// If the transaction is a coinbase transaction (the first transaction):
 		if transactionIndex == 0 {
-			// If this is a VALID coinbase transaction
-			if transaction.Sender == "0" && transaction.Amount == coinbaseReward {
-				// Add coins to the recipient without taking from the sender (as this is a coinbase transaction)
-				utxo[transaction.Recipient] += transaction.Amount
+			// If this is a VALID coinbase transaction (paying a recipient who can spend it)
+			if transaction.Sender == "0" && transaction.Amount == coinbaseReward && (blockIndex < coinbaseRecipientHeight || IsValidRecipient(transaction.Recipient)) {
+				// Check that the coins minted so far (including this reward) aren't too many for a uint64, so no balance can overflow
+				var ok bool
+				if minted, ok = addAmounts(minted, transaction.Amount); !ok {
+					return 0, false, nil
+				}
+
+				// Add coins to the recipient without taking from the sender (as this is a coinbase transaction).
+				// They can't be spent until they mature.
+				if !utxo.creditCoinbase(transaction.Recipient, transaction.Amount, blockIndex) {
+					return 0, false, nil
+				}
 			} else {
-				return false, nil
+				return 0, false, nil
 			}
 
 			// Skip other validation
 			continue
 		}
 
+		// Check that the transaction isn't locked until after this block
+		if !transaction.IsFinal(blockIndex, block.Timestamp) {
+			return 0, false, nil
+		}
+
 		// If the transaction is valid
-		if ValidateTransaction(transaction, utxo, validationServerURL) {
-			// Update the balances of both parties
-			utxo[transaction.Sender] -= transaction.Amount
-			utxo[transaction.Recipient] += transaction.Amount
+		if valid, err := validateTransaction(transaction, utxo, validationServerURL); valid {
+			// Update the balances of both parties (or spend and pay the outputs, so they can't be spent again, or make every payment of a batch).
+			// Blocks that would overflow a balance are invalid.
+			if !utxo.applyTransaction(transaction) {
+				return 0, false, nil
+			}
 		} else {
-			return false, nil
+			return 0, false, err
 		}
 
 		// Check that the transaction hasn't been made previously
 		if IsTransactionInChain(transaction, blocks[:blockIndex]) {
-			return false, nil
+			return 0, false, nil
 		}
 
 	}
 
-	return true, utxo
+	return minted, true, nil
 }
 
-// Checks if a transaction is a positive number, the sender has enough coins the make the transaction, and that the signature is valid.
+// Checks if a transaction is a positive number, the recipient is a valid address or public key, the sender has enough coins the make the transaction
+// (coinbase rewards don't count until they mature), and that the signature is valid (or that enough of a multisig sender's keys signed it).
+// If the validation server can't be reached, the transaction is treated as invalid.
 func ValidateTransaction(transaction Transaction, utxo UTXO, validationServerURL string) bool {
-	return transaction.Amount > 0 && transaction.Amount <= utxo[transaction.Sender] && ValidateSignature(transaction, validationServerURL)
+	valid, err := validateTransaction(transaction, utxo, validationServerURL)
+	if err != nil {
+		log.Error(err)
+	}
+
+	return valid
+}
+
+// Validates a transaction (see ValidateTransaction). It returns an error if the validation server couldn't tell us whether its signatures are valid.
+func validateTransaction(transaction Transaction, utxo UTXO, validationServerURL string) (bool, error) {
+	var valid bool
+
+	switch {
+	// Output-based transactions spend their inputs instead (see validateOutputs)
+	case transaction.isOutputBased():
+		valid = validateOutputs(transaction, utxo)
+
+	// Batch transactions make all their payments or none of them (see validateBatch)
+	case transaction.isBatch():
+		valid = validateBatch(transaction, utxo)
+
+	default:
+		valid = transaction.Amount > 0 && IsValidRecipient(transaction.Recipient) && transaction.Amount <= utxo.Balance(transaction.Sender)
+	}
+
+	if !valid {
+		return false, nil
+	}
+
+	return validateTransactionSignatures(transaction, validationServerURL)
 }
@@ -2,7 +2,9 @@ package core
 
 import (
 	"github.com/stretchr/testify/assert"
+	"sync/atomic"
 	"testing"
+	"time"
 )
 
 var validationServer = "https://crows.sh/verifySignature"
@@ -51,7 +53,7 @@ func TestLocalNode_AddTransactionToMemPool(t *testing.T) {
 
 func TestLocalNode_AddMinedBlockToChain(t *testing.T) {
 	localNode := LocalNode{Chain: []Block{testGenesisBlock}, MemPool: make([]Transaction, 0), UTXO: make(UTXO), ValidationServerURL: validationServer, OperatorPublicKey: "0", MinimumChainsForConsensus: 1}
-	localNode.IsMining = true
+	atomic.StoreInt32(&localNode.mining, 1)
 	newTransactions := []Transaction{Transaction{Sender: "0", Recipient: "0458adabe2c014de6c3fd2f2c865c2ca7fe823a4131a4d22f98dcc77f1bffc8aeacf8a0b7949321c33214e9c1b2201063404a321110be8223ad1685ee32c9c02d0", Amount: 1000, Timestamp: 0, Signature: ""}, Transaction{Sender: "0458adabe2c014de6c3fd2f2c865c2ca7fe823a4131a4d22f98dcc77f1bffc8aeacf8a0b7949321c33214e9c1b2201063404a321110be8223ad1685ee32c9c02d0", Recipient: "0436c6797970ef164ecb4c279c32e25b866af78fece9cacc3cc94789b5a2ca6229fe21905d734100236fe5520696d8df70d64fdaef606e6880a424c957ae3f9cb6", Amount: 20, Timestamp: 1586469742, Signature: "304502201d7519147c9d1f8f2b916683afac3d190ab50688a5c12dd016554a1386f5975c022100ef3938bb6d4d3e6237462b045edcfcc9ef64e9e9f39b869e4ed477ae0d3330e5"}}
 	localNode.MemPool = newTransactions
 	newBlock := Block{BlockHeader: BlockHeader{Timestamp: 1586119312, Transactions: newTransactions, PreviousHash: testGenesisBlock.hash()}, Proof: Proof{Nonce: 2119721, DifficultyThreshold: 5}}
@@ -60,7 +62,7 @@ func TestLocalNode_AddMinedBlockToChain(t *testing.T) {
 	assert.True(t, localNode.AddMinedBlockToChain(newBlock, func() {}))
 
 	// Check that mining has been canceled
-	assert.False(t, localNode.IsMining)
+	assert.False(t, localNode.IsMining())
 
 	// Check chain has been updated
 	assert.Contains(t, localNode.Chain, newBlock)
@@ -89,11 +91,11 @@ func TestLocalNode_Consensus(t *testing.T) {
 	shortestChain := []Block{Block{BlockHeader: BlockHeader{Timestamp: 1585852979, Transactions: []Transaction{Transaction{Sender: "0", Recipient: "0458adabe2c014de6c3fd2f2c865c2ca7fe823a4131a4d22f98dcc77f1bffc8aeacf8a0b7949321c33214e9c1b2201063404a321110be8223ad1685ee32c9c02d0", Amount: 100000000000000, Timestamp: 1585852961, Signature: ""}}, PreviousHash: ""}, Proof: Proof{Nonce: 0, DifficultyThreshold: 0}}, Block{BlockHeader: BlockHeader{Timestamp: 1586119312, Transactions: []Transaction{Transaction{Sender: "0", Recipient: "0458adabe2c014de6c3fd2f2c865c2ca7fe823a4131a4d22f98dcc77f1bffc8aeacf8a0b7949321c33214e9c1b2201063404a321110be8223ad1685ee32c9c02d0", Amount: 1000, Timestamp: 0, Signature: ""}, Transaction{Sender: "0458adabe2c014de6c3fd2f2c865c2ca7fe823a4131a4d22f98dcc77f1bffc8aeacf8a0b7949321c33214e9c1b2201063404a321110be8223ad1685ee32c9c02d0", Recipient: "046007e213c57ccab18af3f3b385893da75514ab691216152955d70937744dbe040de0ea504ebe29bce2476ae37c794cf5e7d96c8bc2ad153eb434b148f1af6f6c", Amount: 15, Timestamp: 1586117966, Signature: "3046022100d158259aae3c7c9e3e6cd33a3b47134723ddc4cae25484e8a5df28f45ee462fd022100b6c6600f89a3ef050a8aab14c8a96ca5b5b9c8fa358945c9f53dda1b488dd43c"}}, PreviousHash: "a5b4f08485f4580e2358a50f495cdd4c4e4e383bebff1544cf99245770352d60"}, Proof: Proof{Nonce: 1777869, DifficultyThreshold: 5}}, Block{BlockHeader: BlockHeader{Timestamp: 1586119372, Transactions: []Transaction{Transaction{Sender: "0", Recipient: "0458adabe2c014de6c3fd2f2c865c2ca7fe823a4131a4d22f98dcc77f1bffc8aeacf8a0b7949321c33214e9c1b2201063404a321110be8223ad1685ee32c9c02d0", Amount: 1000, Timestamp: 0, Signature: ""}, Transaction{Sender: "0458adabe2c014de6c3fd2f2c865c2ca7fe823a4131a4d22f98dcc77f1bffc8aeacf8a0b7949321c33214e9c1b2201063404a321110be8223ad1685ee32c9c02d0", Recipient: "046007e213c57ccab18af3f3b385893da75514ab691216152955d70937744dbe040de0ea504ebe29bce2476ae37c794cf5e7d96c8bc2ad153eb434b148f1af6f6c", Amount: 15, Timestamp: 1586119287, Signature: "3046022100e832f48b330701fe1cfc53946d42b6ba4465383511b0fa24ebdf6141035a7184022100afaffd679dbc17d8ecd33c1b5a95bfff56ec8e08c471a05446eb6bbe81da0e48"}}, PreviousHash: "d7d142a5bcf2513fcd639438920f46ee62f53954d8a3530c6d193312fee76688"}, Proof: Proof{Nonce: 199169, DifficultyThreshold: 5}}, Block{BlockHeader: BlockHeader{Timestamp: 1586119432, Transactions: []Transaction{Transaction{Sender: "0", Recipient: "0458adabe2c014de6c3fd2f2c865c2ca7fe823a4131a4d22f98dcc77f1bffc8aeacf8a0b7949321c33214e9c1b2201063404a321110be8223ad1685ee32c9c02d0", Amount: 1000, Timestamp: 0, Signature: ""}, Transaction{Sender: "0458adabe2c014de6c3fd2f2c865c2ca7fe823a4131a4d22f98dcc77f1bffc8aeacf8a0b7949321c33214e9c1b2201063404a321110be8223ad1685ee32c9c02d0", Recipient: "046007e213c57ccab18af3f3b385893da75514ab691216152955d70937744dbe040de0ea504ebe29bce2476ae37c794cf5e7d96c8bc2ad153eb434b148f1af6f6c", Amount: 15, Timestamp: 1586119336, Signature: "304502200acf2f6eb3169b6d4d7ca28a55cbb64ef91ac2e55943c0f0b55d67a151baf097022100eab71b2f289e8feedd1899d8a65f7f1190073133fa7cdc728209fa8615bce286"}}, PreviousHash: "2f9a66a3361b628ef3f9bd6ce657375eea370cb41428eb5ae7c530c37c935456"}, Proof: Proof{Nonce: 1531439, DifficultyThreshold: 5}}, Block{BlockHeader: BlockHeader{Timestamp: 1586119492, Transactions: []Transaction{Transaction{Sender: "0", Recipient: "0458adabe2c014de6c3fd2f2c865c2ca7fe823a4131a4d22f98dcc77f1bffc8aeacf8a0b7949321c33214e9c1b2201063404a321110be8223ad1685ee32c9c02d0", Amount: 1000, Timestamp: 0, Signature: ""}, Transaction{Sender: "0458adabe2c014de6c3fd2f2c865c2ca7fe823a4131a4d22f98dcc77f1bffc8aeacf8a0b7949321c33214e9c1b2201063404a321110be8223ad1685ee32c9c02d0", Recipient: "046007e213c57ccab18af3f3b385893da75514ab691216152955d70937744dbe040de0ea504ebe29bce2476ae37c794cf5e7d96c8bc2ad153eb434b148f1af6f6c", Amount: 16, Timestamp: 1586119430, Signature: "30440220668995bb74c17b0a9da0772f7f21c4a36ebe5739ae2eeda385bb2ca891a79e5402203090f57536eec6a5dd6cf3e3629b9738c38cafea71195b021c4ddeba49454396"}}, PreviousHash: "a8b6009a30eceaef14e042a3b407d4f9ee7eced6afa57291ff02ad0575d31f03"}, Proof: Proof{Nonce: 4573631, DifficultyThreshold: 5}}, Block{BlockHeader: BlockHeader{Timestamp: 1586119552, Transactions: []Transaction{Transaction{Sender: "0", Recipient: "0458adabe2c014de6c3fd2f2c865c2ca7fe823a4131a4d22f98dcc77f1bffc8aeacf8a0b7949321c33214e9c1b2201063404a321110be8223ad1685ee32c9c02d0", Amount: 1000, Timestamp: 0, Signature: ""}, Transaction{Sender: "0458adabe2c014de6c3fd2f2c865c2ca7fe823a4131a4d22f98dcc77f1bffc8aeacf8a0b7949321c33214e9c1b2201063404a321110be8223ad1685ee32c9c02d0", Recipient: "046007e213c57ccab18af3f3b385893da75514ab691216152955d70937744dbe040de0ea504ebe29bce2476ae37c794cf5e7d96c8bc2ad153eb434b148f1af6f6c", Amount: 17, Timestamp: 1586119465, Signature: "3046022100dfaa90118a615bd164f7ce5bbad595b13c89e0913328c69f60237c4f7c4f1dc80221009d1f1e5c5cbfd4305780549f4d09a7aff6e81b4d8a6faf499e3789a7bf183e8a"}}, PreviousHash: "1b0ebdcd3eb6ee8fcf4baabc512ae79ab4dc3ca461822f251f70c235bcf2d65c"}, Proof: Proof{Nonce: 603227, DifficultyThreshold: 5}}, Block{BlockHeader: BlockHeader{Timestamp: 1586119612, Transactions: []Transaction{Transaction{Sender: "0", Recipient: "0458adabe2c014de6c3fd2f2c865c2ca7fe823a4131a4d22f98dcc77f1bffc8aeacf8a0b7949321c33214e9c1b2201063404a321110be8223ad1685ee32c9c02d0", Amount: 1000, Timestamp: 0, Signature: ""}, Transaction{Sender: "0458adabe2c014de6c3fd2f2c865c2ca7fe823a4131a4d22f98dcc77f1bffc8aeacf8a0b7949321c33214e9c1b2201063404a321110be8223ad1685ee32c9c02d0", Recipient: "046007e213c57ccab18af3f3b385893da75514ab691216152955d70937744dbe040de0ea504ebe29bce2476ae37c794cf5e7d96c8bc2ad153eb434b148f1af6f6c", Amount: 17, Timestamp: 1586119543, Signature: "304502205eb70b3490b02690f14e46bdabf284030e6208cf64104433f9256960ceffbe09022100e5647081dd948589a736f65e7f94a394ecdc0ca3cd2a0549f93327084df9cb7e"}}, PreviousHash: "0c5fb0e4634d1be9b18c872c34bc6fe6d5abd1d7892c393a574a9f7cd2d5f65f"}, Proof: Proof{Nonce: 2223280, DifficultyThreshold: 5}}}
 
 	localNode := LocalNode{Chain: []Block{testGenesisBlock}, MemPool: make([]Transaction, 0), UTXO: make(UTXO), ValidationServerURL: validationServer, OperatorPublicKey: "0", MinimumChainsForConsensus: 1}
-	localNode.IsMining = true
+	atomic.StoreInt32(&localNode.mining, 1)
 	localNode.Consensus(longestChain, secondLongestChain, shortestChain)
 
 	assert.Equal(t, longestChain, localNode.Chain)
-	assert.False(t, localNode.IsMining)
+	assert.False(t, localNode.IsMining())
 
 	// Try to run consensus where our current chain is the longest
 	assert.False(t, localNode.Consensus([]Block{}))
@@ -103,13 +105,27 @@ func TestLocalNode_Consensus(t *testing.T) {
 	assert.False(t, localNode.Consensus())
 }
 
+func TestLocalNode_AddMinedBlockToChain_CancelsMiningOnceAdded(t *testing.T) {
+	fakeValidationServer := newFakeValidationServer(true)
+	defer fakeValidationServer.Close()
+
+	localNode := newTestMinerNode(fakeValidationServer.URL)
+	atomic.StoreInt32(&localNode.mining, 1)
+
+	// A block that isn't added doesn't stop us mining
+	assert.False(t, localNode.AddMinedBlockToChain(harnessBlock2))
+	assert.True(t, localNode.IsMining())
+
+	assert.True(t, localNode.AddMinedBlockToChain(harnessBlock1))
+	assert.False(t, localNode.IsMining())
+}
+
 func TestLocalNode_MineBlock(t *testing.T) {
 	localNode := LocalNode{Chain: []Block{testGenesisBlock}, MemPool: make([]Transaction, 0), UTXO: make(UTXO), ValidationServerURL: validationServer, OperatorPublicKey: "0", MinimumChainsForConsensus: 1}
 
-	localNode.UTXO["0458adabe2c014de6c3fd2f2c865c2ca7fe823a4131a4d22f98dcc77f1bffc8aeacf8a0b7949321c33214e9c1b2201063404a321110be8223ad1685ee32c9c02d0"] = 100000000000000
+	localNode.UTXO["0458adabe2c014de6c3fd2f2c865c2ca7fe823a4131a4d22f98dcc77f1bffc8aeacf8a0b7949321c33214e9c1b2201063404a321110be8223ad1685ee32c9c02d0"] = Funds{Spendable: 100000000000000}
 	localNode.MemPool = []Transaction{Transaction{Sender: "0458adabe2c014de6c3fd2f2c865c2ca7fe823a4131a4d22f98dcc77f1bffc8aeacf8a0b7949321c33214e9c1b2201063404a321110be8223ad1685ee32c9c02d0", Recipient: "046007e213c57ccab18af3f3b385893da75514ab691216152955d70937744dbe040de0ea504ebe29bce2476ae37c794cf5e7d96c8bc2ad153eb434b148f1af6f6c", Amount: 15, Timestamp: 1586117966, Signature: "3046022100d158259aae3c7c9e3e6cd33a3b47134723ddc4cae25484e8a5df28f45ee462fd022100b6c6600f89a3ef050a8aab14c8a96ca5b5b9c8fa358945c9f53dda1b488dd43c"}}
-	localNode.IsMining = true
-	outputBlock := localNode.MineBlock(&localNode.IsMining)
+	outputBlock := localNode.MineBlock()
 
 	// Check that we got a new block
 	assert.NotNil(t, outputBlock)
@@ -126,22 +142,24 @@ func TestLocalNode_MineBlock(t *testing.T) {
 	// Invalid Transactions Don't Make It Into Blocks (Stay in MemPool)
 	invalidTransaction := Transaction{Sender: "NOTREALPERSON", Recipient: "OTHERNOTREALPERSON", Amount: 999999, Timestamp: 1586117966, Signature: "wrong signature"}
 	localNode.MemPool = []Transaction{invalidTransaction, invalidTransaction}
-	localNode.IsMining = true
-	outputBlock2 := localNode.MineBlock(&localNode.IsMining)
+	outputBlock2 := localNode.MineBlock()
 	assert.Nil(t, outputBlock2)
-	assert.False(t, localNode.IsMining)
+	assert.False(t, localNode.IsMining())
 	assert.Contains(t, localNode.MemPool, invalidTransaction)
 
 	// Cancel Mining
-	localNode.UTXO["0458adabe2c014de6c3fd2f2c865c2ca7fe823a4131a4d22f98dcc77f1bffc8aeacf8a0b7949321c33214e9c1b2201063404a321110be8223ad1685ee32c9c02d0"] = 100000000000000
+	localNode.UTXO["0458adabe2c014de6c3fd2f2c865c2ca7fe823a4131a4d22f98dcc77f1bffc8aeacf8a0b7949321c33214e9c1b2201063404a321110be8223ad1685ee32c9c02d0"] = Funds{Spendable: 100000000000000}
 	localNode.MemPool = []Transaction{Transaction{Sender: "0458adabe2c014de6c3fd2f2c865c2ca7fe823a4131a4d22f98dcc77f1bffc8aeacf8a0b7949321c33214e9c1b2201063404a321110be8223ad1685ee32c9c02d0", Recipient: "046007e213c57ccab18af3f3b385893da75514ab691216152955d70937744dbe040de0ea504ebe29bce2476ae37c794cf5e7d96c8bc2ad153eb434b148f1af6f6c", Amount: 15, Timestamp: 1586117966, Signature: "3046022100d158259aae3c7c9e3e6cd33a3b47134723ddc4cae25484e8a5df28f45ee462fd022100b6c6600f89a3ef050a8aab14c8a96ca5b5b9c8fa358945c9f53dda1b488dd43c"}}
-	localNode.IsMining = true
 
-	// NOTE: This test can be a little flaky due to timing with goroutines.
+	// Cancel it once it starts mining
 	go func() {
-		localNode.IsMining = false
+		for !localNode.IsMining() {
+			time.Sleep(time.Millisecond)
+		}
+
+		localNode.cancelMining()
 	}()
-	outputBlock3 := localNode.MineBlock(&localNode.IsMining)
+	outputBlock3 := localNode.MineBlock()
 	assert.Nil(t, outputBlock3)
 }
 
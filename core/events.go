@@ -0,0 +1,69 @@
+package core
+
+import (
+	"sync"
+)
+
+// A nodeEvent is something that happened to a node that services running alongside it (like the Miner) react to.
+type nodeEvent int
+
+const (
+	memPoolChanged nodeEvent = iota // A transaction was added to the MemPool
+	tipChanged                      // The last block in our chain changed (a block was added, or consensus switched chains)
+)
+
+// How many events a subscriber can fall behind by before new events are dropped.
+// Subscribers re-read the node's state on every event, so a dropped event never loses information.
+const eventBufferSize = 64
+
+// eventFeed sends events to everyone that has subscribed to them.
+type eventFeed struct {
+	sync.Mutex
+
+	subscribers []chan nodeEvent
+}
+
+func newEventFeed() *eventFeed {
+	return &eventFeed{}
+}
+
+// subscribe creates a channel that receives every event published after this call.
+func (f *eventFeed) subscribe() chan nodeEvent {
+	f.Lock()
+	defer f.Unlock()
+
+	events := make(chan nodeEvent, eventBufferSize)
+	f.subscribers = append(f.subscribers, events)
+
+	return events
+}
+
+// unsubscribe stops sending events to a channel created by subscribe.
+func (f *eventFeed) unsubscribe(events chan nodeEvent) {
+	f.Lock()
+	defer f.Unlock()
+
+	for i, subscriber := range f.subscribers {
+		if subscriber == events {
+			f.subscribers = append(f.subscribers[:i], f.subscribers[i+1:]...)
+			return
+		}
+	}
+}
+
+// publish sends an event to every subscriber. It never blocks: subscribers that are too far behind miss the event.
+func (f *eventFeed) publish(event nodeEvent) {
+	if f == nil {
+		return
+	}
+
+	f.Lock()
+	defer f.Unlock()
+
+	for _, subscriber := range f.subscribers {
+		select {
+		case subscriber <- event:
+		default:
+		}
+	}
+}
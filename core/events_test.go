@@ -0,0 +1,34 @@
+package core
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestEventFeed(t *testing.T) {
+	feed := newEventFeed()
+
+	events1 := feed.subscribe()
+	events2 := feed.subscribe()
+
+	// Every subscriber gets every event
+	feed.publish(memPoolChanged)
+	assert.Equal(t, memPoolChanged, <-events1)
+	assert.Equal(t, memPoolChanged, <-events2)
+
+	// Unsubscribed channels don't
+	feed.unsubscribe(events1)
+	feed.publish(tipChanged)
+	assert.Empty(t, events1)
+	assert.Equal(t, tipChanged, <-events2)
+
+	// Publishing never blocks on subscribers that are behind
+	for i := 0; i < eventBufferSize*2; i++ {
+		feed.publish(memPoolChanged)
+	}
+	assert.Len(t, events2, eventBufferSize)
+
+	// Publishing on a node without a feed does nothing
+	var noFeed *eventFeed
+	noFeed.publish(tipChanged)
+}
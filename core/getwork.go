@@ -0,0 +1,139 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	log "github.com/sirupsen/logrus"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// The max number of block templates handed out to workers that we remember at once.
+const maxOutstandingWork = 64
+
+var (
+	ErrNoWork       = errors.New("there are no valid transactions to mine")
+	ErrUnknownWork  = errors.New("unknown work (it may have expired)")
+	ErrInvalidProof = errors.New("the nonce does not give the block a valid proof")
+	ErrStaleWork    = errors.New("the block is no longer valid (another block was probably found first)")
+)
+
+// Work is a block template handed out to a mining worker. A worker looks for a nonce where the SHA256 hex digest of
+// "{NONCE DIFFICULTY}-HEADER" (with DIFFICULTY as DifficultyThreshold and HEADER as HeaderString) starts with Target,
+// and submits it with the Work's ID.
+type Work struct {
+	ID                  string      // Identifies the template when submitting a nonce
+	Header              BlockHeader // The header of the block being mined
+	HeaderString        string      // The header as it is hashed in a proof
+	DifficultyThreshold int64       // The number of leading 0s required in the hash
+	Target              string      // The prefix the hash must have (DifficultyThreshold 0s)
+}
+
+// A WorkServer hands out block templates to mining workers outside of this node, and adds the blocks they find to our chain.
+type WorkServer struct {
+	node *LocalNode
+
+	sync.Mutex
+	work        map[string]*BlockTemplate // Work ID -> template
+	current     *BlockTemplate            // The template we are handing out
+	memPoolSize int                       // The size of the MemPool when current was built
+}
+
+// NewWorkServer creates a WorkServer for a node.
+func NewWorkServer(l *LocalNode) *WorkServer {
+	return &WorkServer{node: l, work: make(map[string]*BlockTemplate)}
+}
+
+// newWork describes a block template to a worker.
+func newWork(template *BlockTemplate) Work {
+	return Work{
+		ID:                  SHA256(template.BlockHeader),
+		Header:              template.BlockHeader,
+		HeaderString:        fmt.Sprintf("%v", template.BlockHeader),
+		DifficultyThreshold: template.DifficultyThreshold,
+		Target:              strings.Repeat("0", int(template.DifficultyThreshold)),
+	}
+}
+
+// GetWork gets a block template to mine. The same template is handed out until our chain or MemPool changes.
+// It returns ErrNoWork if there are no valid transactions to mine.
+func (w *WorkServer) GetWork() (Work, error) {
+	w.Lock()
+	defer w.Unlock()
+
+	state := w.node.Snapshot()
+	tip := LastBlock(state.Chain).hash()
+
+	if w.current == nil || w.current.PreviousHash != tip || w.memPoolSize != len(state.MemPool) {
+		template := w.node.newBlockTemplate(state)
+		if template == nil {
+			return Work{}, ErrNoWork
+		}
+
+		// Work on an old tip can never be accepted
+		for id, t := range w.work {
+			if t.PreviousHash != tip {
+				delete(w.work, id)
+			}
+		}
+
+		if len(w.work) >= maxOutstandingWork {
+			w.work = make(map[string]*BlockTemplate)
+		}
+
+		w.current = template
+		w.memPoolSize = len(state.MemPool)
+		w.work[SHA256(template.BlockHeader)] = template
+	}
+
+	return newWork(w.current), nil
+}
+
+// SubmitWork checks a nonce a worker found for a Work, and adds the block to our chain and broadcasts it if its proof is valid.
+func (w *WorkServer) SubmitWork(id string, nonce int64) (Block, error) {
+	w.Lock()
+	template, ok := w.work[id]
+	w.Unlock()
+
+	if !ok {
+		return Block{}, ErrUnknownWork
+	}
+
+	block := Block{template.BlockHeader, Proof{Nonce: nonce, DifficultyThreshold: template.DifficultyThreshold}}
+
+	if !ValidateProof(block) {
+		return Block{}, ErrInvalidProof
+	}
+
+	if !w.node.AddMinedBlockToChain(block) {
+		return Block{}, ErrStaleWork
+	}
+
+	w.Lock()
+	delete(w.work, id)
+	w.Unlock()
+
+	// Alert all other nodes of our new valid block.
+	w.node.BroadcastBlock(block)
+
+	log.Info("A worker just mined a new block and we added it to the chain!")
+
+	return block, nil
+}
+
+// Solve searches for a nonce for a Work the way an external worker would (only using the Work's HeaderString and Target).
+// It checks shouldStop between nonces, and returns false if it told us to stop before we found a nonce.
+func (work Work) Solve(shouldStop func() bool) (int64, bool) {
+	suffix := fmt.Sprintf(" %d}-%s", work.DifficultyThreshold, work.HeaderString)
+
+	for nonce := int64(0); ; nonce++ {
+		if shouldStop() {
+			return 0, false
+		}
+
+		if strings.HasPrefix(SHA256("{"+strconv.FormatInt(nonce, 10)+suffix), work.Target) {
+			return nonce, true
+		}
+	}
+}
@@ -0,0 +1,103 @@
+package core
+
+import (
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+)
+
+func TestWorkServer_GetWork(t *testing.T) {
+	fakeValidationServer := newFakeValidationServer(true)
+	defer fakeValidationServer.Close()
+
+	node := newTestMinerNode(fakeValidationServer.URL)
+	workServer := NewWorkServer(node)
+
+	// Nothing to mine
+	_, err := workServer.GetWork()
+	assert.Equal(t, ErrNoWork, err)
+
+	assert.True(t, node.AddTransactionToMemPool(harnessBlock1.Transactions[1]))
+
+	work, err := workServer.GetWork()
+	assert.NoError(t, err)
+	assert.Equal(t, testGenesisBlock.hash(), work.Header.PreviousHash)
+	assert.Equal(t, []Transaction{harnessBlock1.Transactions[1]}, work.Header.Transactions[1:])
+	assert.Equal(t, fmt.Sprintf("%v", work.Header), work.HeaderString)
+	assert.Equal(t, int64(5), work.DifficultyThreshold)
+	assert.Equal(t, "00000", work.Target)
+
+	// The same work is handed out until something changes
+	again, err := workServer.GetWork()
+	assert.NoError(t, err)
+	assert.Equal(t, work, again)
+
+	// New transactions give new work
+	assert.True(t, node.AddTransactionToMemPool(harnessBlock2.Transactions[1]))
+
+	grown, err := workServer.GetWork()
+	assert.NoError(t, err)
+	assert.NotEqual(t, work.ID, grown.ID)
+	assert.Len(t, grown.Header.Transactions, 3)
+
+	// A new block gives new work on top of it, and work on the old tip is forgotten
+	assert.True(t, node.AddMinedBlockToChain(harnessBlock1))
+
+	next, err := workServer.GetWork()
+	assert.NoError(t, err)
+	assert.Equal(t, harnessBlock1.hash(), next.Header.PreviousHash)
+
+	_, err = workServer.SubmitWork(work.ID, 0)
+	assert.Equal(t, ErrUnknownWork, err)
+}
+
+func TestWorkServer_SubmitWork(t *testing.T) {
+	fakeValidationServer := newFakeValidationServer(true)
+	defer fakeValidationServer.Close()
+
+	node := newTestMinerNode(fakeValidationServer.URL)
+	workServer := NewWorkServer(node)
+
+	assert.True(t, node.AddTransactionToMemPool(harnessBlock1.Transactions[1]))
+
+	work, err := workServer.GetWork()
+	assert.NoError(t, err)
+
+	// Unknown work
+	_, err = workServer.SubmitWork("not work", 0)
+	assert.Equal(t, ErrUnknownWork, err)
+
+	// A worker finds a nonce using only what GetWork told them
+	nonce, found := work.Solve(func() bool { return false })
+	assert.True(t, found)
+
+	// Invalid nonce
+	_, err = workServer.SubmitWork(work.ID, nonce+1)
+	if !ValidateProof(Block{work.Header, Proof{nonce + 1, work.DifficultyThreshold}}) {
+		assert.Equal(t, ErrInvalidProof, err)
+	}
+
+	block, err := workServer.SubmitWork(work.ID, nonce)
+	assert.NoError(t, err)
+	assert.True(t, ValidateProof(block))
+	assert.Equal(t, []Block{testGenesisBlock, block}, node.Chain)
+	assert.Empty(t, node.MemPool)
+	assert.Equal(t, coinbaseReward, node.UTXO.ImmatureBalance("miner"))
+
+	// The same work can't be submitted twice
+	_, err = workServer.SubmitWork(work.ID, nonce)
+	assert.Equal(t, ErrUnknownWork, err)
+}
+
+func TestWork_Solve(t *testing.T) {
+	work := Work{HeaderString: "header", DifficultyThreshold: 2, Target: "00"}
+
+	nonce, found := work.Solve(func() bool { return false })
+	assert.True(t, found)
+	assert.True(t, strings.HasPrefix(SHA256(fmt.Sprintf("%v-%v", Proof{nonce, 2}, "header")), "00"))
+
+	// Stopping
+	_, found = work.Solve(func() bool { return true })
+	assert.False(t, found)
+}
@@ -0,0 +1,280 @@
+package core
+
+import (
+	"fmt"
+	"github.com/perlin-network/noise"
+	log "github.com/sirupsen/logrus"
+	"sync"
+	"time"
+)
+
+// The version of the P2P protocol this node speaks. Bump this whenever messages change in a way old nodes can't handle.
+const ProtocolVersion uint32 = 1
+
+// The oldest P2P protocol version we are willing to talk to.
+const MinimumProtocolVersion uint32 = 1
+
+// The network magic of the main Cosmosis network. Nodes on other networks (like a testnet) use a different magic,
+// so they never exchange chains with each other.
+const MainNetworkMagic uint32 = 0xc05305e5
+
+// The user agent this node sends to its peers.
+const UserAgent = "cosmosis:1.0.0"
+
+// How long peers that sent us an incompatible Hello are banned for, so they can't reconnect and talk to us
+// without a handshake (as if they were an old node).
+const incompatiblePeerBanDuration = time.Hour
+
+// A Hello is the first message two peers send each other. Peers only talk to each other once both have sent a compatible Hello.
+type Hello struct {
+	ProtocolVersion uint32 // The version of the P2P protocol the peer speaks
+	NetworkMagic    uint32 // Identifies which network the peer is on
+	GenesisHash     string // The hash of the first block in the peer's chain
+	BestHeight      int    // The index of the last block in the peer's chain
+	UserAgent       string // The software the peer is running
+}
+
+// peerBook keeps track of which peers we have sent a Hello to, the Hello each compatible peer sent us,
+// and which peers understand our wire format.
+type peerBook struct {
+	sync.Mutex
+
+	hellos     map[string]Hello // Peer address -> the Hello they sent us (only for peers that completed the handshake)
+	sentHello  map[string]bool  // Peer address -> whether we've sent them our Hello
+	wireFormat map[string]bool  // Peer address -> whether they have shown they understand our wire format
+}
+
+func newPeerBook() *peerBook {
+	return &peerBook{hellos: make(map[string]Hello), sentHello: make(map[string]bool), wireFormat: make(map[string]bool)}
+}
+
+// markHelloSent records that we sent a peer our Hello. It returns false if we had already sent it.
+func (p *peerBook) markHelloSent(address string) bool {
+	if p == nil {
+		return false
+	}
+
+	p.Lock()
+	defer p.Unlock()
+
+	if p.sentHello[address] {
+		return false
+	}
+
+	p.sentHello[address] = true
+
+	return true
+}
+
+// unmarkHelloSent records that our Hello never made it to a peer (so we send it again next time).
+func (p *peerBook) unmarkHelloSent(address string) {
+	if p == nil {
+		return
+	}
+
+	p.Lock()
+	defer p.Unlock()
+
+	delete(p.sentHello, address)
+}
+
+// addHello records the Hello a compatible peer sent us.
+func (p *peerBook) addHello(address string, hello Hello) {
+	if p == nil {
+		return
+	}
+
+	p.Lock()
+	defer p.Unlock()
+
+	p.hellos[address] = hello
+}
+
+// hasHandshake checks whether a peer has sent us a compatible Hello.
+func (p *peerBook) hasHandshake(address string) bool {
+	if p == nil {
+		return false
+	}
+
+	p.Lock()
+	defer p.Unlock()
+
+	_, ok := p.hellos[address]
+
+	return ok
+}
+
+// markWireFormat records that a peer understands our wire format (as they sent us a message in it, or a Hello).
+func (p *peerBook) markWireFormat(address string) {
+	if p == nil {
+		return
+	}
+
+	p.Lock()
+	defer p.Unlock()
+
+	p.wireFormat[address] = true
+}
+
+// speaksWireFormat checks whether a peer has shown they understand our wire format (so they aren't an old node).
+func (p *peerBook) speaksWireFormat(address string) bool {
+	if p == nil {
+		return false
+	}
+
+	p.Lock()
+	defer p.Unlock()
+
+	return p.wireFormat[address]
+}
+
+// needsLegacyEncoding checks whether we have to send a peer old gob encoded NodeMessages. Until a peer shows they understand
+// our wire format they might be an old node, which crashes on anything else. Once DecodeLegacyMessages is off, nobody does.
+func (p *peerBook) needsLegacyEncoding(address string) bool {
+	if p == nil || !DecodeLegacyMessages {
+		return false
+	}
+
+	p.Lock()
+	defer p.Unlock()
+
+	return !p.wireFormat[address]
+}
+
+// all gets a copy of the Hello of every peer that completed the handshake.
+func (p *peerBook) all() map[string]Hello {
+	hellos := make(map[string]Hello)
+
+	if p == nil {
+		return hellos
+	}
+
+	p.Lock()
+	defer p.Unlock()
+
+	for address, hello := range p.hellos {
+		hellos[address] = hello
+	}
+
+	return hellos
+}
+
+// forget removes a peer (so they have to handshake again if we reconnect).
+func (p *peerBook) forget(address string) {
+	if p == nil {
+		return
+	}
+
+	p.Lock()
+	defer p.Unlock()
+
+	delete(p.hellos, address)
+	delete(p.sentHello, address)
+	delete(p.wireFormat, address)
+}
+
+// networkMagic gets the magic of the network this node is on (defaults to MainNetworkMagic).
+func (l *LocalNode) networkMagic() uint32 {
+	if l.NetworkMagic == 0 {
+		return MainNetworkMagic
+	}
+
+	return l.NetworkMagic
+}
+
+// ourHello creates the Hello we send to our peers.
+func (l *LocalNode) ourHello() Hello {
+	chain := l.Snapshot().Chain
+
+	return Hello{
+		ProtocolVersion: ProtocolVersion,
+		NetworkMagic:    l.networkMagic(),
+		GenesisHash:     chain[0].hash(),
+		BestHeight:      len(chain) - 1,
+		UserAgent:       UserAgent,
+	}
+}
+
+// checkHello returns an error if a peer's Hello shows they can't be on the same network as us.
+func (l *LocalNode) checkHello(hello Hello) error {
+	if hello.ProtocolVersion < MinimumProtocolVersion {
+		return fmt.Errorf("their protocol version (%d) is older than the minimum we support (%d)", hello.ProtocolVersion, MinimumProtocolVersion)
+	}
+
+	if hello.NetworkMagic != l.networkMagic() {
+		return fmt.Errorf("they are on a different network (magic %x, ours is %x)", hello.NetworkMagic, l.networkMagic())
+	}
+
+	if genesisHash := l.Snapshot().Chain[0].hash(); hello.GenesisHash != genesisHash {
+		return fmt.Errorf("their genesis block (%s) is different from ours (%s)", hello.GenesisHash, genesisHash)
+	}
+
+	return nil
+}
+
+// SendHello sends a peer our Hello (unless we have already sent it to them).
+func (l *LocalNode) SendHello(address string) {
+	if !l.peers.markHelloSent(address) {
+		return
+	}
+
+	err := l.sendMessageToPeer(HelloMessage{Hello: l.ourHello()}, address)
+
+	if err != nil {
+		log.Errorf("Failed to send our hello to %s", address)
+
+		// Let us try again next time
+		l.peers.unmarkHelloSent(address)
+	}
+}
+
+// handleHello checks a Hello from a peer. Incompatible peers are disconnected.
+// Once a compatible peer has sent us their Hello, we sync our MemPool with them, and run consensus if they have a longer chain.
+func (l *LocalNode) handleHello(hello Hello, peer noise.ID) {
+	from := peer.Address
+
+	if err := l.checkHello(hello); err != nil {
+		log.Warnf("Disconnecting from %s (%s) as they are incompatible: %s", from, hello.UserAgent, err)
+
+		// Disconnecting forgets that they sent us a Hello, so they are banned (by their key) to stop them reconnecting as an old node
+		if err := l.BanPeer(peerKey(peer), incompatiblePeerBanDuration); err != nil {
+			log.Errorf("Failed to save the ban list: %s", err)
+		}
+
+		return
+	}
+
+	alreadyHandshaken := l.peers.hasHandshake(from)
+
+	l.peers.addHello(from, hello)
+
+	// They might have sent their hello before we knew about them
+	l.SendHello(from)
+
+	if alreadyHandshaken {
+		return
+	}
+
+	log.Infof("Completed our handshake with %s (%s, height %d)!", from, hello.UserAgent, hello.BestHeight)
+
+	// Sync MemPools with the new peer so we don't miss transactions gossiped before we met it.
+	l.RequestPeerMemPool(from)
+
+	// If they are ahead of us, we are missing blocks.
+	if height := len(l.Snapshot().Chain) - 1; hello.BestHeight > height {
+		log.Infof("%s has a longer chain than us (height %d vs %d). Running peer consensus...", from, hello.BestHeight, height)
+		go l.GetPeerConsensus()
+	}
+}
+
+// awaitingHello checks whether messages from a peer should be ignored as they haven't sent us a compatible Hello yet.
+// Old nodes never send a Hello, so their messages are let through until we stop decoding them (see DecodeLegacyMessages).
+// Peers that have shown they speak our wire format aren't old nodes, so they can't skip the handshake by sending old messages.
+func (l *LocalNode) awaitingHello(address string) bool {
+	return l.peers.speaksWireFormat(address) && !l.peers.hasHandshake(address)
+}
+
+// Peers gets the Hello of every peer we have completed a handshake with (by their address).
+func (l *LocalNode) Peers() map[string]Hello {
+	return l.peers.all()
+}
@@ -0,0 +1,87 @@
+package core
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestLocalNode_CheckHello(t *testing.T) {
+	localNode := LocalNode{Chain: []Block{testGenesisBlock}, MemPool: make([]Transaction, 0), UTXO: make(UTXO), ValidationServerURL: validationServer, OperatorPublicKey: "0", MinimumChainsForConsensus: 1}
+
+	// Our own hello is compatible
+	ourHello := localNode.ourHello()
+	assert.NoError(t, localNode.checkHello(ourHello))
+	assert.Equal(t, MainNetworkMagic, ourHello.NetworkMagic)
+	assert.Equal(t, 0, ourHello.BestHeight)
+
+	// Old protocol versions
+	oldVersion := ourHello
+	oldVersion.ProtocolVersion = MinimumProtocolVersion - 1
+	assert.Error(t, localNode.checkHello(oldVersion))
+
+	// Other networks
+	otherNetwork := ourHello
+	otherNetwork.NetworkMagic = 1
+	assert.Error(t, localNode.checkHello(otherNetwork))
+
+	// Other genesis blocks
+	otherGenesis := ourHello
+	otherGenesis.GenesisHash = GenesisBlock.hash()
+	assert.Error(t, localNode.checkHello(otherGenesis))
+
+	// Nodes on another network accept peers on that network
+	localNode.NetworkMagic = 1
+	assert.NoError(t, localNode.checkHello(otherNetwork))
+}
+
+func TestLocalNode_HandleHello(t *testing.T) {
+	localNode := LocalNode{Chain: []Block{testGenesisBlock}, MemPool: make([]Transaction, 0), UTXO: make(UTXO), ValidationServerURL: validationServer, OperatorPublicKey: "0", MinimumChainsForConsensus: 1}
+	localNode.peers = newPeerBook()
+	localNode.bans, _ = newBanList("")
+
+	// Incompatible peers don't complete the handshake, and are banned so they can't reconnect as an old node
+	incompatible := localNode.ourHello()
+	incompatible.NetworkMagic = 1
+	incompatiblePeer := newTestPeer(t, "peer1")
+	localNode.handleHello(incompatible, incompatiblePeer)
+	assert.Empty(t, localNode.Peers())
+	assert.True(t, localNode.IsPeerBanned(peerKey(incompatiblePeer)))
+
+	// Compatible peers do
+	localNode.handleHello(localNode.ourHello(), newTestPeer(t, "peer2"))
+	assert.Contains(t, localNode.Peers(), "peer2")
+	assert.True(t, localNode.peers.hasHandshake("peer2"))
+}
+
+func TestLocalNode_AwaitingHello(t *testing.T) {
+	localNode := LocalNode{Chain: []Block{testGenesisBlock}, MemPool: make([]Transaction, 0), UTXO: make(UTXO), ValidationServerURL: validationServer, OperatorPublicKey: "0", MinimumChainsForConsensus: 1}
+	localNode.peers = newPeerBook()
+
+	// Peers that might be old nodes don't have to send a Hello
+	assert.False(t, localNode.awaitingHello("peer1"))
+
+	// Peers that speak our wire format do (even if they send old messages)
+	localNode.peers.markWireFormat("peer1")
+	assert.True(t, localNode.awaitingHello("peer1"))
+
+	localNode.peers.addHello("peer1", localNode.ourHello())
+	assert.False(t, localNode.awaitingHello("peer1"))
+}
+
+func TestPeerBook(t *testing.T) {
+	peers := newPeerBook()
+
+	// We only send our hello once
+	assert.True(t, peers.markHelloSent("peer1"))
+	assert.False(t, peers.markHelloSent("peer1"))
+
+	assert.False(t, peers.hasHandshake("peer1"))
+	peers.addHello("peer1", Hello{UserAgent: UserAgent})
+	assert.True(t, peers.hasHandshake("peer1"))
+	assert.Equal(t, map[string]Hello{"peer1": {UserAgent: UserAgent}}, peers.all())
+
+	// Forgotten peers have to handshake again
+	peers.forget("peer1")
+	assert.False(t, peers.hasHandshake("peer1"))
+	assert.True(t, peers.markHelloSent("peer1"))
+}
@@ -0,0 +1,421 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"encoding/gob"
+	"fmt"
+	"github.com/perlin-network/noise"
+	"github.com/perlin-network/noise/kademlia"
+	"github.com/stretchr/testify/assert"
+	"net"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Pre-mined blocks on testGenesisBlock (the fake validation server accepts their signatures).
+// harnessBlock2 builds on harnessBlock1, and harnessForkBlock competes with harnessBlock1.
+var harnessRecipient = "046007e213c57ccab18af3f3b385893da75514ab691216152955d70937744dbe040de0ea504ebe29bce2476ae37c794cf5e7d96c8bc2ad153eb434b148f1af6f6c"
+var harnessBlock1 = Block{BlockHeader: BlockHeader{Timestamp: 1586200000, Transactions: []Transaction{Transaction{Sender: "0", Recipient: "miner1", Amount: 1000, Timestamp: 1586200000, Signature: ""}, Transaction{Sender: testGenesisBlock.Transactions[0].Recipient, Recipient: harnessRecipient, Amount: 10, Timestamp: 1586199990, Signature: "signature1"}}, PreviousHash: testGenesisBlock.hash()}, Proof: Proof{Nonce: 461044, DifficultyThreshold: 5}}
+var harnessBlock2 = Block{BlockHeader: BlockHeader{Timestamp: 1586200600, Transactions: []Transaction{Transaction{Sender: "0", Recipient: "miner1", Amount: 1000, Timestamp: 1586200600, Signature: ""}, Transaction{Sender: testGenesisBlock.Transactions[0].Recipient, Recipient: harnessRecipient, Amount: 20, Timestamp: 1586200590, Signature: "signature2"}}, PreviousHash: harnessBlock1.hash()}, Proof: Proof{Nonce: 428777, DifficultyThreshold: 5}}
+var harnessForkBlock = Block{BlockHeader: BlockHeader{Timestamp: 1586200300, Transactions: []Transaction{Transaction{Sender: "0", Recipient: "miner2", Amount: 1000, Timestamp: 1586200300, Signature: ""}, Transaction{Sender: testGenesisBlock.Transactions[0].Recipient, Recipient: harnessRecipient, Amount: 30, Timestamp: 1586200290, Signature: "signature3"}}, PreviousHash: testGenesisBlock.hash()}, Proof: Proof{Nonce: 469353, DifficultyThreshold: 5}}
+
+// The chains in our tests (on testGenesisBlock) have every rule from their first block, unlike our real chain
+// (see coinbaseMaturityHeight and timestampRulesHeight). The exception is coinbaseRecipientHeight, as their rewards go to made-up miners like "miner1".
+func TestMain(m *testing.M) {
+	coinbaseMaturityHeight, timestampRulesHeight = 0, 0
+
+	os.Exit(m.Run())
+}
+
+// How long we wait for the network to converge before failing a test.
+const convergenceTimeout = 15 * time.Second
+
+// A testNetwork is a set of in-process nodes that talk to each other over loopback (on random ports),
+// and share a fake signature validation server.
+type testNetwork struct {
+	t                *testing.T
+	nodes            []*LocalNode
+	validationServer *httptest.Server
+}
+
+// newTestNetwork starts size nodes. Every node connects to the first node (and discovers the rest through it),
+// and this waits until every node has completed a handshake with at least one peer (if there is more than one node).
+func newTestNetwork(t *testing.T, size int) *testNetwork {
+	if testing.Short() {
+		t.Skip("Skipping multi-node test in short mode.")
+	}
+
+	n := &testNetwork{t: t, validationServer: newFakeValidationServer(true)}
+
+	minimumChainsForConsensus := size - 1
+	if minimumChainsForConsensus < 1 {
+		minimumChainsForConsensus = 1
+	}
+
+	for i := 0; i < size; i++ {
+		if err := n.start(minimumChainsForConsensus); err != nil {
+			n.close()
+			t.Fatalf("Failed to start node %d: %s", i, err)
+		}
+	}
+
+	t.Cleanup(n.close)
+
+	if size == 1 {
+		return n
+	}
+
+	n.waitFor("every node to complete a handshake", func() bool {
+		for _, node := range n.nodes {
+			if len(node.Peers()) == 0 {
+				return false
+			}
+		}
+
+		return true
+	})
+
+	return n
+}
+
+// start starts another node with just the genesis block, connected to the first node (unless it is the first node).
+func (n *testNetwork) start(minimumChainsForConsensus int) error {
+	i := len(n.nodes)
+
+	node := &LocalNode{Chain: []Block{testGenesisBlock}, MemPool: make([]Transaction, 0), UTXO: UTXO{testGenesisBlock.Transactions[0].Recipient: {Spendable: testGenesisBlock.Transactions[0].Amount}}, ValidationServerURL: n.validationServer.URL, OperatorPublicKey: fmt.Sprintf("miner%d", i), MinimumChainsForConsensus: minimumChainsForConsensus, ConsensusTimeout: time.Second, ListenAddress: "127.0.0.1:0"}
+
+	var seedNodes []string
+	if i > 0 {
+		seedNodes = []string{n.nodes[0].Address()}
+	}
+
+	if err := node.Start(context.Background(), seedNodes); err != nil {
+		return err
+	}
+
+	n.nodes = append(n.nodes, node)
+
+	return nil
+}
+
+// join starts a node that joins the network after it is already running (see start).
+func (n *testNetwork) join() *LocalNode {
+	n.t.Helper()
+
+	if err := n.start(len(n.nodes)); err != nil {
+		n.t.Fatalf("Failed to start a node to join the network: %s", err)
+	}
+
+	return n.nodes[len(n.nodes)-1]
+}
+
+// close shuts down every node and the validation server.
+func (n *testNetwork) close() {
+	for _, node := range n.nodes {
+		node.Stop()
+	}
+
+	n.validationServer.Close()
+}
+
+// waitFor fails the test if condition isn't true before convergenceTimeout.
+func (n *testNetwork) waitFor(description string, condition func() bool) {
+	n.t.Helper()
+
+	assert.Eventually(n.t, condition, convergenceTimeout, 50*time.Millisecond, "Timed out waiting for %s.", description)
+}
+
+// mine adds a pre-mined block to a node's chain and broadcasts it, like a node that just mined it.
+func (n *testNetwork) mine(node int, block Block) {
+	n.t.Helper()
+
+	if !n.nodes[node].AddMinedBlockToChain(block) {
+		n.t.Fatalf("Node %d rejected block %s.", node, block.hash())
+	}
+
+	n.nodes[node].BroadcastBlock(block)
+}
+
+// partition cuts every node in one group off from every node in the other (by having them ban each other).
+func (n *testNetwork) partition(group1 []int, group2 []int) {
+	for _, i := range group1 {
+		for _, j := range group2 {
+			n.nodes[i].BanPeer(n.nodes[j].PeerKey(), time.Hour)
+			n.nodes[j].BanPeer(n.nodes[i].PeerKey(), time.Hour)
+		}
+	}
+}
+
+// heal lifts every ban and reconnects every node to every other node.
+func (n *testNetwork) heal() {
+	for _, node := range n.nodes {
+		for key := range node.BannedPeers() {
+			node.UnbanPeer(key)
+		}
+	}
+
+	for i, node := range n.nodes {
+		for j, peer := range n.nodes {
+			if i != j {
+				bootstrap(node.node, []string{peer.Address()})
+			}
+		}
+	}
+}
+
+// converged checks whether every node has the same Chain, UTXO and MemPool (the nodes are running, so they are read through snapshots).
+func (n *testNetwork) converged() bool {
+	first := n.nodes[0].Snapshot()
+
+	for _, node := range n.nodes[1:] {
+		state := node.Snapshot()
+
+		if !reflect.DeepEqual(state.Chain, first.Chain) || !reflect.DeepEqual(state.UTXO, first.UTXO) || !reflect.DeepEqual(TransactionIDs(state.MemPool), TransactionIDs(first.MemPool)) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func TestNetwork_Propagation(t *testing.T) {
+	network := newTestNetwork(t, 3)
+
+	// A transaction sent to one node reaches every MemPool
+	transaction := harnessBlock1.Transactions[1]
+	assert.True(t, network.nodes[1].AddTransactionToMemPool(transaction))
+
+	network.waitFor("the transaction to reach every node", func() bool {
+		for _, node := range network.nodes {
+			if !IsTransactionAlreadyInMemPoolOrChain(transaction, node.Snapshot().MemPool, nil) {
+				return false
+			}
+		}
+
+		return true
+	})
+
+	// A block mined by one node reaches every chain (and confirms the transaction everywhere)
+	network.mine(1, harnessBlock1)
+
+	network.waitFor("the block to reach every node", func() bool {
+		return network.converged() && len(network.nodes[0].Snapshot().Chain) == 2
+	})
+
+	for _, node := range network.nodes {
+		state := node.Snapshot()
+		assert.Equal(t, []Block{testGenesisBlock, harnessBlock1}, state.Chain)
+		assert.Empty(t, state.MemPool)
+		assert.Equal(t, uint64(10), state.UTXO[harnessRecipient].Spendable)
+		assert.Equal(t, uint64(1000), state.UTXO.ImmatureBalance("miner1"))
+	}
+}
+
+func TestNetwork_MemPoolSync(t *testing.T) {
+	network := newTestNetwork(t, 2)
+
+	transaction := harnessBlock1.Transactions[1]
+	assert.True(t, network.nodes[0].AddTransactionToMemPool(transaction))
+
+	network.waitFor("the transaction to be gossiped", func() bool {
+		return IsTransactionInMemPool(transaction, network.nodes[1].Snapshot().MemPool)
+	})
+
+	// A node that joins afterwards never hears the transaction announced, so it asks its peers for their MemPools after their Hello
+	joined := network.join()
+
+	network.waitFor("the joining node to sync its MemPool", func() bool {
+		return IsTransactionInMemPool(transaction, joined.Snapshot().MemPool)
+	})
+
+	assert.Equal(t, []Transaction{transaction}, joined.Snapshot().MemPool)
+}
+
+func TestNetwork_PartitionAndHeal(t *testing.T) {
+	network := newTestNetwork(t, 2)
+
+	network.partition([]int{0}, []int{1})
+
+	// Each side of the partition builds its own chain
+	network.mine(0, harnessBlock1)
+	network.mine(0, harnessBlock2)
+	network.mine(1, harnessForkBlock)
+
+	// A transaction that only one side of the partition has
+	pending := Transaction{Sender: testGenesisBlock.Transactions[0].Recipient, Recipient: harnessRecipient, Amount: 40, Timestamp: 1586200700, Signature: "signature4"}
+	assert.True(t, network.nodes[1].AddTransactionToMemPool(pending))
+
+	assert.False(t, network.converged())
+
+	network.heal()
+
+	// The side with the shorter chain switches to the longer one once it hears about it
+	network.waitFor("the partition to heal", func() bool {
+		return network.converged() && len(network.nodes[1].Snapshot().Chain) == 3
+	})
+
+	for _, node := range network.nodes {
+		state := node.Snapshot()
+		assert.Equal(t, []Block{testGenesisBlock, harnessBlock1, harnessBlock2}, state.Chain)
+		assert.Equal(t, uint64(30), state.UTXO[harnessRecipient].Spendable)
+		assert.NotContains(t, state.UTXO, "miner2")
+		assert.Equal(t, []Transaction{pending}, state.MemPool)
+	}
+}
+
+// oldNodeMessage is the NodeMessage old nodes have (before the wire format, and without a Hello).
+type oldNodeMessage struct {
+	MessageType int
+	Body        interface{}
+}
+
+func (m oldNodeMessage) Marshal() []byte {
+	var buf bytes.Buffer
+
+	if err := gob.NewEncoder(&buf).Encode(m); err != nil {
+		panic(err)
+	}
+
+	return buf.Bytes()
+}
+
+// A testOldNode behaves like a node from before the wire format: it only speaks gob NodeMessages with the first four
+// message types, never sends a Hello, and (like old nodes did) would crash on any other message.
+type testOldNode struct {
+	sync.Mutex
+
+	t        *testing.T
+	node     *noise.Node
+	received []oldNodeMessage
+	crashes  []string // Why the old node would have crashed
+}
+
+func newTestOldNode(t *testing.T) *testOldNode {
+	o := &testOldNode{t: t}
+
+	node, err := noise.NewNode(noise.WithNodeBindHost(net.ParseIP("127.0.0.1")), noise.WithNodeBindPort(0))
+	assert.NoError(t, err)
+
+	node.RegisterMessage(oldNodeMessage{}, func(data []byte) (oldNodeMessage, error) {
+		var msg oldNodeMessage
+		if err := gob.NewDecoder(bytes.NewReader(data)).Decode(&msg); err != nil {
+			o.crash(fmt.Sprintf("it couldn't decode a message: %s", err))
+			return msg, err
+		}
+
+		return msg, nil
+	})
+
+	node.Handle(func(ctx noise.HandlerContext) error {
+		obj, err := ctx.DecodeMessage()
+		if err != nil {
+			return nil
+		}
+
+		msg, ok := obj.(oldNodeMessage)
+		if !ok {
+			return nil
+		}
+
+		if msg.MessageType > needChain {
+			o.crash(fmt.Sprintf("it got message type %d", msg.MessageType))
+			return nil
+		}
+
+		o.Lock()
+		o.received = append(o.received, msg)
+		o.Unlock()
+
+		if msg.MessageType == needChain {
+			go o.send(ctx.ID().Address, oldNodeMessage{MessageType: thisIsMyChain, Body: []Block{testGenesisBlock}})
+		}
+
+		return nil
+	})
+
+	node.Bind(kademlia.New().Protocol())
+	assert.NoError(t, node.Listen())
+
+	t.Cleanup(func() { node.Close() })
+
+	o.node = node
+
+	return o
+}
+
+func (o *testOldNode) crash(reason string) {
+	o.Lock()
+	defer o.Unlock()
+
+	o.crashes = append(o.crashes, reason)
+}
+
+func (o *testOldNode) send(address string, msg oldNodeMessage) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return o.node.SendMessage(ctx, address, msg)
+}
+
+// receivedBody gets the body of the last message of a type the old node got (and whether it got one).
+func (o *testOldNode) receivedBody(messageType int) (interface{}, bool) {
+	o.Lock()
+	defer o.Unlock()
+
+	for i := len(o.received) - 1; i >= 0; i-- {
+		if o.received[i].MessageType == messageType {
+			return o.received[i].Body, true
+		}
+	}
+
+	return nil, false
+}
+
+func TestNetwork_OldNode(t *testing.T) {
+	network := newTestNetwork(t, 1)
+	node := network.nodes[0]
+
+	old := newTestOldNode(t)
+	bootstrap(old.node, []string{node.Address()})
+
+	// We open with our Hello on a needChain, which the old node answers with its chain
+	network.waitFor("the old node to get our hello", func() bool {
+		_, ok := old.receivedBody(needChain)
+		return ok
+	})
+
+	// The old node never sends a Hello, but its messages still get through
+	transaction := harnessBlock1.Transactions[1]
+	assert.NoError(t, old.send(node.Address(), oldNodeMessage{MessageType: newTransaction, Body: transaction}))
+
+	network.waitFor("the old node's transaction to reach our MemPool", func() bool {
+		return IsTransactionAlreadyInMemPoolOrChain(transaction, node.Snapshot().MemPool, nil)
+	})
+
+	// It gets full blocks (as it doesn't understand announcements)
+	network.mine(0, harnessBlock1)
+
+	network.waitFor("our block to reach the old node", func() bool {
+		block, ok := old.receivedBody(newBlock)
+		return ok && reflect.DeepEqual(block, harnessBlock1)
+	})
+
+	// And our chain when it asks for it
+	assert.NoError(t, old.send(node.Address(), oldNodeMessage{MessageType: needChain}))
+
+	network.waitFor("our chain to reach the old node", func() bool {
+		chain, ok := old.receivedBody(thisIsMyChain)
+		return ok && reflect.DeepEqual(chain, []Block{testGenesisBlock, harnessBlock1})
+	})
+
+	// We never sent it anything that would have crashed it
+	old.Lock()
+	assert.Empty(t, old.crashes)
+	old.Unlock()
+	assert.Empty(t, node.Peers())
+}
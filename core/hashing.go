@@ -10,6 +10,11 @@ func (b Block) hash() string {
 	return SHA256(b)
 }
 
+// Convenience function that hashes a transaction. The hash is used as the transaction's ID when syncing with peers.
+func (t Transaction) hash() string {
+	return SHA256(t)
+}
+
 // Hashes any type with SHA256 and converts to hex.
 func SHA256(o interface{}) string {
 	h := sha256.New()
@@ -17,3 +22,27 @@ func SHA256(o interface{}) string {
 
 	return fmt.Sprintf("%x", h.Sum(nil))
 }
+
+// Formats a transaction (which is how it is hashed). Transactions that don't use any newer fields (like Multisig, LockTime, Outputs or Payments)
+// are formatted exactly like before those fields existed, so the hashes and proofs of old blocks don't change.
+func (t Transaction) String() string {
+	formatted := fmt.Sprintf("{%v %v %v %v %v", t.Sender, t.Recipient, t.Amount, t.Timestamp, t.Signature)
+
+	if t.isMultisig() || len(t.Signatures) > 0 {
+		formatted += fmt.Sprintf(" multisig:%v signatures:%v", t.Multisig, t.Signatures)
+	}
+
+	if t.LockTime != 0 {
+		formatted += fmt.Sprintf(" lockTime:%v", t.LockTime)
+	}
+
+	if t.isOutputBased() {
+		formatted += fmt.Sprintf(" inputs:%v outputs:%v", t.Inputs, t.Outputs)
+	}
+
+	if t.isBatch() {
+		formatted += fmt.Sprintf(" payments:%v", t.Payments)
+	}
+
+	return formatted + "}"
+}
@@ -0,0 +1,174 @@
+package core
+
+import (
+	"sync"
+	"time"
+)
+
+// The max number of block/transaction hashes we remember for each peer (so memory doesn't grow forever).
+const maxKnownInventoryPerPeer = 10000
+
+// How long we wait for a peer to answer an inventory request before we are willing to ask another peer for it.
+const inventoryRequestTimeout = 10 * time.Second
+
+// The max number of transactions we ask a peer for (or accept from them) at once when syncing our MemPool.
+const maxTransactionsPerRequest = 1000
+
+// An Inventory is a list of block hashes and transaction IDs that a node announces it has (or asks to be sent).
+type Inventory struct {
+	Blocks       []string // The hashes of blocks
+	Transactions []string // The IDs (hashes) of transactions
+}
+
+// knownInventory keeps track of which peers are known to have which blocks and transactions,
+// and which items we have already asked for, so we never send or request the same data twice.
+type knownInventory struct {
+	sync.Mutex
+
+	peers     map[string]*peerInventory       // Peer address -> hashes that peer is known to have
+	requested map[string]time.Time            // Hash -> when we last requested it from a peer
+	solicited map[string]map[string]time.Time // Peer address -> IDs of the MemPool transactions we asked that peer for -> when we asked
+}
+
+// peerInventory is a bounded set of hashes that one peer is known to have.
+type peerInventory struct {
+	hashes map[string]bool
+	order  []string // The order in which hashes were added, so the oldest can be forgotten first
+}
+
+func newKnownInventory() *knownInventory {
+	return &knownInventory{peers: make(map[string]*peerInventory), requested: make(map[string]time.Time), solicited: make(map[string]map[string]time.Time)}
+}
+
+// markKnown records that a peer has a block or transaction.
+func (k *knownInventory) markKnown(address string, hash string) {
+	if k == nil {
+		return
+	}
+
+	k.Lock()
+	defer k.Unlock()
+
+	peer, ok := k.peers[address]
+	if !ok {
+		peer = &peerInventory{hashes: make(map[string]bool)}
+		k.peers[address] = peer
+	}
+
+	if peer.hashes[hash] {
+		return
+	}
+
+	peer.hashes[hash] = true
+	peer.order = append(peer.order, hash)
+
+	// Forget the oldest hash if this peer's inventory is full
+	if len(peer.order) > maxKnownInventoryPerPeer {
+		delete(peer.hashes, peer.order[0])
+		peer.order = peer.order[1:]
+	}
+}
+
+// isKnown checks whether a peer is known to have a block or transaction.
+func (k *knownInventory) isKnown(address string, hash string) bool {
+	if k == nil {
+		return false
+	}
+
+	k.Lock()
+	defer k.Unlock()
+
+	peer, ok := k.peers[address]
+
+	return ok && peer.hashes[hash]
+}
+
+// markRequested records that we are requesting a hash from a peer.
+// It returns false if the hash was already requested recently (meaning it should not be requested again).
+func (k *knownInventory) markRequested(hash string) bool {
+	if k == nil {
+		return true
+	}
+
+	k.Lock()
+	defer k.Unlock()
+
+	now := time.Now()
+
+	if requestedAt, ok := k.requested[hash]; ok && now.Sub(requestedAt) < inventoryRequestTimeout {
+		return false
+	}
+
+	// Clear out old requests so this map doesn't grow forever
+	for h, requestedAt := range k.requested {
+		if now.Sub(requestedAt) >= inventoryRequestTimeout {
+			delete(k.requested, h)
+		}
+	}
+
+	k.requested[hash] = now
+
+	return true
+}
+
+// markSolicited records that we asked a peer for the MemPool transactions with certain IDs (see takeSolicited).
+func (k *knownInventory) markSolicited(address string, ids []string) {
+	if k == nil {
+		return
+	}
+
+	k.Lock()
+	defer k.Unlock()
+
+	now := time.Now()
+
+	solicited, ok := k.solicited[address]
+	if !ok {
+		solicited = make(map[string]time.Time)
+		k.solicited[address] = solicited
+	}
+
+	// Clear out old requests so this map doesn't grow forever
+	for id, solicitedAt := range solicited {
+		if now.Sub(solicitedAt) >= inventoryRequestTimeout {
+			delete(solicited, id)
+		}
+	}
+
+	for _, id := range ids {
+		solicited[id] = now
+	}
+}
+
+// takeSolicited checks whether we recently asked a peer for the MemPool transaction with an ID, so we only accept transactions we asked for.
+// Each request can only be answered once.
+func (k *knownInventory) takeSolicited(address string, id string) bool {
+	if k == nil {
+		return false
+	}
+
+	k.Lock()
+	defer k.Unlock()
+
+	solicitedAt, ok := k.solicited[address][id]
+	if !ok {
+		return false
+	}
+
+	delete(k.solicited[address], id)
+
+	return time.Since(solicitedAt) < inventoryRequestTimeout
+}
+
+// forget removes everything we know about a peer (used when a peer is evicted).
+func (k *knownInventory) forget(address string) {
+	if k == nil {
+		return
+	}
+
+	k.Lock()
+	defer k.Unlock()
+
+	delete(k.peers, address)
+	delete(k.solicited, address)
+}
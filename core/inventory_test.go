@@ -0,0 +1,60 @@
+package core
+
+import (
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestKnownInventory(t *testing.T) {
+	inventory := newKnownInventory()
+
+	assert.False(t, inventory.isKnown("peer1", "hash1"))
+
+	inventory.markKnown("peer1", "hash1")
+	assert.True(t, inventory.isKnown("peer1", "hash1"))
+	assert.False(t, inventory.isKnown("peer2", "hash1"))
+
+	// Forgetting a peer clears everything we know about it
+	inventory.forget("peer1")
+	assert.False(t, inventory.isKnown("peer1", "hash1"))
+
+	// The oldest hashes are forgotten once a peer's inventory is full
+	for i := 0; i <= maxKnownInventoryPerPeer; i++ {
+		inventory.markKnown("peer1", fmt.Sprint(i))
+	}
+	assert.False(t, inventory.isKnown("peer1", "0"))
+	assert.True(t, inventory.isKnown("peer1", fmt.Sprint(maxKnownInventoryPerPeer)))
+
+	// Nil inventories are safe to use
+	var nilInventory *knownInventory
+	nilInventory.markKnown("peer1", "hash1")
+	assert.False(t, nilInventory.isKnown("peer1", "hash1"))
+}
+
+func TestKnownInventory_MarkRequested(t *testing.T) {
+	inventory := newKnownInventory()
+
+	assert.True(t, inventory.markRequested("hash1"))
+
+	// We shouldn't ask for the same hash twice in a row
+	assert.False(t, inventory.markRequested("hash1"))
+	assert.True(t, inventory.markRequested("hash2"))
+}
+
+func TestKnownInventory_TakeSolicited(t *testing.T) {
+	inventory := newKnownInventory()
+
+	assert.False(t, inventory.takeSolicited("peer1", "id1"))
+
+	inventory.markSolicited("peer1", []string{"id1", "id2"})
+
+	// Only the peer we asked can answer, and only once
+	assert.False(t, inventory.takeSolicited("peer2", "id1"))
+	assert.True(t, inventory.takeSolicited("peer1", "id1"))
+	assert.False(t, inventory.takeSolicited("peer1", "id1"))
+
+	// Forgetting a peer forgets what we asked it for
+	inventory.forget("peer1")
+	assert.False(t, inventory.takeSolicited("peer1", "id2"))
+}
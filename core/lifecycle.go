@@ -0,0 +1,110 @@
+package core
+
+import (
+	"context"
+	"errors"
+	log "github.com/sirupsen/logrus"
+	"sync"
+	"time"
+)
+
+// How long we give the peers we discover on startup to complete their handshakes before running peer consensus.
+const startupConsensusDelay = 3 * time.Second
+
+// lifecycle keeps track of whether a node is running, and lets anything tied to the node's lifetime stop with it.
+type lifecycle struct {
+	sync.Mutex
+
+	started bool
+	cancel  context.CancelFunc // Cancels the context the goroutines started by Start run with
+	done    chan struct{}      // Closed once the node has stopped
+	running sync.WaitGroup     // The goroutines started by Start
+	err     error              // The error from saving our ban list when the node stopped
+}
+
+// Start starts all P2P functions (taking a list of seedNodes), and returns once we are listening for peers.
+// Peer consensus runs in the background. The node runs until ctx is canceled or Stop is called, and can't be started again after that.
+func (l *LocalNode) Start(ctx context.Context, seedNodes []string) error {
+	l.lifecycle.Lock()
+	defer l.lifecycle.Unlock()
+
+	if l.lifecycle.started {
+		return errors.New("this node has already been started")
+	}
+
+	if err := l.startP2P(seedNodes); err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	l.lifecycle.started, l.lifecycle.cancel, l.lifecycle.done = true, cancel, make(chan struct{})
+
+	l.lifecycle.running.Add(2)
+
+	// Shut down once our context is canceled (by whoever started us, or by Stop)
+	go func() {
+		defer l.lifecycle.running.Done()
+
+		<-ctx.Done()
+		l.shutdown()
+	}()
+
+	go func() {
+		defer l.lifecycle.running.Done()
+
+		select {
+		case <-time.After(startupConsensusDelay):
+		case <-ctx.Done():
+			return
+		}
+
+		log.Info("We've started P2P! Now trying to get peer consensus...")
+
+		// Get peer consensus
+		l.GetPeerConsensus()
+
+		log.Info("Got peer consensus over P2P!")
+	}()
+
+	return nil
+}
+
+// Stop stops the node: it cancels mining, closes our P2P node (disconnecting from all peers) and saves our ban list.
+// Anything waiting on Done is told to stop too. It returns once everything Start started has stopped, and is safe to call more than once.
+func (l *LocalNode) Stop() error {
+	l.lifecycle.Lock()
+	if !l.lifecycle.started {
+		l.lifecycle.Unlock()
+		return nil
+	}
+	l.lifecycle.cancel()
+	l.lifecycle.Unlock()
+
+	l.lifecycle.running.Wait()
+
+	return l.lifecycle.err
+}
+
+// shutdown does the work of stopping the node (see Stop). It is only called once, after our context is canceled.
+func (l *LocalNode) shutdown() {
+	log.Warn("Stopping node...")
+
+	// Cancel mining processes
+	l.cancelMining()
+
+	if l.node != nil {
+		l.node.Close()
+	}
+
+	l.lifecycle.err = l.bans.flush()
+
+	close(l.lifecycle.done)
+}
+
+// Done returns a channel that is closed once the node stops. It is never closed if the node was never started.
+func (l *LocalNode) Done() <-chan struct{} {
+	l.lifecycle.Lock()
+	defer l.lifecycle.Unlock()
+
+	return l.lifecycle.done
+}
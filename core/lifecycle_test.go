@@ -0,0 +1,101 @@
+package core
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestLocalNode_StartAndStop(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cosmosis")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	localNode := LocalNode{Chain: []Block{testGenesisBlock}, MemPool: make([]Transaction, 0), UTXO: make(UTXO), ValidationServerURL: validationServer, OperatorPublicKey: "0", MinimumChainsForConsensus: 1, ListenAddress: "127.0.0.1:0", BanListPath: filepath.Join(dir, "bans.json")}
+
+	// Stopping a node that never started does nothing
+	assert.NoError(t, localNode.Stop())
+	assert.Nil(t, localNode.Done())
+
+	// Start doesn't block
+	assert.NoError(t, localNode.Start(context.Background(), nil))
+	assert.NotEmpty(t, localNode.Address())
+	assert.Error(t, localNode.Start(context.Background(), nil))
+
+	atomic.StoreInt32(&localNode.mining, 1)
+	banned := peerKey(newTestPeer(t, "1.2.3.4:7000"))
+	assert.NoError(t, localNode.BanPeer(banned, time.Hour))
+
+	assert.NoError(t, localNode.Stop())
+	assert.NoError(t, localNode.Stop())
+
+	// Mining is canceled, anything waiting on the node is told it stopped, and our ban list is saved
+	assert.False(t, localNode.IsMining())
+
+	select {
+	case <-localNode.Done():
+	default:
+		t.Fatal("Done was not closed after the node stopped.")
+	}
+
+	bans, err := newBanList(localNode.BanListPath)
+	assert.NoError(t, err)
+	assert.True(t, bans.isBanned(banned))
+}
+
+func TestLocalNode_StartWithContext(t *testing.T) {
+	localNode := LocalNode{Chain: []Block{testGenesisBlock}, MemPool: make([]Transaction, 0), UTXO: make(UTXO), ValidationServerURL: validationServer, OperatorPublicKey: "0", MinimumChainsForConsensus: 1, ListenAddress: "127.0.0.1:0"}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	assert.NoError(t, localNode.Start(ctx, nil))
+
+	// Canceling the context stops the node
+	cancel()
+
+	select {
+	case <-localNode.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("The node didn't stop after its context was canceled.")
+	}
+}
+
+func TestLocalNode_StopWhileContextIsCanceled(t *testing.T) {
+	localNode := LocalNode{Chain: []Block{testGenesisBlock}, MemPool: make([]Transaction, 0), UTXO: make(UTXO), ValidationServerURL: validationServer, OperatorPublicKey: "0", MinimumChainsForConsensus: 1, ListenAddress: "127.0.0.1:0"}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	assert.NoError(t, localNode.Start(ctx, nil))
+
+	// Stop can race with our context being canceled (run with -race), and every Stop waits for the node to have stopped
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			assert.NoError(t, localNode.Stop())
+
+			select {
+			case <-localNode.Done():
+			default:
+				t.Error("Stop returned before the node stopped.")
+			}
+		}()
+	}
+
+	cancel()
+	wg.Wait()
+}
+
+func TestLocalNode_StartWithInvalidAddress(t *testing.T) {
+	localNode := LocalNode{Chain: []Block{testGenesisBlock}, MemPool: make([]Transaction, 0), UTXO: make(UTXO), ValidationServerURL: validationServer, OperatorPublicKey: "0", MinimumChainsForConsensus: 1, ListenAddress: "not an address"}
+
+	assert.Error(t, localNode.Start(context.Background(), nil))
+	assert.Nil(t, localNode.Done())
+}
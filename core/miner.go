@@ -0,0 +1,310 @@
+package core
+
+import (
+	"errors"
+	log "github.com/sirupsen/logrus"
+	"sync"
+	"time"
+)
+
+// How old transactions can get before the Miner removes them from the MemPool if Miner.MemPoolExpiry is not set.
+const DefaultMemPoolExpiry = 24 * time.Hour
+
+// How often the Miner checks the MemPool for stale transactions.
+const memPoolExpiryInterval = time.Minute
+
+// How much the MemPool has to grow while we mine before the Miner rebuilds its block if Miner.RefreshGrowth is not set.
+const DefaultRefreshGrowth = 0.25
+
+// A Miner mines blocks from a node's MemPool and adds them to the node's chain. Instead of polling, it reacts to the node's events:
+// it starts mining as soon as the MemPool has enough transactions (see MinimumTransactions and Delay),
+// rebuilds the block it is mining (its template) straight away on top of any new block that arrives,
+// and rebuilds it with new transactions once the MemPool has grown enough (see RefreshGrowth).
+// It also removes stale transactions from the MemPool.
+type Miner struct {
+	MinimumTransactions int           // How many transactions the MemPool needs before we start mining (defaults to 1)
+	Delay               time.Duration // How long we wait once the MemPool has enough transactions before mining, so more transactions can be batched into the block
+	RefreshGrowth       float64       // How many new transactions (as a fraction of the transactions in the block being mined) make us rebuild the block with them (defaults to DefaultRefreshGrowth)
+	MemPoolExpiry       time.Duration // How old transactions can get before they are removed from the MemPool (defaults to DefaultMemPoolExpiry)
+
+	node *LocalNode
+
+	sync.Mutex
+	stop        chan struct{}  // Closed to stop the mining loop (nil while the Miner isn't running)
+	stopped     chan struct{}  // Closed once the mining loop has exited
+	template    *BlockTemplate // The block we are mining (nil if we aren't mining)
+	blocksMined int
+	refreshes   int
+}
+
+// MinerStatus describes what a Miner is doing.
+type MinerStatus struct {
+	Running      bool   // Whether the Miner is started
+	Mining       bool   // Whether the Miner is currently looking for a proof
+	PreviousHash string // The hash of the block the block we are mining builds on
+	Transactions int    // How many transactions are in the block we are mining (including the coinbase transaction)
+	BlocksMined  int    // How many of the Miner's blocks have been added to the chain
+	Refreshes    int    // How many times the Miner has rebuilt the block it was mining (because of a new block or new transactions)
+}
+
+// A miningRound is an attempt at mining one block template.
+type miningRound struct {
+	template *BlockTemplate
+	cancel   chan struct{} // Closed to stop looking for a proof
+	result   chan *Block   // Receives the mined block (or nil if the round was canceled)
+}
+
+// NewMiner creates a Miner for a node. The Miner does nothing until it is started.
+func NewMiner(l *LocalNode) *Miner {
+	if l.events == nil {
+		l.events = newEventFeed()
+	}
+
+	return &Miner{node: l}
+}
+
+// Start starts mining in the background. The Miner stops when Stop is called or when its node stops.
+func (m *Miner) Start() error {
+	m.Lock()
+	defer m.Unlock()
+
+	if m.stop != nil {
+		return errors.New("the miner is already running")
+	}
+
+	m.stop = make(chan struct{})
+	m.stopped = make(chan struct{})
+
+	go m.run(m.node.events.subscribe(), m.stop, m.stopped)
+
+	log.Info("Started mining!")
+
+	return nil
+}
+
+// Stop cancels the block being mined and stops the Miner. It waits for the Miner to finish stopping.
+func (m *Miner) Stop() {
+	m.Lock()
+	stop, stopped := m.stop, m.stopped
+	m.stop, m.stopped = nil, nil
+	m.Unlock()
+
+	if stop == nil {
+		return
+	}
+
+	close(stop)
+	<-stopped
+
+	log.Info("Stopped mining!")
+}
+
+// Status gets what the Miner is doing.
+func (m *Miner) Status() MinerStatus {
+	m.Lock()
+	defer m.Unlock()
+
+	status := MinerStatus{Running: m.stop != nil, Mining: m.template != nil, BlocksMined: m.blocksMined, Refreshes: m.refreshes}
+
+	if m.template != nil {
+		status.PreviousHash = m.template.PreviousHash
+		status.Transactions = len(m.template.Transactions)
+	}
+
+	return status
+}
+
+// run is the Miner's loop. It owns everything about the current round of mining.
+func (m *Miner) run(events chan nodeEvent, stop chan struct{}, stopped chan struct{}) {
+	defer close(stopped)
+	defer m.node.events.unsubscribe(events)
+
+	expiry := time.NewTicker(memPoolExpiryInterval)
+	defer expiry.Stop()
+
+	var delay <-chan time.Time // Fires once we have waited Delay (nil unless we are waiting)
+	var round *miningRound     // The block we are mining (nil unless we are mining)
+	var results chan *Block    // The current round's results (nil unless we are mining)
+	restart := false           // Whether to start a new round straight away once the current one ends
+
+	// Start a round of mining (after Delay) if the MemPool has enough transactions
+	schedule := func() {
+		if len(m.node.Snapshot().MemPool) < m.minimumTransactions() || delay != nil {
+			return
+		}
+
+		if m.Delay > 0 {
+			delay = time.After(m.Delay)
+		} else {
+			round, results = m.mine()
+		}
+	}
+
+	schedule()
+
+	for {
+		select {
+		case <-stop:
+			m.cancel(round)
+			return
+
+		case <-m.node.Done():
+			m.cancel(round)
+
+			// Nobody is going to call Stop for us, so mark ourselves as stopped
+			m.Lock()
+			if m.stop == stop {
+				m.stop, m.stopped = nil, nil
+			}
+			m.Unlock()
+
+			return
+
+		case event := <-events:
+			if round == nil {
+				schedule()
+				break
+			}
+
+			// Rebuild the block we are mining if it no longer builds on our last block, or the MemPool has grown enough
+			if !restart && (event == tipChanged && round.template.PreviousHash != LastBlock(m.node.Snapshot().Chain).hash() || event == memPoolChanged && m.shouldRefresh(round.template)) {
+				log.Info("Our block template is out of date. Rebuilding it...")
+
+				restart = true
+				close(round.cancel)
+			}
+
+		case <-delay:
+			delay = nil
+
+			if len(m.node.Snapshot().MemPool) >= m.minimumTransactions() {
+				round, results = m.mine()
+			}
+
+		case block := <-results:
+			round, results = nil, nil
+			m.setTemplate(nil)
+
+			if block != nil {
+				m.submit(*block)
+			}
+
+			if restart {
+				restart = false
+
+				m.Lock()
+				m.refreshes++
+				m.Unlock()
+
+				if len(m.node.Snapshot().MemPool) >= m.minimumTransactions() {
+					round, results = m.mine()
+				}
+			}
+
+		case <-expiry.C:
+			m.node.RemoveStaleTransactions(m.memPoolExpiry())
+
+			// Transactions locked until a time may have unlocked
+			if round == nil {
+				schedule()
+			}
+		}
+	}
+}
+
+// shouldRefresh checks whether enough transactions have arrived since a template was built for it to be worth rebuilding.
+func (m *Miner) shouldRefresh(template *BlockTemplate) bool {
+	newTransactions := len(MissingTransactionIDs(TransactionIDs(m.node.Snapshot().MemPool), template.Transactions))
+
+	growth := m.RefreshGrowth
+	if growth == 0 {
+		growth = DefaultRefreshGrowth
+	}
+
+	// The coinbase transaction doesn't count
+	return newTransactions > 0 && float64(newTransactions) >= growth*float64(len(template.Transactions)-1)
+}
+
+// mine builds a block template from a snapshot of our chain and MemPool, and starts looking for its proof in the background.
+// The block (or nil if the round was canceled) is sent on the round's result channel. It returns nil if there is nothing to mine.
+func (m *Miner) mine() (*miningRound, chan *Block) {
+	template := m.node.NewBlockTemplate()
+	if template == nil {
+		log.Warn("There are no valid transactions in our MemPool to mine.")
+		return nil, nil
+	}
+
+	log.Infof("Starting to mine a block with %d transactions...", len(template.Transactions))
+
+	round := &miningRound{template: template, cancel: make(chan struct{}), result: make(chan *Block, 1)}
+	m.setTemplate(template)
+
+	go func() {
+		round.result <- template.Mine(func() bool {
+			select {
+			case <-round.cancel:
+				return true
+			default:
+				return false
+			}
+		})
+	}()
+
+	return round, round.result
+}
+
+// cancel cancels a round of mining (if there is one) and waits for it to end.
+func (m *Miner) cancel(round *miningRound) {
+	if round == nil {
+		return
+	}
+
+	select {
+	case <-round.cancel:
+	default:
+		close(round.cancel)
+	}
+
+	<-round.result
+	m.setTemplate(nil)
+}
+
+// submit adds a block we mined to our chain and tells our peers about it.
+func (m *Miner) submit(block Block) {
+	// If mined block was valid and added to chain:
+	if m.node.AddMinedBlockToChain(block) {
+		// Alert all other nodes of our new valid block.
+		m.node.BroadcastBlock(block)
+
+		m.Lock()
+		m.blocksMined++
+		m.Unlock()
+
+		log.Info("We just mined a new block and added it to the chain!")
+	} else {
+		log.Warn("The block we just mined was not valid! It was not added to the chain and the UTXO was not updated!")
+	}
+}
+
+func (m *Miner) setTemplate(template *BlockTemplate) {
+	m.Lock()
+	defer m.Unlock()
+
+	m.template = template
+}
+
+func (m *Miner) minimumTransactions() int {
+	if m.MinimumTransactions < 1 {
+		return 1
+	}
+
+	return m.MinimumTransactions
+}
+
+func (m *Miner) memPoolExpiry() time.Duration {
+	if m.MemPoolExpiry == 0 {
+		return DefaultMemPoolExpiry
+	}
+
+	return m.MemPoolExpiry
+}
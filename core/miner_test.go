@@ -0,0 +1,174 @@
+package core
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+// How long we give a Miner to mine a block (difficulty 5 usually takes a few seconds).
+const miningTimeout = 2 * time.Minute
+
+func newTestMinerNode(validationServerURL string) *LocalNode {
+	return &LocalNode{Chain: []Block{testGenesisBlock}, MemPool: make([]Transaction, 0), UTXO: UTXO{testGenesisBlock.Transactions[0].Recipient: {Spendable: testGenesisBlock.Transactions[0].Amount}}, ValidationServerURL: validationServerURL, OperatorPublicKey: "miner", MinimumChainsForConsensus: 1}
+}
+
+func TestMiner_StartAndStop(t *testing.T) {
+	miner := NewMiner(newTestMinerNode(validationServer))
+	assert.Equal(t, MinerStatus{}, miner.Status())
+
+	assert.NoError(t, miner.Start())
+	assert.Error(t, miner.Start())
+	assert.True(t, miner.Status().Running)
+
+	miner.Stop()
+	miner.Stop()
+	assert.False(t, miner.Status().Running)
+
+	// It can be started again
+	assert.NoError(t, miner.Start())
+	miner.Stop()
+}
+
+func TestMiner_MinesNewTransactions(t *testing.T) {
+	fakeValidationServer := newFakeValidationServer(true)
+	defer fakeValidationServer.Close()
+
+	node := newTestMinerNode(fakeValidationServer.URL)
+	miner := NewMiner(node)
+	assert.NoError(t, miner.Start())
+	defer miner.Stop()
+
+	// Nothing to mine yet
+	time.Sleep(50 * time.Millisecond)
+	assert.False(t, miner.Status().Mining)
+
+	// The miner starts as soon as a transaction arrives
+	assert.True(t, node.AddTransactionToMemPool(harnessBlock1.Transactions[1]))
+
+	assert.Eventually(t, func() bool { return miner.Status().BlocksMined == 1 }, miningTimeout, 50*time.Millisecond)
+	assert.Eventually(t, func() bool { return !miner.Status().Mining }, time.Second, 10*time.Millisecond)
+
+	state := node.Snapshot()
+	assert.Len(t, state.Chain, 2)
+	assert.Equal(t, harnessBlock1.Transactions[1], state.Chain[1].Transactions[1])
+	assert.Equal(t, coinbaseReward, state.UTXO.ImmatureBalance("miner"))
+	assert.Empty(t, state.MemPool)
+}
+
+func TestMiner_MinimumTransactionsAndDelay(t *testing.T) {
+	fakeValidationServer := newFakeValidationServer(true)
+	defer fakeValidationServer.Close()
+
+	node := newTestMinerNode(fakeValidationServer.URL)
+	miner := NewMiner(node)
+	miner.MinimumTransactions = 2
+	miner.Delay = 200 * time.Millisecond
+	assert.NoError(t, miner.Start())
+	defer miner.Stop()
+
+	// Not enough transactions
+	assert.True(t, node.AddTransactionToMemPool(harnessBlock1.Transactions[1]))
+	time.Sleep(300 * time.Millisecond)
+	assert.False(t, miner.Status().Mining)
+
+	// Enough transactions, but we wait for more first
+	assert.True(t, node.AddTransactionToMemPool(harnessBlock2.Transactions[1]))
+	time.Sleep(50 * time.Millisecond)
+	assert.False(t, miner.Status().Mining)
+
+	assert.Eventually(t, func() bool { return miner.Status().Mining }, time.Second, 10*time.Millisecond)
+
+	// Stopping cancels the block being mined
+	miner.Stop()
+	assert.False(t, miner.Status().Mining)
+	assert.Len(t, node.Snapshot().Chain, 1)
+}
+
+func TestMiner_StopsWithNode(t *testing.T) {
+	node := newTestMinerNode(validationServer)
+	node.ListenAddress = "127.0.0.1:0"
+
+	miner := NewMiner(node)
+	assert.NoError(t, node.Start(context.Background(), nil))
+	assert.NoError(t, miner.Start())
+
+	node.Stop()
+
+	assert.Eventually(t, func() bool { return !miner.Status().Running }, time.Second, 10*time.Millisecond)
+}
+
+func TestLocalNode_RemoveStaleTransactions(t *testing.T) {
+	localNode := newTestMinerNode(validationServer)
+
+	fresh := Transaction{Sender: "a", Recipient: "b", Amount: 1, Timestamp: time.Now().Unix(), Signature: "fresh"}
+	stale := Transaction{Sender: "a", Recipient: "b", Amount: 1, Timestamp: time.Now().Add(-25 * time.Hour).Unix(), Signature: "stale"}
+	localNode.MemPool = []Transaction{stale, fresh, stale}
+
+	localNode.RemoveStaleTransactions(DefaultMemPoolExpiry)
+	assert.Equal(t, []Transaction{fresh}, localNode.MemPool)
+}
+
+func TestMiner_RefreshesOnNewTip(t *testing.T) {
+	fakeValidationServer := newFakeValidationServer(true)
+	defer fakeValidationServer.Close()
+
+	node := newTestMinerNode(fakeValidationServer.URL)
+	miner := NewMiner(node)
+	assert.NoError(t, miner.Start())
+	defer miner.Stop()
+
+	assert.True(t, node.AddTransactionToMemPool(harnessBlock2.Transactions[1]))
+	assert.Eventually(t, func() bool { return miner.Status().Mining }, time.Second, time.Millisecond)
+	assert.Equal(t, testGenesisBlock.hash(), miner.Status().PreviousHash)
+
+	// A peer's block arrives while we are mining (NOTE: this can be flaky if we happen to mine our block first)
+	assert.True(t, node.AddMinedBlockToChain(harnessBlock1))
+
+	// We start mining on top of it straight away, with the transaction it didn't include
+	assert.Eventually(t, func() bool { return miner.Status().PreviousHash == harnessBlock1.hash() }, time.Second, time.Millisecond)
+	assert.Equal(t, 1, miner.Status().Refreshes)
+	assert.Equal(t, 2, miner.Status().Transactions)
+}
+
+func TestMiner_RefreshesOnMemPoolGrowth(t *testing.T) {
+	fakeValidationServer := newFakeValidationServer(true)
+	defer fakeValidationServer.Close()
+
+	node := newTestMinerNode(fakeValidationServer.URL)
+	miner := NewMiner(node)
+	miner.RefreshGrowth = 1
+	assert.NoError(t, miner.Start())
+	defer miner.Stop()
+
+	assert.True(t, node.AddTransactionToMemPool(harnessBlock1.Transactions[1]))
+	assert.Eventually(t, func() bool { return miner.Status().Transactions == 2 }, time.Second, time.Millisecond)
+
+	// The MemPool doubled, so we rebuild our block with the new transaction in it (NOTE: this can be flaky if we happen to mine our block first)
+	assert.True(t, node.AddTransactionToMemPool(harnessBlock2.Transactions[1]))
+	assert.Eventually(t, func() bool { return miner.Status().Transactions == 3 }, time.Second, time.Millisecond)
+	assert.Equal(t, 1, miner.Status().Refreshes)
+}
+
+func TestMiner_ShouldRefresh(t *testing.T) {
+	node := newTestMinerNode(validationServer)
+	miner := NewMiner(node)
+	miner.RefreshGrowth = 0.5
+
+	coinbase := Transaction{Sender: "0", Recipient: "miner", Amount: coinbaseReward, Timestamp: 0, Signature: ""}
+	transactions := []Transaction{harnessBlock1.Transactions[1], harnessBlock2.Transactions[1], harnessForkBlock.Transactions[1]}
+	template := &BlockTemplate{BlockHeader: BlockHeader{Transactions: append([]Transaction{coinbase}, transactions...)}}
+
+	// Nothing new
+	node.MemPool = transactions
+	assert.False(t, miner.shouldRefresh(template))
+
+	// One new transaction is less than half of three
+	node.MemPool = append(transactions, Transaction{Signature: "new1"})
+	assert.False(t, miner.shouldRefresh(template))
+
+	// Two is more than half
+	node.MemPool = append(node.MemPool, Transaction{Signature: "new2"})
+	assert.True(t, miner.shouldRefresh(template))
+}
@@ -0,0 +1,143 @@
+package core
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// The version byte at the start of every multisig address (so they can't be mistaken for the address of a single key).
+const MultisigAddressVersion byte = 0x1d
+
+// The most keys a multisig account can have (each signature costs a call to the validation server).
+const MaxMultisigKeys = 16
+
+// A MultisigAccount is an account made of n public keys, that can only spend coins when at least Threshold (m) of them sign.
+// Coins are sent to its address, and transactions from it set Sender to its address, Multisig to the account, and Signatures to its keys' signatures.
+type MultisigAccount struct {
+	Threshold  int      // How many of the keys need to sign (m)
+	PublicKeys []string // The keys that can sign (n)
+}
+
+// Creates a multisig account from a threshold and its public keys. The keys are canonicalized and sorted,
+// so the same keys give the same account (and signatures go in the same order) whatever order they are listed in.
+func NewMultisigAccount(threshold int, publicKeys []string) (MultisigAccount, error) {
+	account := MultisigAccount{Threshold: threshold, PublicKeys: make([]string, 0, len(publicKeys))}
+
+	for _, publicKey := range publicKeys {
+		canonical, err := CanonicalPublicKey(publicKey)
+		if err != nil {
+			return MultisigAccount{}, err
+		}
+
+		account.PublicKeys = append(account.PublicKeys, canonical)
+	}
+
+	sort.Strings(account.PublicKeys)
+
+	if err := account.validate(); err != nil {
+		return MultisigAccount{}, err
+	}
+
+	return account, nil
+}
+
+// Gets the address of a multisig account: like the address of a key, but with MultisigAddressVersion and a hash of its threshold and (sorted, canonical) keys.
+func (m MultisigAccount) Address() (string, error) {
+	if err := m.validate(); err != nil {
+		return "", err
+	}
+
+	publicKeys := make([]string, 0, len(m.PublicKeys))
+	for _, publicKey := range m.PublicKeys {
+		// Already checked by validate
+		canonical, _ := CanonicalPublicKey(publicKey)
+		publicKeys = append(publicKeys, canonical)
+	}
+
+	sort.Strings(publicKeys)
+
+	data := []byte{byte(m.Threshold)}
+	for _, publicKey := range publicKeys {
+		key, _ := hex.DecodeString(publicKey)
+		data = append(data, key...)
+	}
+
+	return encodeAddress(MultisigAddressVersion, data), nil
+}
+
+// Checks that a multisig account has between 1 and MaxMultisigKeys distinct valid keys, and a threshold between 1 and its number of keys.
+func (m MultisigAccount) validate() error {
+	if len(m.PublicKeys) == 0 || len(m.PublicKeys) > MaxMultisigKeys {
+		return fmt.Errorf("multisig accounts must have between 1 and %d keys (got %d)", MaxMultisigKeys, len(m.PublicKeys))
+	}
+
+	if m.Threshold < 1 || m.Threshold > len(m.PublicKeys) {
+		return fmt.Errorf("the threshold must be between 1 and the number of keys (%d), got %d", len(m.PublicKeys), m.Threshold)
+	}
+
+	seen := make(map[string]bool, len(m.PublicKeys))
+	for _, publicKey := range m.PublicKeys {
+		canonical, err := CanonicalPublicKey(publicKey)
+		if err != nil {
+			return err
+		}
+
+		if seen[canonical] {
+			return errors.New("multisig accounts can't have the same key twice")
+		}
+
+		seen[canonical] = true
+	}
+
+	return nil
+}
+
+// Checks whether a string is a multisig address with a valid version and checksum.
+func IsMultisigAddress(address string) bool {
+	return isAddressWithVersion(address, MultisigAddressVersion)
+}
+
+// Checks whether a transaction is from a multisig account.
+func (t Transaction) isMultisig() bool {
+	return t.Multisig.Threshold != 0 || len(t.Multisig.PublicKeys) != 0
+}
+
+// Gets what identifies a transaction when checking whether it was already made (so it can't be replayed).
+// That is a transaction's signature, or for multisig transactions, the message its keys sign
+// (so the same payment can't be made again with a different set of signatures).
+func (t Transaction) replayID() string {
+	if t.isMultisig() {
+		return "multisig:" + TransactionRepresentation(t)
+	}
+
+	return t.Signature
+}
+
+// Checks that a transaction's Sender is the address of its Multisig account, and that at least Threshold of its keys signed it.
+// Every signature has to be valid (keys that didn't sign have an empty signature).
+// It returns an error if the validation server couldn't tell us whether a signature is valid.
+func validateMultisigSignatures(transaction Transaction, validationServerURL string) (bool, error) {
+	address, err := transaction.Multisig.Address()
+	if err != nil || address != transaction.Sender || transaction.Signature != "" || len(transaction.Signatures) != len(transaction.Multisig.PublicKeys) {
+		return false, nil
+	}
+
+	transactionRepresentation := TransactionRepresentation(transaction)
+
+	signed := 0
+	for i, signature := range transaction.Signatures {
+		if signature == "" {
+			continue
+		}
+
+		if valid, err := validateSignature(signature, transactionRepresentation, transaction.Multisig.PublicKeys[i], validationServerURL); !valid {
+			return false, err
+		}
+
+		signed++
+	}
+
+	return signed >= transaction.Multisig.Threshold, nil
+}
@@ -0,0 +1,188 @@
+package core
+
+import (
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// Three valid public keys (from the test fixtures).
+var multisigTestKeys = []string{
+	testGenesisBlock.Transactions[0].Recipient,
+	harnessRecipient,
+	"04500bdac952ec32d5031d6f540e2be9d4ff0d0add0b380b56f452ce5d86e713b78ff4d04a6d4bec5b61759b1d0b588a5ea7b720fb4e245036bfcd00d792fd0094",
+}
+
+// newMultisigValidationServer creates a fake validation server that only accepts signatures of the form "signed by KEY".
+func newMultisigValidationServer() *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var request map[string]string
+		json.NewDecoder(r.Body).Decode(&request)
+
+		w.Header().Set("Content-Type", "application/json")
+		if request["signature"] == "signed by "+request["publicKey"] {
+			w.Write([]byte(`{"valid_signature": true}`))
+		} else {
+			w.Write([]byte(`{"valid_signature": false}`))
+		}
+	}))
+}
+
+func TestNewMultisigAccount(t *testing.T) {
+	account, err := NewMultisigAccount(2, multisigTestKeys)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, account.Threshold)
+	assert.Len(t, account.PublicKeys, 3)
+
+	address, err := account.Address()
+	assert.NoError(t, err)
+	assert.True(t, IsMultisigAddress(address))
+	assert.False(t, IsAddress(address))
+	assert.True(t, IsValidRecipient(address))
+
+	// The same keys in a different order (or form) are the same account
+	reordered, err := NewMultisigAccount(2, []string{multisigTestKeys[2], testGenesisCompressedKey, multisigTestKeys[1]})
+	assert.NoError(t, err)
+	assert.Equal(t, account, reordered)
+
+	unsorted := MultisigAccount{Threshold: 2, PublicKeys: []string{multisigTestKeys[2], multisigTestKeys[0], multisigTestKeys[1]}}
+	unsortedAddress, err := unsorted.Address()
+	assert.NoError(t, err)
+	assert.Equal(t, address, unsortedAddress)
+
+	// A different threshold is a different account
+	other, err := NewMultisigAccount(3, multisigTestKeys)
+	assert.NoError(t, err)
+	otherAddress, err := other.Address()
+	assert.NoError(t, err)
+	assert.NotEqual(t, address, otherAddress)
+
+	// Invalid accounts
+	_, err = NewMultisigAccount(0, multisigTestKeys)
+	assert.Error(t, err)
+
+	_, err = NewMultisigAccount(4, multisigTestKeys)
+	assert.Error(t, err)
+
+	_, err = NewMultisigAccount(1, nil)
+	assert.Error(t, err)
+
+	_, err = NewMultisigAccount(1, []string{multisigTestKeys[0], testGenesisCompressedKey})
+	assert.Error(t, err)
+
+	_, err = NewMultisigAccount(1, []string{multisigTestKeys[0], "miner"})
+	assert.Error(t, err)
+
+	_, err = NewMultisigAccount(1, make([]string, MaxMultisigKeys+1))
+	assert.Error(t, err)
+}
+
+func TestValidateMultisigSignatures(t *testing.T) {
+	validationServer := newMultisigValidationServer()
+	defer validationServer.Close()
+
+	account, err := NewMultisigAccount(2, multisigTestKeys)
+	assert.NoError(t, err)
+	address, err := account.Address()
+	assert.NoError(t, err)
+
+	transaction := Transaction{Sender: address, Recipient: harnessRecipient, Amount: 10, Timestamp: 1586200000, Multisig: account, Signatures: make([]string, 3)}
+	signed := func(signers ...int) Transaction {
+		signedTransaction := transaction
+		signedTransaction.Signatures = make([]string, 3)
+		for _, signer := range signers {
+			signedTransaction.Signatures[signer] = "signed by " + account.PublicKeys[signer]
+		}
+
+		return signedTransaction
+	}
+
+	// 2 of 3 keys need to sign
+	assert.True(t, ValidateTransactionSignatures(signed(0, 2), validationServer.URL))
+	assert.True(t, ValidateTransactionSignatures(signed(0, 1, 2), validationServer.URL))
+	assert.False(t, ValidateTransactionSignatures(signed(1), validationServer.URL))
+	assert.False(t, ValidateTransactionSignatures(signed(), validationServer.URL))
+
+	// Every signature has to be valid
+	invalid := signed(0, 1)
+	invalid.Signatures[2] = "forged"
+	assert.False(t, ValidateTransactionSignatures(invalid, validationServer.URL))
+
+	// Signatures go in the same order as the keys
+	swapped := signed(0, 1)
+	swapped.Signatures[0], swapped.Signatures[1] = swapped.Signatures[1], swapped.Signatures[0]
+	assert.False(t, ValidateTransactionSignatures(swapped, validationServer.URL))
+
+	// The sender has to be the account's address
+	wrongSender := signed(0, 1)
+	wrongSender.Sender = testGenesisAddress
+	assert.False(t, ValidateTransactionSignatures(wrongSender, validationServer.URL))
+
+	// A different account can't spend from the address
+	lowerThreshold := signed(0)
+	lowerThreshold.Multisig.Threshold = 1
+	assert.False(t, ValidateTransactionSignatures(lowerThreshold, validationServer.URL))
+
+	wrongCount := signed(0, 1)
+	wrongCount.Signatures = wrongCount.Signatures[:2]
+	assert.False(t, ValidateTransactionSignatures(wrongCount, validationServer.URL))
+
+	withSignature := signed(0, 1)
+	withSignature.Signature = "signed by " + account.PublicKeys[0]
+	assert.False(t, ValidateTransactionSignatures(withSignature, validationServer.URL))
+
+	// Single key transactions can't carry multisig signatures
+	single := Transaction{Sender: multisigTestKeys[0], Recipient: harnessRecipient, Amount: 10, Signature: "signed by " + multisigTestKeys[0], Signatures: []string{"signed by " + multisigTestKeys[0]}}
+	assert.False(t, ValidateTransactionSignatures(single, validationServer.URL))
+	single.Signatures = nil
+	assert.True(t, ValidateTransactionSignatures(single, validationServer.URL))
+}
+
+func TestValidateTransaction_Multisig(t *testing.T) {
+	validationServer := newMultisigValidationServer()
+	defer validationServer.Close()
+
+	account, err := NewMultisigAccount(1, multisigTestKeys[:2])
+	assert.NoError(t, err)
+	address, err := account.Address()
+	assert.NoError(t, err)
+
+	transaction := Transaction{Sender: address, Recipient: harnessRecipient, Amount: 10, Timestamp: 1586200000, Multisig: account, Signatures: []string{"", "signed by " + account.PublicKeys[1]}}
+
+	// The coins have to be sent to the multisig address first
+	assert.False(t, ValidateTransaction(transaction, UTXO{multisigTestKeys[0]: {Spendable: 100}}, validationServer.URL))
+	assert.True(t, ValidateTransaction(transaction, UTXO{address: {Spendable: 10}}, validationServer.URL))
+	assert.False(t, ValidateTransaction(transaction, UTXO{address: {Spendable: 9}}, validationServer.URL))
+
+	utxo := UTXO{address: {Spendable: 10}}
+	utxo.debit(transaction.Sender, transaction.Amount)
+	utxo.credit(transaction.Recipient, transaction.Amount)
+	assert.Equal(t, UTXO{address: {Spendable: 0}, harnessRecipient: {Spendable: 10}}, utxo)
+}
+
+func TestTransaction_MultisigReplay(t *testing.T) {
+	account, err := NewMultisigAccount(1, multisigTestKeys)
+	assert.NoError(t, err)
+	address, err := account.Address()
+	assert.NoError(t, err)
+
+	transaction := Transaction{Sender: address, Recipient: harnessRecipient, Amount: 10, Timestamp: 1586200000, Multisig: account, Signatures: []string{"a", "", ""}}
+
+	// The same payment signed by a different key is still the same payment
+	resigned := transaction
+	resigned.Signatures = []string{"", "b", ""}
+	assert.True(t, IsTransactionInMemPool(resigned, []Transaction{transaction}))
+	assert.True(t, IsTransactionInChain(resigned, []Block{{BlockHeader: BlockHeader{Transactions: []Transaction{transaction}}}}))
+
+	// But a different payment isn't
+	different := transaction
+	different.Timestamp++
+	assert.False(t, IsTransactionInMemPool(different, []Transaction{transaction}))
+
+	// Multisig transactions are hashed with their account and signatures
+	assert.NotEqual(t, transaction.hash(), resigned.hash())
+	assert.True(t, strings.Contains(transaction.String(), account.PublicKeys[0]))
+}
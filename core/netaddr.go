@@ -0,0 +1,153 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// The port we listen for peers on if LocalNode.ListenAddress is not set. Seed nodes without a port are assumed to use it too.
+var PortP2P uint16 = 7000
+
+// listenAddress gets the host:port we listen for peers on (defaults to all interfaces on PortP2P).
+func (l *LocalNode) listenAddress() string {
+	if l.ListenAddress == "" {
+		return net.JoinHostPort("", strconv.Itoa(int(PortP2P)))
+	}
+
+	return l.ListenAddress
+}
+
+// listenHostPort splits our listen address into the IP and port we bind to.
+// An empty host means all interfaces, and port 0 means the OS picks a free port.
+func (l *LocalNode) listenHostPort() (net.IP, uint16, error) {
+	host, portString, err := net.SplitHostPort(l.listenAddress())
+	if err != nil {
+		return nil, 0, err
+	}
+
+	port, err := strconv.ParseUint(portString, 10, 16)
+	if err != nil {
+		return nil, 0, fmt.Errorf("invalid port %q", portString)
+	}
+
+	if host == "" {
+		return nil, uint16(port), nil
+	}
+
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return nil, 0, fmt.Errorf("invalid IP %q (the listen host must be an IP address)", host)
+	}
+
+	return ip, uint16(port), nil
+}
+
+// advertisedAddress gets the address we tell peers to reach us on. An empty address means we advertise the address we bind to.
+// If AdvertisedAddress is not set and we bind to all interfaces, we advertise our outbound IP (if we can find it).
+func (l *LocalNode) advertisedAddress(listenHost net.IP, listenPort uint16) (string, error) {
+	if l.AdvertisedAddress != "" {
+		address, err := ParseNodeAddress(l.AdvertisedAddress)
+		if err != nil {
+			return "", err
+		}
+
+		// Noise can't advertise a loopback IP, but the address it advertises for a loopback bind (":port") reaches us locally anyway.
+		if host, _, _ := net.SplitHostPort(address); net.ParseIP(host) != nil && net.ParseIP(host).IsLoopback() {
+			return "", nil
+		}
+
+		return address, nil
+	}
+
+	// We bind to a specific IP, or a random port (which we only know once we start listening).
+	if (listenHost != nil && !listenHost.IsUnspecified()) || listenPort == 0 {
+		return "", nil
+	}
+
+	ip, err := GetOutboundIP()
+	if err != nil {
+		// We can still talk to peers on this machine (or ones that can reach us another way).
+		return "", nil
+	}
+
+	return net.JoinHostPort(ip.String(), strconv.Itoa(int(listenPort))), nil
+}
+
+// Address gets the address peers reach this node on (empty if we haven't started P2P).
+func (l *LocalNode) Address() string {
+	if l.node == nil {
+		return ""
+	}
+
+	return l.node.Addr()
+}
+
+// PeerKey gets the key peers keep our score and ban under (empty if we haven't started P2P). Peers are banned by their PeerKey.
+func (l *LocalNode) PeerKey() string {
+	if l.node == nil {
+		return ""
+	}
+
+	return peerKey(l.node.ID())
+}
+
+// ParseNodeAddress checks a node's address, adding PortP2P if it doesn't have a port. Addresses can be host or host:port
+// (IPv6 hosts with a port need brackets, like [::1]:7000).
+func ParseNodeAddress(address string) (string, error) {
+	address = strings.TrimSpace(address)
+	if address == "" {
+		return "", errors.New("address is empty")
+	}
+
+	host, portString, err := net.SplitHostPort(address)
+	if err != nil {
+		// It doesn't have a port (or is an IPv6 IP without brackets)
+		host, portString = strings.Trim(address, "[]"), strconv.Itoa(int(PortP2P))
+	}
+
+	if host == "" {
+		return "", fmt.Errorf("address %q has no host", address)
+	}
+
+	if port, err := strconv.ParseUint(portString, 10, 16); err != nil || port == 0 {
+		return "", fmt.Errorf("address %q has an invalid port", address)
+	}
+
+	return net.JoinHostPort(host, portString), nil
+}
+
+// ParseSeedNodes parses a comma separated list of seed node addresses (see ParseNodeAddress).
+func ParseSeedNodes(raw string) ([]string, error) {
+	seedNodes := make([]string, 0)
+
+	if strings.TrimSpace(raw) == "" {
+		return seedNodes, nil
+	}
+
+	for _, address := range strings.Split(raw, ",") {
+		seedNode, err := ParseNodeAddress(address)
+		if err != nil {
+			return nil, err
+		}
+
+		seedNodes = append(seedNodes, seedNode)
+	}
+
+	return seedNodes, nil
+}
+
+// Get preferred outbound ip of this machine. This returns an error if we can't reach the internet.
+func GetOutboundIP() (net.IP, error) {
+	conn, err := net.Dial("udp", "8.8.8.8:80")
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	localAddr := conn.LocalAddr().(*net.UDPAddr)
+
+	return localAddr.IP, nil
+}
@@ -0,0 +1,93 @@
+package core
+
+import (
+	"github.com/stretchr/testify/assert"
+	"net"
+	"testing"
+)
+
+func TestParseNodeAddress(t *testing.T) {
+	valid := map[string]string{
+		"75.82.156.254":       "75.82.156.254:7000",
+		"75.82.156.254:7001":  "75.82.156.254:7001",
+		" 75.82.156.254:7001": "75.82.156.254:7001",
+		"seed.example.com":    "seed.example.com:7000",
+		"localhost:9999":      "localhost:9999",
+		"::1":                 "[::1]:7000",
+		"[::1]:7001":          "[::1]:7001",
+	}
+
+	for address, expected := range valid {
+		parsed, err := ParseNodeAddress(address)
+		assert.NoError(t, err, address)
+		assert.Equal(t, expected, parsed)
+	}
+
+	for _, address := range []string{"", " ", ":7000", "75.82.156.254:", "75.82.156.254:port", "75.82.156.254:70000", "75.82.156.254:0"} {
+		_, err := ParseNodeAddress(address)
+		assert.Error(t, err, address)
+	}
+}
+
+func TestParseSeedNodes(t *testing.T) {
+	seedNodes, err := ParseSeedNodes("")
+	assert.NoError(t, err)
+	assert.Empty(t, seedNodes)
+
+	seedNodes, err = ParseSeedNodes("75.82.156.254, 25.92.256.254:7001")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"75.82.156.254:7000", "25.92.256.254:7001"}, seedNodes)
+
+	_, err = ParseSeedNodes("75.82.156.254,,25.92.256.254")
+	assert.Error(t, err)
+}
+
+func TestLocalNode_ListenHostPort(t *testing.T) {
+	localNode := LocalNode{}
+
+	// Defaults to all interfaces on PortP2P
+	host, port, err := localNode.listenHostPort()
+	assert.NoError(t, err)
+	assert.Nil(t, host)
+	assert.Equal(t, PortP2P, port)
+
+	localNode.ListenAddress = "127.0.0.1:0"
+	host, port, err = localNode.listenHostPort()
+	assert.NoError(t, err)
+	assert.Equal(t, net.ParseIP("127.0.0.1"), host)
+	assert.Equal(t, uint16(0), port)
+
+	for _, address := range []string{"127.0.0.1", "localhost:7000", "127.0.0.1:70000"} {
+		localNode.ListenAddress = address
+		_, _, err = localNode.listenHostPort()
+		assert.Error(t, err, address)
+	}
+}
+
+func TestLocalNode_AdvertisedAddress(t *testing.T) {
+	localNode := LocalNode{AdvertisedAddress: "75.82.156.254"}
+
+	address, err := localNode.advertisedAddress(nil, 7001)
+	assert.NoError(t, err)
+	assert.Equal(t, "75.82.156.254:7000", address)
+
+	// Loopback addresses are left to noise
+	localNode.AdvertisedAddress = "127.0.0.1:7001"
+	address, err = localNode.advertisedAddress(nil, 7001)
+	assert.NoError(t, err)
+	assert.Empty(t, address)
+
+	localNode.AdvertisedAddress = "75.82.156.254:port"
+	_, err = localNode.advertisedAddress(nil, 7001)
+	assert.Error(t, err)
+
+	// Nodes bound to a specific IP (or a random port) advertise the address they bind to
+	localNode.AdvertisedAddress = ""
+	address, err = localNode.advertisedAddress(net.ParseIP("127.0.0.1"), 7001)
+	assert.NoError(t, err)
+	assert.Empty(t, address)
+
+	address, err = localNode.advertisedAddress(nil, 0)
+	assert.NoError(t, err)
+	assert.Empty(t, address)
+}
@@ -0,0 +1,323 @@
+package core
+
+import (
+	"github.com/perlin-network/noise"
+	log "github.com/sirupsen/logrus"
+	"sync"
+	"time"
+)
+
+// The max number of blocks with unknown parents we hold on to at once.
+const maxOrphanBlocks = 100
+
+// The max number of blocks with unknown parents we hold on to from any one peer, so one peer can't fill the pool.
+const maxOrphansPerPeer = 25
+
+// How long we hold on to a block with an unknown parent before giving up on its parent ever arriving.
+const orphanBlockExpiry = 10 * time.Minute
+
+// How much lower than the difficulty of the next block on our chain the difficulty of a block with an unknown parent can be.
+// Each step is 16 times less work, so this only allows for its chain's difficulty having changed a little since it forked off ours.
+const orphanDifficultySlack = 1
+
+// An orphanBlock is a block whose parent we don't have yet, along with the peer that gave it to us.
+type orphanBlock struct {
+	block    Block
+	from     noise.ID  // The peer that gave us this block (we fetch its missing ancestors from them)
+	received time.Time // When we got this block (so it can expire)
+}
+
+// orphanPool stores blocks that arrived before their parents, so they can be connected once the parents arrive.
+type orphanPool struct {
+	sync.Mutex
+
+	orphans map[string]orphanBlock // Block hash -> orphan
+}
+
+func newOrphanPool() *orphanPool {
+	return &orphanPool{orphans: make(map[string]orphanBlock)}
+}
+
+// add stores a block with an unknown parent. It returns false if the block was already in the pool, or the peer
+// already gave us maxOrphansPerPeer orphans. Expired orphans are removed, and if the pool is full the oldest orphan is evicted to make room.
+func (o *orphanPool) add(block Block, from noise.ID) bool {
+	if o == nil {
+		return false
+	}
+
+	o.Lock()
+	defer o.Unlock()
+
+	hash := block.hash()
+	if _, ok := o.orphans[hash]; ok {
+		return false
+	}
+
+	o.removeExpired()
+
+	fromPeer := 0
+	for _, orphan := range o.orphans {
+		if peerKey(orphan.from) == peerKey(from) {
+			fromPeer++
+		}
+	}
+
+	if fromPeer >= maxOrphansPerPeer {
+		log.Warnf("%s already gave us %d orphans. Not holding on to another...", from.Address, fromPeer)
+		return false
+	}
+
+	if len(o.orphans) >= maxOrphanBlocks {
+		oldestHash := ""
+		for h, orphan := range o.orphans {
+			if oldestHash == "" || orphan.received.Before(o.orphans[oldestHash].received) {
+				oldestHash = h
+			}
+		}
+
+		log.Warn("Our orphan block pool is full. Evicting the oldest orphan...")
+		delete(o.orphans, oldestHash)
+	}
+
+	o.orphans[hash] = orphanBlock{block: block, from: from, received: time.Now()}
+
+	return true
+}
+
+// has checks whether a block is in the pool.
+func (o *orphanPool) has(hash string) bool {
+	if o == nil {
+		return false
+	}
+
+	o.Lock()
+	defer o.Unlock()
+
+	_, ok := o.orphans[hash]
+
+	return ok
+}
+
+// size gets the number of orphans in the pool.
+func (o *orphanPool) size() int {
+	if o == nil {
+		return 0
+	}
+
+	o.Lock()
+	defer o.Unlock()
+
+	return len(o.orphans)
+}
+
+// missingAncestor follows an orphan's parents back through the pool and returns the hash of the first ancestor we don't have.
+func (o *orphanPool) missingAncestor(block Block) string {
+	if o == nil {
+		return block.PreviousHash
+	}
+
+	o.Lock()
+	defer o.Unlock()
+
+	missing := block.PreviousHash
+
+	// Bounded by the size of the pool, so a cycle of hashes can't loop forever
+	for i := 0; i < len(o.orphans); i++ {
+		parent, ok := o.orphans[missing]
+		if !ok {
+			break
+		}
+
+		missing = parent.block.PreviousHash
+	}
+
+	return missing
+}
+
+// hasChildren checks whether any orphan's parent has the given hash (without removing them, unlike takeChildren).
+func (o *orphanPool) hasChildren(parentHash string) bool {
+	if o == nil {
+		return false
+	}
+
+	o.Lock()
+	defer o.Unlock()
+
+	for _, orphan := range o.orphans {
+		if orphan.block.PreviousHash == parentHash {
+			return true
+		}
+	}
+
+	return false
+}
+
+// removeInChain removes the orphans that are in a chain (like a fork of orphans that Consensus just adopted).
+func (o *orphanPool) removeInChain(chain []Block) {
+	if o == nil {
+		return
+	}
+
+	o.Lock()
+	defer o.Unlock()
+
+	if len(o.orphans) == 0 {
+		return
+	}
+
+	for _, block := range chain {
+		delete(o.orphans, block.hash())
+	}
+}
+
+// takeChildren removes and returns every orphan whose parent has the given hash.
+func (o *orphanPool) takeChildren(parentHash string) []orphanBlock {
+	if o == nil {
+		return nil
+	}
+
+	o.Lock()
+	defer o.Unlock()
+
+	children := make([]orphanBlock, 0)
+
+	for hash, orphan := range o.orphans {
+		if orphan.block.PreviousHash == parentHash {
+			children = append(children, orphan)
+			delete(o.orphans, hash)
+		}
+	}
+
+	return children
+}
+
+// removeExpired removes orphans that have waited too long for their parents. The pool must be locked.
+func (o *orphanPool) removeExpired() {
+	for hash, orphan := range o.orphans {
+		if time.Since(orphan.received) > orphanBlockExpiry {
+			delete(o.orphans, hash)
+		}
+	}
+}
+
+// handleBlockFromPeer adds a block we got from a peer to our chain, relaying it if it was valid.
+// If the block's parent is unknown, it is held in the orphan pool and its missing ancestors are requested
+// from the peer that gave it to us. Once a block is added, any orphans waiting on it are connected too.
+func (l *LocalNode) handleBlockFromPeer(block Block, from noise.ID) {
+	chain := l.Snapshot().Chain
+
+	// Don't validate (or relay) a block we already have.
+	if _, ok := FindBlockByHash(chain, block.hash()); ok {
+		log.Info("We already have the block our peer gave us. Ignoring it...")
+		return
+	}
+
+	if block.PreviousHash != LastBlock(chain).hash() {
+		if _, ok := FindBlockByHash(chain, block.PreviousHash); ok {
+			// The block forks off our chain. If orphans were waiting on it, that fork may be longer than our chain.
+			// They stay in the pool until Consensus adopts them (or they expire), as our peers may not give us that fork.
+			if l.orphans.hasChildren(block.hash()) {
+				log.Info("A peer gave us a block that connects a fork of orphans to our chain. Running peer consensus...")
+				go l.GetPeerConsensus()
+			} else {
+				log.Info("A peer gave us a block that forks off of our (longer or equal) chain. Ignoring it...")
+			}
+
+			return
+		}
+
+		// Orphans can't be fully validated until their parents arrive, so at least make sure they took real work to make.
+		if !isPlausibleOrphan(block, chain) {
+			log.Warn("A peer gave us a block with an unknown parent and an invalid proof of work. Ignoring it...")
+
+			l.penalizePeer(from, penaltyInvalidBlock, "sent us an orphan block with an invalid proof of work")
+			return
+		}
+
+		if l.orphans.add(block, from) {
+			log.Infof("A peer gave us a block with an unknown parent. Holding it in our orphan pool (%d orphans)...", l.orphans.size())
+		}
+
+		// Only ask for the first ancestor we are missing (the ones after it are already in the pool).
+		missing := l.orphans.missingAncestor(block)
+		if l.inventory.markRequested(missing) {
+			err := l.sendMessageToPeer(InventoryRequestMessage{Inventory: Inventory{Blocks: []string{missing}}}, from.Address)
+
+			if err != nil {
+				log.Errorf("Failed to request a missing block from %s", from.Address)
+			}
+		}
+
+		return
+	}
+
+	added, err := l.addMinedBlockToChain(block)
+
+	// If our peer's mined block was valid and added to chain:
+	if added == true {
+		log.Info("We just got a new mined block from a peer and added it to the chain!")
+
+		// Pass the block on so it reaches nodes that aren't direct neighbours of the miner.
+		l.RelayBlock(block, from.Address)
+
+		l.connectOrphans(block.hash())
+	} else if err != nil {
+		// Our validation server is down, so we can't tell whether the block was valid (which isn't our peer's fault).
+		log.Errorf("We couldn't check the signatures in the block we just got from a peer. It was not added. [error: %s]", err)
+	} else if l.chainMovedPast(block) {
+		// Another peer's copy of the block (or a competing block) was added while we were checking it (which isn't our peer's fault).
+		log.Info("Our chain changed while we were checking the block we just got from a peer. It was not added.")
+	} else {
+		log.Warn("The block we just got from a peer was not valid! It was not added to the chain and the UTXO was not updated!")
+
+		l.penalizePeer(from, penaltyInvalidBlock, "sent us an invalid block")
+	}
+}
+
+// chainMovedPast checks whether a block that wasn't added to our chain might only have failed because our chain changed while
+// we were checking it: it is in our chain now, or its parent isn't our last block anymore. Peers relay the same blocks at the same
+// time (and we handle their messages concurrently), so that isn't misbehaviour.
+func (l *LocalNode) chainMovedPast(block Block) bool {
+	chain := l.Snapshot().Chain
+
+	if _, ok := FindBlockByHash(chain, block.hash()); ok {
+		return true
+	}
+
+	return block.PreviousHash != LastBlock(chain).hash()
+}
+
+// isPlausibleOrphan checks that a block with an unknown parent has a valid proof of work, with a difficulty at most orphanDifficultySlack
+// below what the next block on our chain needs (we can't know its chain's exact difficulty until its ancestors arrive).
+func isPlausibleOrphan(block Block, chain []Block) bool {
+	return ValidateProof(block) && block.Proof.DifficultyThreshold >= DetermineDifficultyForChainIndex(chain, len(chain))-orphanDifficultySlack
+}
+
+// connectOrphans adds orphans that were waiting on a parent block (which was just added to our chain) to our chain,
+// and then does the same for their children.
+func (l *LocalNode) connectOrphans(parentHash string) {
+	parents := []string{parentHash}
+
+	for len(parents) > 0 {
+		parent := parents[0]
+		parents = parents[1:]
+
+		for _, orphan := range l.orphans.takeChildren(parent) {
+			if added, err := l.addMinedBlockToChain(orphan.block); added {
+				log.Info("We just connected an orphan block to our chain!")
+
+				l.RelayBlock(orphan.block, orphan.from.Address)
+
+				parents = append(parents, orphan.block.hash())
+			} else if err != nil {
+				log.Errorf("We couldn't check the signatures in an orphan block once its parent arrived. It was not added. [error: %s]", err)
+			} else if l.chainMovedPast(orphan.block) {
+				log.Info("Our chain changed while we were connecting an orphan block. It was not added.")
+			} else {
+				log.Warn("An orphan block was not valid once its parent arrived! It was not added to the chain.")
+
+				l.penalizePeer(orphan.from, penaltyInvalidBlock, "sent us an invalid orphan block")
+			}
+		}
+	}
+}
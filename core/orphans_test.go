@@ -0,0 +1,228 @@
+package core
+
+import (
+	"github.com/perlin-network/noise"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestOrphanPool(t *testing.T) {
+	pool := newOrphanPool()
+	peer := newTestPeer(t, "peer1")
+
+	parent := Block{BlockHeader: BlockHeader{Timestamp: 1, PreviousHash: "missing"}}
+	child := Block{BlockHeader: BlockHeader{Timestamp: 2, PreviousHash: parent.hash()}}
+	grandchild := Block{BlockHeader: BlockHeader{Timestamp: 3, PreviousHash: child.hash()}}
+
+	assert.True(t, pool.add(grandchild, peer))
+	assert.True(t, pool.add(child, peer))
+
+	// Adding the same block twice does nothing
+	assert.False(t, pool.add(child, peer))
+	assert.Equal(t, 2, pool.size())
+	assert.True(t, pool.has(child.hash()))
+
+	// The first ancestor we are missing is the child's parent
+	assert.Equal(t, parent.hash(), pool.missingAncestor(grandchild))
+
+	// Checking for the children of a block doesn't remove them from the pool
+	assert.True(t, pool.hasChildren(child.hash()))
+	assert.False(t, pool.hasChildren(grandchild.hash()))
+	assert.Equal(t, 2, pool.size())
+
+	// Taking them does
+	children := pool.takeChildren(child.hash())
+	assert.Len(t, children, 1)
+	assert.Equal(t, grandchild, children[0].block)
+	assert.Equal(t, peer, children[0].from)
+	assert.False(t, pool.has(grandchild.hash()))
+	assert.Equal(t, 1, pool.size())
+
+	// Orphans in a chain we adopted are removed
+	pool.removeInChain([]Block{parent, child})
+	assert.Equal(t, 0, pool.size())
+
+	// Nil pools are safe to use
+	var nilPool *orphanPool
+	assert.False(t, nilPool.add(child, peer))
+	assert.False(t, nilPool.hasChildren(parent.hash()))
+	assert.Equal(t, 0, nilPool.size())
+}
+
+func TestOrphanPool_Limits(t *testing.T) {
+	pool := newOrphanPool()
+	peer := newTestPeer(t, "peer1")
+
+	// One peer can only give us so many orphans
+	for i := 0; i < maxOrphansPerPeer; i++ {
+		assert.True(t, pool.add(Block{BlockHeader: BlockHeader{Timestamp: int64(i), PreviousHash: "missing"}}, peer))
+	}
+	assert.False(t, pool.add(Block{BlockHeader: BlockHeader{Timestamp: -2, PreviousHash: "missing"}}, peer))
+
+	// Even when it claims another peer's address
+	assert.False(t, pool.add(Block{BlockHeader: BlockHeader{Timestamp: -2, PreviousHash: "missing"}}, noise.ID{ID: peer.ID, Address: "peer2"}))
+	assert.True(t, pool.add(Block{BlockHeader: BlockHeader{Timestamp: -2, PreviousHash: "missing"}}, newTestPeer(t, "peer2")))
+
+	// The pool never grows past its max size
+	for i := 0; i < maxOrphanBlocks+10; i++ {
+		if i%maxOrphansPerPeer == 0 {
+			peer = newTestPeer(t, "peer1")
+		}
+
+		pool.add(Block{BlockHeader: BlockHeader{Timestamp: int64(maxOrphansPerPeer + i), PreviousHash: "missing"}}, peer)
+	}
+	assert.Equal(t, maxOrphanBlocks, pool.size())
+
+	// Expired orphans are removed when new ones are added
+	for hash, orphan := range pool.orphans {
+		orphan.received = time.Now().Add(-2 * orphanBlockExpiry)
+		pool.orphans[hash] = orphan
+	}
+	pool.add(Block{BlockHeader: BlockHeader{Timestamp: -1, PreviousHash: "missing"}}, peer)
+	assert.Equal(t, 1, pool.size())
+}
+
+func TestLocalNode_ConnectOrphans(t *testing.T) {
+	fakeValidationServer := newFakeValidationServer(true)
+	defer fakeValidationServer.Close()
+
+	localNode := LocalNode{Chain: []Block{testGenesisBlock}, MemPool: make([]Transaction, 0), UTXO: UTXO{testGenesisBlock.Transactions[0].Recipient: {Spendable: testGenesisBlock.Transactions[0].Amount}}, ValidationServerURL: fakeValidationServer.URL, OperatorPublicKey: "0", MinimumChainsForConsensus: 1}
+	localNode.orphans = newOrphanPool()
+
+	newTransactions := []Transaction{Transaction{Sender: "0", Recipient: "0458adabe2c014de6c3fd2f2c865c2ca7fe823a4131a4d22f98dcc77f1bffc8aeacf8a0b7949321c33214e9c1b2201063404a321110be8223ad1685ee32c9c02d0", Amount: 1000, Timestamp: 0, Signature: ""}, Transaction{Sender: "0458adabe2c014de6c3fd2f2c865c2ca7fe823a4131a4d22f98dcc77f1bffc8aeacf8a0b7949321c33214e9c1b2201063404a321110be8223ad1685ee32c9c02d0", Recipient: "0436c6797970ef164ecb4c279c32e25b866af78fece9cacc3cc94789b5a2ca6229fe21905d734100236fe5520696d8df70d64fdaef606e6880a424c957ae3f9cb6", Amount: 20, Timestamp: 1586469742, Signature: "304502201d7519147c9d1f8f2b916683afac3d190ab50688a5c12dd016554a1386f5975c022100ef3938bb6d4d3e6237462b045edcfcc9ef64e9e9f39b869e4ed477ae0d3330e5"}}
+	orphan := Block{BlockHeader: BlockHeader{Timestamp: 1586119312, Transactions: newTransactions, PreviousHash: testGenesisBlock.hash()}, Proof: Proof{Nonce: 2119721, DifficultyThreshold: 5}}
+	localNode.orphans.add(orphan, newTestPeer(t, "peer1"))
+
+	// Once the orphan's parent is in our chain, the orphan gets connected
+	localNode.connectOrphans(testGenesisBlock.hash())
+
+	assert.Equal(t, []Block{testGenesisBlock, orphan}, localNode.Chain)
+	assert.Equal(t, 0, localNode.orphans.size())
+}
+
+func TestLocalNode_HandleBlockFromPeer_Orphans(t *testing.T) {
+	localNode := LocalNode{Chain: []Block{testGenesisBlock}, MemPool: make([]Transaction, 0), UTXO: make(UTXO), ValidationServerURL: validationServer, OperatorPublicKey: "0", MinimumChainsForConsensus: 1}
+	localNode.orphans = newOrphanPool()
+	localNode.bans, _ = newBanList("")
+
+	peer := newTestPeer(t, "peer1")
+
+	// Orphans have to come with real work
+	unproven := harnessBlock2
+	unproven.Proof.Nonce++
+	localNode.handleBlockFromPeer(unproven, peer)
+	assert.Equal(t, 0, localNode.orphans.size())
+	assert.Equal(t, penaltyInvalidBlock, localNode.bans.score(peerKey(peer)))
+
+	easy := Block{BlockHeader: BlockHeader{Timestamp: 1586200600, PreviousHash: harnessBlock1.hash()}, Proof: Proof{Nonce: 0, DifficultyThreshold: 0}}
+	localNode.handleBlockFromPeer(easy, peer)
+	assert.Equal(t, 0, localNode.orphans.size())
+	assert.Equal(t, 2*penaltyInvalidBlock, localNode.bans.score(peerKey(peer)))
+
+	localNode.handleBlockFromPeer(harnessBlock2, peer)
+	assert.True(t, localNode.orphans.has(harnessBlock2.hash()))
+	assert.Equal(t, 2*penaltyInvalidBlock, localNode.bans.score(peerKey(peer)))
+}
+
+func TestIsPlausibleOrphan(t *testing.T) {
+	chain := []Block{testGenesisBlock}
+	expected := DetermineDifficultyForChainIndex(chain, len(chain))
+
+	// Finds a proof with a difficulty for an orphan
+	proven := func(difficulty int64) Block {
+		block := Block{BlockHeader: BlockHeader{Timestamp: 1586200600, PreviousHash: harnessBlock1.hash()}, Proof: Proof{DifficultyThreshold: difficulty}}
+		for !ValidateProof(block) {
+			block.Proof.Nonce++
+		}
+
+		return block
+	}
+
+	assert.True(t, isPlausibleOrphan(harnessBlock2, chain))
+	assert.True(t, isPlausibleOrphan(proven(expected-orphanDifficultySlack), chain))
+
+	// Proofs with much less work than our chain needs are rejected, even if they are valid
+	assert.False(t, isPlausibleOrphan(proven(expected-orphanDifficultySlack-1), chain))
+}
+
+func TestLocalNode_HandleBlockFromPeer_ValidationServerDown(t *testing.T) {
+	fakeValidationServer := newFakeValidationServer(true)
+	fakeValidationServer.Close()
+
+	localNode := newTestMinerNode(fakeValidationServer.URL)
+	localNode.orphans = newOrphanPool()
+	localNode.bans, _ = newBanList("")
+
+	peer := newTestPeer(t, "peer1")
+
+	// We can't check the block, but that's our fault (not our peer's)
+	localNode.handleBlockFromPeer(harnessBlock1, peer)
+	assert.Equal(t, []Block{testGenesisBlock}, localNode.Snapshot().Chain)
+	assert.Equal(t, 0, localNode.bans.score(peerKey(peer)))
+}
+
+func TestLocalNode_HandleBlockFromPeer_SameBlockFromTwoPeers(t *testing.T) {
+	// Both peers' copies of the block are checked at the same time
+	var arrived sync.WaitGroup
+	arrived.Add(2)
+
+	fakeValidationServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		arrived.Done()
+		arrived.Wait()
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"valid_signature": true}`))
+	}))
+	defer fakeValidationServer.Close()
+
+	localNode := newTestMinerNode(fakeValidationServer.URL)
+	localNode.orphans = newOrphanPool()
+	localNode.bans, _ = newBanList("")
+
+	peers := []noise.ID{newTestPeer(t, "peer1"), newTestPeer(t, "peer2")}
+
+	var handled sync.WaitGroup
+	for _, peer := range peers {
+		handled.Add(1)
+
+		go func(peer noise.ID) {
+			defer handled.Done()
+
+			localNode.handleBlockFromPeer(harnessBlock1, peer)
+		}(peer)
+	}
+	handled.Wait()
+
+	// Only one copy is added, and the peer whose copy lost the race isn't penalized
+	assert.Equal(t, []Block{testGenesisBlock, harnessBlock1}, localNode.Snapshot().Chain)
+
+	for _, peer := range peers {
+		assert.Equal(t, 0, localNode.bans.score(peerKey(peer)))
+	}
+}
+
+func TestLocalNode_HandleBlockFromPeer_ForkOfOrphans(t *testing.T) {
+	fakeValidationServer := newFakeValidationServer(true)
+	defer fakeValidationServer.Close()
+
+	localNode := newTestMinerNode(fakeValidationServer.URL)
+	localNode.orphans = newOrphanPool()
+	localNode.ConsensusTimeout = 10 * time.Millisecond
+
+	peer := newTestPeer(t, "peer1")
+
+	assert.True(t, localNode.AddMinedBlockToChain(harnessForkBlock))
+
+	// A block that connects orphans to a fork of our chain doesn't take them out of the pool (consensus has to adopt them first)
+	localNode.orphans.add(harnessBlock2, peer)
+	localNode.handleBlockFromPeer(harnessBlock1, peer)
+	assert.True(t, localNode.orphans.has(harnessBlock2.hash()))
+
+	// Once consensus adopts the fork, they are removed
+	assert.True(t, localNode.consensus([]peerChain{{blocks: []Block{testGenesisBlock, harnessBlock1, harnessBlock2}, from: &peer}}))
+	assert.Equal(t, 0, localNode.orphans.size())
+}
@@ -0,0 +1,177 @@
+package core
+
+import (
+	"fmt"
+	"strings"
+)
+
+// An Input spends an unspent output made by an earlier output-based transaction.
+type Input struct {
+	TransactionHash string // The hash of the transaction that made the output
+	Index           int    // The index of the output in that transaction's Outputs
+}
+
+// An Output pays coins to a recipient. They are kept as an unspent output of the recipient until a transaction from the recipient spends them with an Input.
+type Output struct {
+	Recipient string // The address or public key the coins are paid to
+	Amount    uint64 // How many coins are paid
+}
+
+// Gets the ID the output an input spends is kept under in a UTXO: TRANSACTION_HASH:INDEX.
+func (i Input) id() string {
+	return fmt.Sprintf("%v:%v", i.TransactionHash, i.Index)
+}
+
+// Checks whether a transaction is output-based: instead of paying Amount to Recipient, it spends Inputs (and Amount coins from the Sender's balance)
+// and pays them to its Outputs. Any coins it spends that aren't paid to an output go back to the Sender's balance.
+func (t Transaction) isOutputBased() bool {
+	return len(t.Inputs) > 0 || len(t.Outputs) > 0
+}
+
+// Puts a transaction's inputs and outputs into the format they are signed in: [SPENDS HASH:INDEX, ...] [PAYS AMOUNT TO RECIPIENT, ...]
+func outputsRepresentation(transaction Transaction) string {
+	inputs := make([]string, 0, len(transaction.Inputs))
+	for _, input := range transaction.Inputs {
+		inputs = append(inputs, input.id())
+	}
+
+	outputs := make([]string, 0, len(transaction.Outputs))
+	for _, output := range transaction.Outputs {
+		outputs = append(outputs, fmt.Sprintf("%v TO %v", output.Amount, output.Recipient))
+	}
+
+	return fmt.Sprintf(" [SPENDS %v] [PAYS %v]", strings.Join(inputs, ", "), strings.Join(outputs, ", "))
+}
+
+// Finds an unspent output that an account (a public key or an address) can spend: one paid to the account, or to the address of a public key.
+// It returns the key the output is kept under in the UTXO, and its amount.
+func (u UTXO) findOutput(account string, input Input) (string, uint64, bool) {
+	for _, owner := range []string{accountKey(account), accountAddress(account)} {
+		if amount, ok := u[owner].Outputs[input.id()]; ok {
+			return owner, amount, true
+		}
+	}
+
+	return "", 0, false
+}
+
+// Gets how many coins an account (a public key or an address) has in unspent outputs.
+func (u UTXO) OutputBalance(account string) uint64 {
+	key := accountKey(account)
+	balance := u[key].outputs()
+
+	if address := accountAddress(account); address != key {
+		balance += u[address].outputs()
+	}
+
+	return balance
+}
+
+// Gets the total of the unspent outputs.
+func (f Funds) outputs() uint64 {
+	var total uint64
+	for _, amount := range f.Outputs {
+		total += amount
+	}
+
+	return total
+}
+
+// Checks the coins of an output-based transaction: it must not have a Recipient (or payments), its outputs must pay a positive amount to valid recipients,
+// its inputs must be different unspent outputs of the Sender (so nothing is spent twice), the Sender's balance must cover Amount,
+// and what it spends (its inputs and Amount) must cover what it pays.
+func validateOutputs(transaction Transaction, utxo UTXO) bool {
+	if transaction.Recipient != "" || len(transaction.Outputs) == 0 || transaction.isBatch() {
+		return false
+	}
+
+	paid := make([]uint64, 0, len(transaction.Outputs))
+	for _, output := range transaction.Outputs {
+		if output.Amount == 0 || !IsValidRecipient(output.Recipient) {
+			return false
+		}
+
+		paid = append(paid, output.Amount)
+	}
+
+	if transaction.Amount > utxo.Balance(transaction.Sender) {
+		return false
+	}
+
+	spent := []uint64{transaction.Amount}
+
+	seen := make(map[string]bool, len(transaction.Inputs))
+	for _, input := range transaction.Inputs {
+		if seen[input.id()] {
+			return false
+		}
+
+		seen[input.id()] = true
+
+		_, amount, ok := utxo.findOutput(transaction.Sender, input)
+		if !ok {
+			return false
+		}
+
+		spent = append(spent, amount)
+	}
+
+	// Totals that are more than a uint64 can hold are invalid (instead of wrapping around to a smaller total)
+	totalSpent, ok := sumAmounts(spent...)
+	if !ok {
+		return false
+	}
+
+	totalPaid, ok := sumAmounts(paid...)
+
+	return ok && totalSpent >= totalPaid
+}
+
+// Applies a (valid) output-based transaction: its inputs are removed from the unspent outputs, its outputs are added to them,
+// and Amount is taken from the Sender's balance. Whatever isn't paid to an output goes back to the Sender's balance.
+// It returns false if an input isn't an unspent output of the Sender, or the coins don't add up without overflowing.
+func (u UTXO) applyOutputs(transaction Transaction) bool {
+	if !u.debit(transaction.Sender, transaction.Amount) {
+		return false
+	}
+
+	spent := transaction.Amount
+
+	for _, input := range transaction.Inputs {
+		owner, amount, found := u.findOutput(transaction.Sender, input)
+		if !found {
+			return false
+		}
+
+		var ok bool
+		if spent, ok = addAmounts(spent, amount); !ok {
+			return false
+		}
+
+		funds := u[owner]
+		delete(funds.Outputs, input.id())
+		if len(funds.Outputs) == 0 {
+			funds.Outputs = nil
+		}
+		u[owner] = funds
+	}
+
+	hash := transaction.hash()
+	for index, output := range transaction.Outputs {
+		key := accountKey(output.Recipient)
+
+		funds := u[key]
+		if funds.Outputs == nil {
+			funds.Outputs = make(map[string]uint64)
+		}
+		funds.Outputs[Input{TransactionHash: hash, Index: index}.id()] = output.Amount
+		u[key] = funds
+
+		var ok bool
+		if spent, ok = subtractAmounts(spent, output.Amount); !ok {
+			return false
+		}
+	}
+
+	return spent == 0 || u.credit(transaction.Sender, spent)
+}
@@ -0,0 +1,142 @@
+package core
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+// An output-based transaction from testGenesisBlock's key, paying harnessRecipient, with change to its address (and 10 coins back to its balance).
+var outputsTransaction = Transaction{Sender: testGenesisBlock.Transactions[0].Recipient, Amount: 100, Timestamp: 1586201290, Signature: "signature10", Outputs: []Output{{harnessRecipient, 60}, {testGenesisAddress, 30}}}
+
+// Two transactions that spend harnessRecipient's output from outputsTransaction.
+var outputsSpend = Transaction{Sender: harnessRecipient, Timestamp: 1586201390, Signature: "signature11", Inputs: []Input{{outputsTransaction.hash(), 0}}, Outputs: []Output{{testGenesisAddress, 60}}}
+var outputsDoubleSpend = Transaction{Sender: harnessRecipient, Timestamp: 1586201391, Signature: "signature12", Inputs: []Input{{outputsTransaction.hash(), 0}}, Outputs: []Output{{testGenesisAddress, 50}}}
+
+var outputsBlock1 = Block{BlockHeader: BlockHeader{Timestamp: 1586201300, Transactions: []Transaction{{Sender: "0", Recipient: "miner1", Amount: 1000, Timestamp: 1586201300}, outputsTransaction}, PreviousHash: testGenesisBlock.hash()}, Proof: Proof{Nonce: 1031710, DifficultyThreshold: 5}}
+var outputsDoubleSpendBlock = Block{BlockHeader: BlockHeader{Timestamp: 1586201400, Transactions: []Transaction{{Sender: "0", Recipient: "miner1", Amount: 1000, Timestamp: 1586201400}, outputsSpend, outputsDoubleSpend}, PreviousHash: outputsBlock1.hash()}, Proof: Proof{Nonce: 478518, DifficultyThreshold: 5}}
+var outputsBlock2 = Block{BlockHeader: BlockHeader{Timestamp: 1586201400, Transactions: []Transaction{{Sender: "0", Recipient: "miner1", Amount: 1000, Timestamp: 1586201400}, outputsSpend}, PreviousHash: outputsBlock1.hash()}, Proof: Proof{Nonce: 1163775, DifficultyThreshold: 5}}
+
+func TestTransaction_Outputs(t *testing.T) {
+	assert.False(t, harnessBlock1.Transactions[1].isOutputBased())
+	assert.True(t, outputsTransaction.isOutputBased())
+	assert.True(t, outputsSpend.isOutputBased())
+
+	// The inputs and outputs are signed
+	assert.Equal(t, outputsTransaction.Sender+" -100->  (1586201290) [SPENDS ] [PAYS 60 TO "+harnessRecipient+", 30 TO "+testGenesisAddress+"]", TransactionRepresentation(outputsTransaction))
+	assert.Equal(t, harnessRecipient+" -0->  (1586201390) [SPENDS "+outputsTransaction.hash()+":0] [PAYS 60 TO "+testGenesisAddress+"]", TransactionRepresentation(outputsSpend))
+
+	// And hashed
+	changed := outputsTransaction
+	changed.Outputs = []Output{{harnessRecipient, 30}, {testGenesisAddress, 60}}
+	assert.NotEqual(t, outputsTransaction.hash(), changed.hash())
+
+	assert.True(t, outputsTransaction.HasValidRecipients())
+	assert.False(t, Transaction{Sender: harnessRecipient, Recipient: harnessRecipient, Outputs: []Output{{harnessRecipient, 1}}}.HasValidRecipients())
+	assert.False(t, Transaction{Sender: harnessRecipient, Outputs: []Output{{harnessRecipient, 1}, {"nobody", 1}}}.HasValidRecipients())
+	assert.False(t, Transaction{Sender: harnessRecipient, Inputs: []Input{{"hash", 0}}}.HasValidRecipients())
+}
+
+func TestValidateOutputs(t *testing.T) {
+	sender := testGenesisBlock.Transactions[0].Recipient
+	utxo := UTXO{sender: {Spendable: 100}, testGenesisAddress: {Outputs: map[string]uint64{"a:0": 20, "b:1": 30}}}
+
+	valid := func(transaction Transaction) bool {
+		transaction.Sender = sender
+		return validateOutputs(transaction, utxo)
+	}
+
+	// Spending from the balance
+	assert.True(t, valid(Transaction{Amount: 100, Outputs: []Output{{harnessRecipient, 100}}}))
+	assert.False(t, valid(Transaction{Amount: 101, Outputs: []Output{{harnessRecipient, 100}}}))
+
+	// Spending outputs (including ones paid to the sender's address)
+	assert.True(t, valid(Transaction{Inputs: []Input{{"a", 0}, {"b", 1}}, Outputs: []Output{{harnessRecipient, 40}, {testGenesisAddress, 10}}}))
+	assert.True(t, valid(Transaction{Amount: 50, Inputs: []Input{{"a", 0}, {"b", 1}}, Outputs: []Output{{harnessRecipient, 100}}}))
+
+	// Paying more than is spent
+	assert.False(t, valid(Transaction{Inputs: []Input{{"a", 0}, {"b", 1}}, Outputs: []Output{{harnessRecipient, 51}}}))
+
+	// Outputs that don't exist (or belong to someone else)
+	assert.False(t, valid(Transaction{Inputs: []Input{{"a", 1}}, Outputs: []Output{{harnessRecipient, 1}}}))
+	assert.False(t, validateOutputs(Transaction{Sender: harnessRecipient, Inputs: []Input{{"a", 0}}, Outputs: []Output{{harnessRecipient, 1}}}, utxo))
+
+	// Spending an output twice
+	assert.False(t, valid(Transaction{Inputs: []Input{{"a", 0}, {"a", 0}}, Outputs: []Output{{harnessRecipient, 40}}}))
+
+	// Invalid outputs
+	assert.False(t, valid(Transaction{Amount: 10, Inputs: []Input{{"a", 0}}}))
+	assert.False(t, valid(Transaction{Amount: 10, Outputs: []Output{{harnessRecipient, 10}, {harnessRecipient, 0}}}))
+	assert.False(t, valid(Transaction{Amount: 10, Outputs: []Output{{"nobody", 10}}}))
+	assert.False(t, valid(Transaction{Recipient: harnessRecipient, Amount: 10, Outputs: []Output{{harnessRecipient, 10}}}))
+}
+
+func TestUTXO_ApplyOutputs(t *testing.T) {
+	sender := testGenesisBlock.Transactions[0].Recipient
+	utxo := UTXO{sender: {Spendable: 100}, testGenesisAddress: {Outputs: map[string]uint64{"a:0": 20}}}
+	copied := utxo.copy()
+
+	transaction := Transaction{Sender: sender, Amount: 50, Inputs: []Input{{"a", 0}}, Outputs: []Output{{harnessRecipient, 40}, {testGenesisCompressedKey, 25}}}
+	utxo.applyTransaction(transaction)
+
+	// The input is spent, the outputs are paid, and the 5 coins left over go back to the sender
+	assert.Equal(t, UTXO{
+		sender:             {Spendable: 55, Outputs: map[string]uint64{transaction.hash() + ":1": 25}},
+		testGenesisAddress: {},
+		harnessRecipient:   {Outputs: map[string]uint64{transaction.hash() + ":0": 40}},
+	}, utxo)
+
+	assert.Equal(t, uint64(55), utxo.Balance(sender))
+	assert.Equal(t, uint64(25), utxo.OutputBalance(sender))
+	assert.Equal(t, uint64(40), utxo.OutputBalance(harnessRecipient))
+
+	// Spent outputs can't be spent again
+	assert.False(t, validateOutputs(transaction, utxo))
+
+	// Copies don't change with the original
+	assert.Equal(t, uint64(20), copied.OutputBalance(sender))
+}
+
+func TestValidateBlock_Outputs(t *testing.T) {
+	fakeValidationServer := newFakeValidationServer(true)
+	defer fakeValidationServer.Close()
+
+	valid, utxo := ValidateChain([]Block{testGenesisBlock, outputsBlock1}, fakeValidationServer.URL)
+	assert.True(t, valid)
+	assert.Equal(t, testGenesisBlock.Transactions[0].Amount-90, utxo.Balance(testGenesisBlock.Transactions[0].Recipient))
+	assert.Equal(t, uint64(30), utxo.OutputBalance(testGenesisAddress))
+	assert.Equal(t, uint64(60), utxo.OutputBalance(harnessRecipient))
+
+	// An output can only be spent once in a block
+	valid, _ = ValidateChain([]Block{testGenesisBlock, outputsBlock1, outputsDoubleSpendBlock}, fakeValidationServer.URL)
+	assert.False(t, valid)
+
+	valid, utxo = ValidateChain([]Block{testGenesisBlock, outputsBlock1, outputsBlock2}, fakeValidationServer.URL)
+	assert.True(t, valid)
+	assert.Equal(t, uint64(90), utxo.OutputBalance(testGenesisAddress))
+	assert.Equal(t, uint64(0), utxo.OutputBalance(harnessRecipient))
+
+	// And never again in a later block
+	node := newTestMinerNode(fakeValidationServer.URL)
+	assert.True(t, node.AddMinedBlockToChain(outputsBlock1))
+	assert.True(t, node.AddMinedBlockToChain(outputsBlock2))
+	assert.False(t, ValidateTransaction(outputsDoubleSpend, node.UTXO, fakeValidationServer.URL))
+}
+
+func TestNewBlockTemplate_Outputs(t *testing.T) {
+	fakeValidationServer := newFakeValidationServer(true)
+	defer fakeValidationServer.Close()
+
+	node := newTestMinerNode(fakeValidationServer.URL)
+
+	// A transaction can spend an output made earlier in the same block, but only one of two conflicting transactions is mined
+	assert.True(t, node.AddTransactionToMemPool(outputsTransaction))
+	assert.True(t, node.AddTransactionToMemPool(outputsSpend))
+	assert.True(t, node.AddTransactionToMemPool(outputsDoubleSpend))
+
+	template := node.NewBlockTemplate()
+	assert.NotNil(t, template)
+	assert.Equal(t, []Transaction{outputsTransaction, outputsSpend}, template.Transactions[1:])
+
+	// Transactions with invalid outputs aren't accepted
+	assert.False(t, node.AddTransactionToMemPool(Transaction{Sender: harnessRecipient, Amount: 10, Timestamp: 1586201390, Signature: "signature13", Outputs: []Output{{"nobody", 10}}}))
+}
@@ -1,84 +1,51 @@
 package core
 
 import (
-	"bytes"
 	"context"
-	"encoding/gob"
+	"errors"
 	"fmt"
 	"github.com/perlin-network/noise"
 	"github.com/perlin-network/noise/kademlia"
 	log "github.com/sirupsen/logrus"
-	"net"
-	"os"
-	"os/signal"
 	"strings"
-	"sync"
+	"sync/atomic"
 	"time"
 )
 
-var PortP2P uint16 = 7000
+// The biggest message (in bytes) we accept from a peer. Anything bigger is dropped before we try to decode it.
+const MaxMessageSize = 16 << 20
 
-const (
-	newBlock       = iota // Body will be: Block
-	newTransaction        // Body will be: Transaction
-	thisIsMyChain         // Body will be: []Block
-	needChain             // Body will be: nil
-)
-
-// Stores a type of message and a body.
-type NodeMessage struct {
-	MessageType int         // Can be: newBlock, newTransaction, thisIsMyChain, or needChain
-	Body        interface{} // The actual payload (it can be many types)
-}
-
-func init() {
-	gob.Register([]Block(nil))
-	gob.Register(Block{})
-	gob.Register(Transaction{})
-	gob.Register([]Transaction(nil))
-}
-
-func (m NodeMessage) Marshal() []byte {
-	var buf bytes.Buffer
-
-	enc := gob.NewEncoder(&buf)
-
-	if err := enc.Encode(m); err != nil {
-		log.Fatal(err)
+// sendMessageToPeer sends a message to a peer directly through their address.
+// Peers that might be old nodes are sent it as a NodeMessage (and can't be sent messages old nodes don't have).
+func (l *LocalNode) sendMessageToPeer(message WireMessage, address string) error {
+	if l.node == nil {
+		return errors.New("we aren't connected to the P2P network yet")
 	}
 
-	return buf.Bytes()
-}
-func unMarshalNodeMessage(input []byte) (NodeMessage, error) {
-	var msg NodeMessage
-	buf := bytes.NewBuffer(input)
-	dec := gob.NewDecoder(buf)
+	envelope := wireEnvelope{WireMessage: message}
 
-	if err := dec.Decode(&msg); err != nil {
-		log.Fatal(err)
-	}
-
-	return msg, nil
-}
+	if l.peers.needsLegacyEncoding(address) {
+		if _, ok := toNodeMessage(message); !ok {
+			return fmt.Errorf("%s might be an old node, which doesn't understand message type %d", address, message.messageType())
+		}
 
-// check panics if err is not nil.
-func check(err error) {
-	if err != nil {
-		log.Error(err)
+		envelope.legacy = true
 	}
-}
 
-// sendMessageToPeer sends a message to a peer directly through their address.
-func (l *LocalNode) sendMessageToPeer(message NodeMessage, address string) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
-	err := l.node.SendMessage(ctx, address, message)
+	err := l.node.SendMessage(ctx, address, envelope)
 	cancel()
 
 	return err
 }
 
 // broadcast sends a message to all peers.
-func (l *LocalNode) broadcast(message NodeMessage) {
+func (l *LocalNode) broadcast(message WireMessage) {
+	// We aren't connected to the P2P network yet
+	if l.kademliaProtocol == nil {
+		return
+	}
+
 	for _, id := range l.kademliaProtocol.Table().Peers() {
 		err := l.sendMessageToPeer(message, id.Address)
 
@@ -89,56 +56,204 @@ func (l *LocalNode) broadcast(message NodeMessage) {
 	}
 }
 
-// GetPeerConsensus sends a message to all peers requesting their chain, then we choose 5 of them and run consensus on them.
-func (l *LocalNode) GetPeerConsensus() {
-	// Create a channel
-	l.incomingChains = make(chan []Block, l.MinimumChainsForConsensus)
+// announceInventory sends an Inventory to each peer, leaving out the items that peer is already known to have.
+// It returns how many peers were sent an announcement.
+func (l *LocalNode) announceInventory(inventory Inventory) int {
+	announced := 0
 
-	// Ask all peers for their chain
-	l.broadcast(NodeMessage{
-		MessageType: needChain,
-		Body:        nil,
-	})
+	// We aren't connected to the P2P network yet
+	if l.kademliaProtocol == nil {
+		return announced
+	}
+
+	for _, id := range l.kademliaProtocol.Table().Peers() {
+		unknown := Inventory{}
 
-	// Get the minimum amount of chains we need for consensus in slice
-	var chains = make([][]Block, 0)
-	for incomingChain := range l.incomingChains {
-		chains = append(chains, incomingChain)
-		if len(chains) == l.MinimumChainsForConsensus {
-			close(l.incomingChains)
+		for _, hash := range inventory.Blocks {
+			if !l.inventory.isKnown(id.Address, hash) {
+				unknown.Blocks = append(unknown.Blocks, hash)
+			}
 		}
+
+		for _, hash := range inventory.Transactions {
+			if !l.inventory.isKnown(id.Address, hash) {
+				unknown.Transactions = append(unknown.Transactions, hash)
+			}
+		}
+
+		// This peer already has everything
+		if len(unknown.Blocks) == 0 && len(unknown.Transactions) == 0 {
+			continue
+		}
+
+		// Old nodes don't understand announcements, so they get the full blocks and transactions (like they used to).
+		if l.peers.needsLegacyEncoding(id.Address) {
+			l.SendPeerInventory(unknown, id.Address)
+
+			announced++
+			continue
+		}
+
+		err := l.sendMessageToPeer(InventoryMessage{Inventory: unknown}, id.Address)
+
+		if err != nil {
+			log.Warnf("Failed to send inventory to %s. Skipping... [error: %s]", id.Address, err)
+			continue
+		}
+
+		// The peer knows about these items now (it will ask us for the ones it doesn't have)
+		l.markInventoryKnown(id.Address, unknown)
+
+		announced++
+	}
+
+	return announced
+}
+
+// markInventoryKnown records that a peer has (or has been told about) every item in an Inventory.
+func (l *LocalNode) markInventoryKnown(address string, inventory Inventory) {
+	for _, hash := range inventory.Blocks {
+		l.inventory.markKnown(address, hash)
+	}
+
+	for _, hash := range inventory.Transactions {
+		l.inventory.markKnown(address, hash)
+	}
+}
+
+// GetPeerConsensus sends a message to all peers requesting their chain, then runs consensus on the chains that arrive.
+// It stops waiting once we have MinimumChainsForConsensus chains or ConsensusTimeout has passed (whichever comes first),
+// so it never hangs when we have fewer peers than MinimumChainsForConsensus.
+func (l *LocalNode) GetPeerConsensus() {
+	chains := l.collectPeerChains(func() {
+		// Ask all peers for their chain
+		l.broadcast(ChainRequestMessage{})
+	})
+
+	if len(chains) == 0 {
+		log.Warn("No peers sent us their chain in time. Skipping consensus...")
+		return
 	}
 
 	// Run our consensus function
-	l.Consensus(chains...)
+	l.consensus(chains)
 }
 
-// BroadcastBlock sends a block to all of our peers.
+// collectPeerChains calls requestChains and then waits for chains to arrive (through receiveChain).
+// It returns once we have MinimumChainsForConsensus chains or ConsensusTimeout has passed, with whatever chains arrived.
+// If another round of consensus is already waiting on chains, it returns nil straight away.
+func (l *LocalNode) collectPeerChains(requestChains func()) []peerChain {
+	if !atomic.CompareAndSwapInt32(&l.isGettingConsensus, 0, 1) {
+		log.Info("We are already waiting on chains for peer consensus. Not starting another round...")
+		return nil
+	}
+	defer atomic.StoreInt32(&l.isGettingConsensus, 0)
+
+	// This only happens if we never started P2P (in tests)
+	if l.incomingChains == nil {
+		l.incomingChains = make(chan peerChain, l.MinimumChainsForConsensus)
+	}
+
+	// Throw away any chains that were sent to us when we weren't asking for them
+	for len(l.incomingChains) > 0 {
+		<-l.incomingChains
+	}
+
+	requestChains()
+
+	timeout := l.ConsensusTimeout
+	if timeout == 0 {
+		timeout = DefaultConsensusTimeout
+	}
+
+	deadline := time.NewTimer(timeout)
+	defer deadline.Stop()
+
+	// Get the minimum amount of chains we need for consensus in slice (or as many as we can before the deadline)
+	var chains = make([]peerChain, 0)
+	for len(chains) < l.MinimumChainsForConsensus {
+		select {
+		case incomingChain := <-l.incomingChains:
+			chains = append(chains, incomingChain)
+		case <-deadline.C:
+			log.Warnf("Only got %d of the %d chains we wanted for consensus before timing out.", len(chains), l.MinimumChainsForConsensus)
+			return chains
+		case <-l.Done():
+			// We are stopping, so there's no point waiting on chains
+			return nil
+		}
+	}
+
+	return chains
+}
+
+// receiveChain hands a chain sent to us by a peer to the current round of consensus (so the peer can be penalized if it's invalid).
+// It never blocks: if nobody is waiting on chains (or we already have enough), the chain is dropped once our buffer is full.
+func (l *LocalNode) receiveChain(chain []Block, from noise.ID) {
+	select {
+	case l.incomingChains <- peerChain{blocks: chain, from: &from}:
+	default:
+		log.Info("We got a chain we didn't need for consensus. Ignoring it...")
+	}
+}
+
+// BroadcastBlock announces a block's hash to all of our peers that don't have it yet.
+// Peers that don't have the block will request it from us.
 func (l *LocalNode) BroadcastBlock(b Block) {
-	l.broadcast(NodeMessage{
-		MessageType: newBlock,
-		Body:        b,
-	})
+	announced := l.announceInventory(Inventory{Blocks: []string{b.hash()}})
 
-	log.Info("Sent peer(s) a block!")
+	log.Infof("Announced a block to %d peer(s)!", announced)
 }
 
-// BroadcastTransaction sends a transaction to all of our peers.
+// RelayBlock announces a block we got from a peer (and already validated) to all of our other peers that don't have it yet.
+func (l *LocalNode) RelayBlock(b Block, from string) {
+	// Never send a block back to the peer that gave it to us.
+	l.inventory.markKnown(from, b.hash())
+
+	announced := l.announceInventory(Inventory{Blocks: []string{b.hash()}})
+
+	log.Infof("Relayed a block from %s to %d peer(s)!", from, announced)
+}
+
+// BroadcastTransaction announces a transaction's ID to all of our peers that don't have it yet.
+// Peers that don't have the transaction will request it from us.
 func (l *LocalNode) BroadcastTransaction(t Transaction) {
-	l.broadcast(NodeMessage{
-		MessageType: newTransaction,
-		Body:        t,
-	})
+	announced := l.announceInventory(Inventory{Transactions: []string{t.hash()}})
 
-	log.Info("Sent peer(s) a transaction!")
+	log.Infof("Announced a transaction to %d peer(s)!", announced)
+}
+
+// SendPeerInventory sends a specific peer the full blocks and transactions it asked for (that we have).
+func (l *LocalNode) SendPeerInventory(inventory Inventory, address string) {
+	state := l.Snapshot()
+
+	for _, hash := range inventory.Blocks {
+		block, ok := FindBlockByHash(state.Chain, hash)
+		if !ok {
+			continue
+		}
+
+		if err := l.sendMessageToPeer(BlockMessage{Block: block}, address); err != nil {
+			log.Errorf("Failed to send block to %s", address)
+			continue
+		}
+
+		l.inventory.markKnown(address, hash)
+	}
+
+	for _, transaction := range TransactionsWithIDs(state.MemPool, inventory.Transactions) {
+		if err := l.sendMessageToPeer(TransactionMessage{Transaction: transaction}, address); err != nil {
+			log.Errorf("Failed to send transaction to %s", address)
+			continue
+		}
+
+		l.inventory.markKnown(address, transaction.hash())
+	}
 }
 
 // SendPeerOurChain sends a specific peer our chain.
 func (l *LocalNode) SendPeerOurChain(address string) {
-	err := l.sendMessageToPeer(NodeMessage{
-		MessageType: thisIsMyChain,
-		Body:        l.Chain,
-	}, address)
+	err := l.sendMessageToPeer(ChainResponseMessage{Chain: l.Snapshot().Chain}, address)
 
 	log.Info("Sent peer our chain!")
 
@@ -147,17 +262,101 @@ func (l *LocalNode) SendPeerOurChain(address string) {
 	}
 }
 
-// Starts all P2P functions. Takes a list of seedNodes.
-func (l *LocalNode) Start(seedNodes []string) {
+// RequestPeerMemPool asks a specific peer for the IDs of the transactions in its MemPool.
+// The peer's answer is used to fetch only the transactions we are missing.
+func (l *LocalNode) RequestPeerMemPool(address string) {
+	err := l.sendMessageToPeer(MemPoolRequestMessage{}, address)
 
-	// Create a new configured node.
-	node, err := noise.NewNode(noise.WithNodeBindHost(GetOutboundIP()), noise.WithNodeAddress(fmt.Sprintf("%s:%d", GetOutboundIP().String(), PortP2P)), noise.WithNodeBindPort(PortP2P))
-	check(err)
+	if err != nil {
+		log.Errorf("Failed to request the MemPool of %s", address)
+	}
+}
+
+// SendPeerOurMemPool sends a specific peer the IDs of the transactions in our MemPool.
+func (l *LocalNode) SendPeerOurMemPool(address string) {
+	err := l.sendMessageToPeer(MemPoolInventoryMessage{TransactionIDs: TransactionIDs(l.Snapshot().MemPool)}, address)
+
+	if err != nil {
+		log.Errorf("Failed to send our MemPool to %s", address)
+	}
+}
+
+// handleTransactionFromPeer adds a transaction we got from a peer to our MemPool, relaying it if relay is set and it was new and valid.
+// Only a bad signature is the peer's fault: peers announce transactions we already have all the time,
+// and if our validation server is down we can't tell whether it was valid.
+func (l *LocalNode) handleTransactionFromPeer(transaction Transaction, from noise.ID, relay bool) {
+	switch err := l.addTransactionToMemPool(transaction, relay); err {
+	case nil, errKnownTransaction, errMemPoolFull:
+	case errInvalidSignature:
+		l.penalizePeer(from, penaltyInvalidTransaction, "sent us a transaction with an invalid signature")
+	case errInvalidRecipient, errLockTooLong:
+		log.Warnf("%s sent us a transaction we don't accept. It was not added. [reason: %s]", from.Address, err)
+	default:
+		log.Errorf("We couldn't check the signatures of a transaction from %s. It was not added. [error: %s]", from.Address, err)
+	}
+}
+
+// handleTransactionsFromPeer adds the transactions a peer sent us from their MemPool to ours.
+// Only the transactions we asked that peer for are accepted (see markSolicited), and invalid ones are penalized (see handleTransactionFromPeer).
+// These came from a peer's MemPool, so every other peer should already know about them (meaning they aren't relayed).
+func (l *LocalNode) handleTransactionsFromPeer(transactions []Transaction, from noise.ID) {
+	if len(transactions) > maxTransactionsPerRequest {
+		l.penalizePeer(from, penaltyUnsolicitedTransactions, "sent us more MemPool transactions than we ask for at once")
+		return
+	}
+
+	for _, transaction := range transactions {
+		id := transaction.hash()
+
+		if !l.inventory.takeSolicited(from.Address, id) {
+			log.Warnf("%s sent us a MemPool transaction we didn't ask for. It was ignored.", from.Address)
+			continue
+		}
 
-	defer func() { log.Warn("Closing node..."); node.Close() }()
+		l.inventory.markKnown(from.Address, id)
+
+		l.handleTransactionFromPeer(transaction, from, false)
+	}
+}
+
+// startP2P creates our P2P node, has it start listening for peers, and connects to the seed nodes. It doesn't block.
+func (l *LocalNode) startP2P(seedNodes []string) error {
+	l.inventory = newKnownInventory()
+	l.orphans = newOrphanPool()
+	l.peers = newPeerBook()
+	l.incomingChains = make(chan peerChain, l.MinimumChainsForConsensus)
+
+	bans, err := newBanList(l.BanListPath)
+	if err != nil {
+		log.Errorf("Failed to load our ban list from %s. Starting with an empty one... [error: %s]", l.BanListPath, err)
+		bans, _ = newBanList("")
+	}
+	l.bans = bans
+
+	listenHost, listenPort, err := l.listenHostPort()
+	if err != nil {
+		return fmt.Errorf("our listen address (%s) is invalid: %w", l.listenAddress(), err)
+	}
+
+	options := []noise.NodeOption{noise.WithNodeBindHost(listenHost), noise.WithNodeBindPort(listenPort), noise.WithNodeMaxRecvMessageSize(MaxMessageSize)}
+
+	advertisedAddress, err := l.advertisedAddress(listenHost, listenPort)
+	if err != nil {
+		return fmt.Errorf("our advertised address (%s) is invalid: %w", l.AdvertisedAddress, err)
+	}
+
+	if advertisedAddress != "" {
+		options = append(options, noise.WithNodeAddress(advertisedAddress))
+	}
+
+	// Create a new configured node.
+	node, err := noise.NewNode(options...)
+	if err != nil {
+		return fmt.Errorf("failed to create our P2P node: %w", err)
+	}
 
-	// Register the chatMessage Go type to the node with an associated unmarshal function.
-	node.RegisterMessage(NodeMessage{}, unMarshalNodeMessage)
+	// Register our wire messages to the node with an associated unmarshal function (which also decodes old gob NodeMessages).
+	node.RegisterMessage(wireEnvelope{}, unMarshalWireEnvelope)
 
 	// Register a message handler to the node.
 	node.Handle(func(ctx noise.HandlerContext) error {
@@ -165,65 +364,172 @@ func (l *LocalNode) Start(seedNodes []string) {
 			return nil
 		}
 
+		// A message from a peer must never crash our node. Messages that can't be decoded are penalized below,
+		// so a panic after that is our own bug (and not the peer's fault).
+		defer func() {
+			if r := recover(); r != nil {
+				log.Errorf("We panicked while handling a message from %s! [error: %v]", ctx.ID().Address, r)
+			}
+		}()
+
+		// Ignore everything banned peers send us
+		if l.IsPeerBanned(peerKey(ctx.ID())) {
+			return nil
+		}
+
 		obj, err := ctx.DecodeMessage()
-		check(err)
+		if err != nil {
+			log.Errorf("Message was unable to be decoded! [error: %s]", err)
+			l.penalizePeer(ctx.ID(), penaltyUndecodableMessage, "sent us a message we couldn't decode")
+			return nil
+		}
 
-		msg, ok := obj.(NodeMessage)
+		envelope, ok := obj.(wireEnvelope)
 		if !ok {
-			log.Error("NodeMessage was unable to be deserialized!")
+			// This is a message for another protocol (like Kademlia)
+			return nil
+		}
+
+		_, isHello := envelope.WireMessage.(HelloMessage)
+
+		// New nodes send us our wire format (or a Hello), so they understand it too.
+		if isHello || !envelope.legacy {
+			l.peers.markWireFormat(ctx.ID().Address)
+		}
+
+		// Peers have to tell us which network they are on before we listen to anything else they say (see awaitingHello).
+		if !isHello && l.awaitingHello(ctx.ID().Address) {
+			log.Infof("Ignoring a message from %s as they haven't sent us a hello yet.", ctx.ID().Address)
 			return nil
 		}
 
-		switch msg.MessageType {
+		switch msg := envelope.WireMessage.(type) {
+
+		case HelloMessage:
+			l.handleHello(msg.Hello, ctx.ID())
 
-		case needChain:
+		case ChainRequestMessage:
 			log.Info("A peer just requested our chain!")
 
 			// If a fellow node needs our chain, send it to them!
 			l.SendPeerOurChain(ctx.ID().Address)
 
-		case newBlock:
+		case BlockMessage:
 			log.Info("A peer just gave us a new block!")
 
-			block, ok := msg.Body.(Block)
-			if !ok {
-				log.Error("Block was unable to be deserialized!")
+			l.inventory.markKnown(ctx.ID().Address, msg.Block.hash())
+
+			l.handleBlockFromPeer(msg.Block, ctx.ID())
+
+		case TransactionMessage:
+			log.Info("A peer just gave us a new transaction!")
+
+			transaction := msg.Transaction
+
+			l.inventory.markKnown(ctx.ID().Address, transaction.hash())
+
+			l.handleTransactionFromPeer(transaction, ctx.ID(), true)
+
+		case ChainResponseMessage:
+			chain := msg.Chain
+
+			// A chain that doesn't start with our genesis block can never win consensus, so it's a waste of our time.
+			if len(chain) == 0 || chain[0].hash() != l.Snapshot().Chain[0].hash() {
+				l.penalizePeer(ctx.ID(), penaltyInvalidChain, "sent us a chain with a different genesis block")
 				break
 			}
 
-			// If our peer's mined block was valid and added to chain:
-			if l.AddMinedBlockToChain(block) == true {
-				log.Info("We just got a new mined block from a peer and added it to the chain!")
-			} else {
-				log.Warn("The block we just got from a peer was not valid! It was not added to the chain and the UTXO was not updated!")
-			}
+			log.Infof("We just got a chain from one of our peers! It has %d block(s).", len(chain))
 
-		case newTransaction:
-			log.Info("A peer just gave us a new transaction!")
+			// Add the incoming chain we requested to our channel
+			l.receiveChain(chain, ctx.ID())
 
-			transaction, ok := msg.Body.(Transaction)
-			if !ok {
-				log.Error("Transaction was unable to be deserialized!")
+		case MemPoolRequestMessage:
+			log.Info("A peer just requested our MemPool!")
+
+			// Send the peer the IDs of our MemPool transactions so it can ask for the ones it is missing.
+			l.SendPeerOurMemPool(ctx.ID().Address)
+
+		case MemPoolInventoryMessage:
+			l.markInventoryKnown(ctx.ID().Address, Inventory{Transactions: msg.TransactionIDs})
+
+			missingIDs := MissingTransactionIDs(msg.TransactionIDs, l.Snapshot().MemPool)
+
+			if len(missingIDs) == 0 {
 				break
 			}
 
-			// If a peer has gotten a new transaction request, add it to our MemPool.
-			l.AddTransactionToMemPool(transaction)
+			log.Infof("A peer has %d transaction(s) we don't have in our MemPool. Requesting them...", len(missingIDs))
+
+			if len(missingIDs) > maxTransactionsPerRequest {
+				missingIDs = missingIDs[:maxTransactionsPerRequest]
+			}
+
+			// Only the transactions we ask for are accepted (see handleTransactionsFromPeer).
+			l.inventory.markSolicited(ctx.ID().Address, missingIDs)
 
-		case thisIsMyChain:
-			chain, ok := msg.Body.([]Block)
-			if !ok {
-				log.Error("Chain was unable to be deserialized!")
+			err := l.sendMessageToPeer(TransactionsRequestMessage{TransactionIDs: missingIDs}, ctx.ID().Address)
+
+			if err != nil {
+				log.Errorf("Failed to request missing transactions from %s", ctx.ID().Address)
+			}
+
+		case TransactionsRequestMessage:
+			ids := msg.TransactionIDs
+			if len(ids) > maxTransactionsPerRequest {
+				ids = ids[:maxTransactionsPerRequest]
+			}
+
+			err := l.sendMessageToPeer(TransactionsMessage{Transactions: TransactionsWithIDs(l.Snapshot().MemPool, ids)}, ctx.ID().Address)
+
+			if err != nil {
+				log.Errorf("Failed to send transactions to %s", ctx.ID().Address)
+			}
+
+		case TransactionsMessage:
+			log.Infof("A peer just gave us %d transaction(s) from its MemPool!", len(msg.Transactions))
+
+			l.handleTransactionsFromPeer(msg.Transactions, ctx.ID())
+
+		case InventoryMessage:
+			inventory := msg.Inventory
+
+			// The peer that announced these items obviously has them.
+			l.markInventoryKnown(ctx.ID().Address, inventory)
+
+			// Only ask for the items we don't have and haven't already asked another peer for.
+			wanted := Inventory{}
+			state := l.Snapshot()
+
+			for _, hash := range inventory.Blocks {
+				if _, ok := FindBlockByHash(state.Chain, hash); !ok && l.inventory.markRequested(hash) {
+					wanted.Blocks = append(wanted.Blocks, hash)
+				}
+			}
+
+			for _, id := range MissingTransactionIDs(inventory.Transactions, state.MemPool) {
+				if l.inventory.markRequested(id) {
+					wanted.Transactions = append(wanted.Transactions, id)
+				}
+			}
+
+			if len(wanted.Blocks) == 0 && len(wanted.Transactions) == 0 {
 				break
 			}
 
-			log.Infof("We just got a chain from one of our peers! Here is the amount of the first transaction of the genesis block: %d", chain[0].Transactions[0].Amount)
+			err := l.sendMessageToPeer(InventoryRequestMessage{Inventory: wanted}, ctx.ID().Address)
 
-			// Add the incoming chain we requested to our channel
-			l.incomingChains <- chain
+			if err != nil {
+				log.Errorf("Failed to request inventory from %s", ctx.ID().Address)
+			}
+
+		case InventoryRequestMessage:
+			l.SendPeerInventory(msg.Inventory, ctx.ID().Address)
 
 		default:
-			log.Panic("We got an invalid message type!")
+			// DecodeWireMessage rejects unknown message types, so this should never happen.
+			log.Error("We got an invalid message type!")
+			l.penalizePeer(ctx.ID(), penaltyUndecodableMessage, "sent us an invalid message type")
 		}
 
 		return nil
@@ -233,9 +539,21 @@ func (l *LocalNode) Start(seedNodes []string) {
 	events := kademlia.Events{
 		OnPeerAdmitted: func(id noise.ID) {
 			log.Infof("Learned about a new peer %s.\n", id.Address)
+
+			if l.IsPeerBanned(peerKey(id)) {
+				log.Infof("Disconnecting from %s as they are banned.", id.Address)
+				go l.disconnectPeer(peerKey(id))
+				return
+			}
+
+			// Tell the new peer which network we are on. We'll start syncing with them once they send theirs.
+			go l.SendHello(id.Address)
 		},
 		OnPeerEvicted: func(id noise.ID) {
 			log.Infof("Forgotten a peer (as we pinged them and they didn't respond) %s.\n", id.Address)
+
+			l.inventory.forget(id.Address)
+			l.peers.forget(id.Address)
 		},
 	}
 
@@ -244,30 +562,27 @@ func (l *LocalNode) Start(seedNodes []string) {
 	// Bind Kademlia to the node.
 	node.Bind(overlay.Protocol())
 
-	// Have the node start listening for new peers.
-	check(node.Listen())
-
-	// Ping nodes to initially bootstrap and discover peers from.
-	bootstrap(node, seedNodes)
-
-	// Attempt to discover peers if we are bootstrapped to any nodes.
-	discover(overlay)
-
+	// Peers can be admitted as soon as we start listening, so we need these set up first.
 	l.node = node
 	l.kademliaProtocol = overlay
 
-	// Wait 3 seconds
-	time.Sleep(3 * time.Second)
+	// Have the node start listening for new peers.
+	if err := node.Listen(); err != nil {
+		node.Close()
+		l.node, l.kademliaProtocol = nil, nil
 
-	log.Info("We've started P2P! Now trying to get peer consensus...")
+		return fmt.Errorf("failed to listen for peers on %s: %w", l.listenAddress(), err)
+	}
 
-	// Get peer consensus
-	l.GetPeerConsensus()
+	log.Infof("Listening for peers on %s (advertised to peers as %s).", l.listenAddress(), node.Addr())
 
-	log.Info("Got peer consensus over P2P!")
+	// Ping nodes to initially bootstrap and discover peers from.
+	bootstrap(node, seedNodes)
 
-	WaitForCtrlC()
+	// Attempt to discover peers if we are bootstrapped to any nodes.
+	discover(overlay)
 
+	return nil
 }
 
 // bootstrap pings and dials an array of network addresses which we may interact with and  discover peers from.
@@ -301,29 +616,3 @@ func discover(overlay *kademlia.Protocol) {
 		log.Warn("Did not discover any peers.")
 	}
 }
-
-// Get preferred outbound ip of this machine
-func GetOutboundIP() net.IP {
-	conn, err := net.Dial("udp", "8.8.8.8:80")
-	if err != nil {
-		log.Fatal(err)
-	}
-	defer conn.Close()
-
-	localAddr := conn.LocalAddr().(*net.UDPAddr)
-
-	return localAddr.IP
-}
-
-func WaitForCtrlC() {
-	var endWaiter sync.WaitGroup
-	endWaiter.Add(1)
-	var signalChannel chan os.Signal
-	signalChannel = make(chan os.Signal, 1)
-	signal.Notify(signalChannel, os.Interrupt)
-	go func() {
-		<-signalChannel
-		endWaiter.Done()
-	}()
-	endWaiter.Wait()
-}
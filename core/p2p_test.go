@@ -0,0 +1,198 @@
+package core
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestLocalNode_CollectPeerChains(t *testing.T) {
+	localNode := LocalNode{Chain: []Block{testGenesisBlock}, MemPool: make([]Transaction, 0), UTXO: make(UTXO), ValidationServerURL: validationServer, OperatorPublicKey: "0", MinimumChainsForConsensus: 3, ConsensusTimeout: 100 * time.Millisecond}
+	peer := newTestPeer(t, "peer1")
+
+	// No peers respond
+	chains := localNode.collectPeerChains(func() {})
+	assert.Empty(t, chains)
+
+	// Some peers respond
+	chains = localNode.collectPeerChains(func() {
+		localNode.receiveChain([]Block{testGenesisBlock}, peer)
+		localNode.receiveChain([]Block{testGenesisBlock}, peer)
+	})
+	assert.Len(t, chains, 2)
+	assert.Equal(t, peerKey(peer), peerKey(*chains[0].from))
+
+	// All the peers we need respond (so we don't wait for the timeout)
+	localNode.ConsensusTimeout = time.Minute
+	start := time.Now()
+	chains = localNode.collectPeerChains(func() {
+		for i := 0; i < 3; i++ {
+			localNode.receiveChain([]Block{testGenesisBlock}, peer)
+		}
+	})
+	assert.Len(t, chains, 3)
+	assert.True(t, time.Since(start) < localNode.ConsensusTimeout)
+}
+
+func TestLocalNode_ReceiveChain(t *testing.T) {
+	localNode := LocalNode{Chain: []Block{testGenesisBlock}, MemPool: make([]Transaction, 0), UTXO: make(UTXO), ValidationServerURL: validationServer, OperatorPublicKey: "0", MinimumChainsForConsensus: 1, ConsensusTimeout: 100 * time.Millisecond}
+	peer := newTestPeer(t, "peer1")
+
+	// Unsolicited chains never block or panic (even before P2P was started)
+	localNode.receiveChain([]Block{testGenesisBlock}, peer)
+
+	localNode.incomingChains = make(chan peerChain, 1)
+	localNode.receiveChain([]Block{}, peer)
+	localNode.receiveChain([]Block{}, peer)
+
+	// Unsolicited chains are thrown away before a new round of consensus starts
+	chains := localNode.collectPeerChains(func() {})
+	assert.Empty(t, chains)
+}
+
+func TestLocalNode_GetPeerConsensus(t *testing.T) {
+	localNode := LocalNode{Chain: []Block{testGenesisBlock}, MemPool: make([]Transaction, 0), UTXO: make(UTXO), ValidationServerURL: validationServer, OperatorPublicKey: "0", MinimumChainsForConsensus: 4, ConsensusTimeout: 100 * time.Millisecond}
+
+	// We have no peers, so this should give up after the timeout instead of hanging forever
+	localNode.GetPeerConsensus()
+	assert.Equal(t, []Block{testGenesisBlock}, localNode.Chain)
+}
+
+func TestLocalNode_Consensus_PenalizesInvalidChains(t *testing.T) {
+	fakeValidationServer := newFakeValidationServer(true)
+	defer fakeValidationServer.Close()
+
+	localNode := newTestMinerNode(fakeValidationServer.URL)
+	localNode.bans, _ = newBanList("")
+
+	honest, tamperer := newTestPeer(t, "peer1"), newTestPeer(t, "peer2")
+
+	// A chain with our genesis block, but a block that was changed after it was mined
+	tampered := harnessBlock2
+	tampered.Transactions = append([]Transaction{}, harnessBlock2.Transactions...)
+	tampered.Transactions[1].Amount = 1000
+
+	chains := []peerChain{
+		{blocks: []Block{testGenesisBlock, harnessBlock1, tampered}, from: &tamperer},
+		{blocks: []Block{testGenesisBlock, harnessBlock1}, from: &honest},
+	}
+
+	assert.True(t, localNode.consensus(chains))
+	assert.Equal(t, []Block{testGenesisBlock, harnessBlock1}, localNode.Snapshot().Chain)
+
+	assert.True(t, localNode.IsPeerBanned(peerKey(tamperer)))
+	assert.False(t, localNode.IsPeerBanned(peerKey(honest)))
+	assert.Equal(t, 0, localNode.bans.score(peerKey(honest)))
+
+	// Nobody is penalized when our validation server is down
+	fakeValidationServer.Close()
+
+	other := newTestPeer(t, "peer3")
+	assert.False(t, localNode.consensus([]peerChain{{blocks: []Block{testGenesisBlock, harnessBlock1, harnessBlock2}, from: &other}}))
+	assert.Equal(t, 0, localNode.bans.score(peerKey(other)))
+	assert.False(t, localNode.IsPeerBanned(peerKey(other)))
+}
+
+func TestLocalNode_HandleTransactionFromPeer(t *testing.T) {
+	fakeValidationServer := newFakeValidationServer(true)
+	defer fakeValidationServer.Close()
+
+	localNode := newTestMinerNode(fakeValidationServer.URL)
+	localNode.bans, _ = newBanList("")
+
+	peer := newTestPeer(t, "peer1")
+	transaction := harnessBlock1.Transactions[1]
+
+	localNode.handleTransactionFromPeer(transaction, peer, false)
+	assert.Equal(t, []Transaction{transaction}, localNode.Snapshot().MemPool)
+
+	// Peers announce transactions we already have all the time, so that isn't misbehaviour
+	localNode.handleTransactionFromPeer(transaction, peer, false)
+	assert.Equal(t, 0, localNode.bans.score(peerKey(peer)))
+
+	// Nobody is penalized when our validation server is down
+	fakeValidationServer.Close()
+
+	other := harnessBlock2.Transactions[1]
+	localNode.handleTransactionFromPeer(other, peer, false)
+	assert.Equal(t, 0, localNode.bans.score(peerKey(peer)))
+
+	// Only a bad signature is the peer's fault
+	invalid := newFakeValidationServer(false)
+	defer invalid.Close()
+	localNode.ValidationServerURL = invalid.URL
+
+	localNode.handleTransactionFromPeer(other, peer, false)
+	assert.Equal(t, penaltyInvalidTransaction, localNode.bans.score(peerKey(peer)))
+	assert.Equal(t, []Transaction{transaction}, localNode.Snapshot().MemPool)
+}
+
+func TestLocalNode_HandleTransactionsFromPeer(t *testing.T) {
+	fakeValidationServer := newFakeValidationServer(true)
+	defer fakeValidationServer.Close()
+
+	localNode := newTestMinerNode(fakeValidationServer.URL)
+	localNode.bans, _ = newBanList("")
+	localNode.inventory = newKnownInventory()
+
+	peer := newTestPeer(t, "peer1")
+	requested, unrequested := harnessBlock1.Transactions[1], harnessBlock2.Transactions[1]
+
+	// Only the transactions we asked the peer for are accepted
+	localNode.inventory.markSolicited(peer.Address, []string{requested.hash()})
+	localNode.handleTransactionsFromPeer([]Transaction{requested, unrequested}, peer)
+	assert.Equal(t, []Transaction{requested}, localNode.Snapshot().MemPool)
+	assert.Equal(t, 0, localNode.bans.score(peerKey(peer)))
+
+	// Invalid transactions are penalized
+	invalid := newFakeValidationServer(false)
+	defer invalid.Close()
+	localNode.ValidationServerURL = invalid.URL
+
+	localNode.inventory.markSolicited(peer.Address, []string{unrequested.hash()})
+	localNode.handleTransactionsFromPeer([]Transaction{unrequested}, peer)
+	assert.Equal(t, penaltyInvalidTransaction, localNode.bans.score(peerKey(peer)))
+
+	// Peers can't send us more transactions than we would ever ask for
+	localNode.handleTransactionsFromPeer(make([]Transaction, maxTransactionsPerRequest+1), peer)
+	assert.Equal(t, penaltyInvalidTransaction+penaltyUnsolicitedTransactions, localNode.bans.score(peerKey(peer)))
+	assert.Equal(t, []Transaction{requested}, localNode.Snapshot().MemPool)
+}
+
+func TestNetwork_AnnouncesToPeersButNotBackToOrigin(t *testing.T) {
+	network := newTestNetwork(t, 3)
+	origin, relay, other := network.nodes[0], network.nodes[1], network.nodes[2]
+
+	network.waitFor("every node to complete a handshake with every other node", func() bool {
+		for _, node := range network.nodes {
+			if len(node.Peers()) < 2 {
+				return false
+			}
+		}
+
+		return true
+	})
+
+	// The origin can only hear about what it gave the relay from the relay
+	network.partition([]int{0}, []int{2})
+
+	// The relay gets a new transaction and block from the origin (like its handler does)
+	transaction := harnessBlock1.Transactions[1]
+	relay.inventory.markKnown(origin.Address(), transaction.hash())
+	relay.handleTransactionFromPeer(transaction, origin.node.ID(), true)
+
+	assert.True(t, relay.AddMinedBlockToChain(harnessBlock1))
+	relay.RelayBlock(harnessBlock1, origin.Address())
+
+	// They are announced to the peer that doesn't know them
+	network.waitFor("the block to reach the other node", func() bool {
+		return len(other.Snapshot().Chain) == 2
+	})
+	assert.True(t, other.inventory.isKnown(relay.Address(), transaction.hash()))
+	assert.True(t, other.inventory.isKnown(relay.Address(), harnessBlock1.hash()))
+
+	// But never back to the origin (which would mark them as known by the relay once it heard about them)
+	assert.Never(t, func() bool {
+		return origin.inventory.isKnown(relay.Address(), transaction.hash()) || origin.inventory.isKnown(relay.Address(), harnessBlock1.hash())
+	}, time.Second, 50*time.Millisecond)
+}
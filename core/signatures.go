@@ -11,22 +11,83 @@ type ValidationResponse struct {
 	ValidSignature bool `json:"valid_signature"`
 }
 
+// Puts a transaction into the format its signature is made over: SENDER_KEY -AMOUNT-> RECIPIENT_KEY (TIMESTAMP_SECONDS)
+// Locked transactions have " [LOCKED UNTIL LOCK_TIME]" on the end, so the lock can't be changed or removed without the sender's signature,
+// and output-based and batch transactions have their inputs and outputs or payments on the end (see outputsRepresentation and batchRepresentation).
+func TransactionRepresentation(transaction Transaction) string {
+	representation := fmt.Sprintf("%v -%v-> %v (%v)", transaction.Sender, transaction.Amount, transaction.Recipient, transaction.Timestamp)
+
+	if transaction.LockTime != 0 {
+		representation += fmt.Sprintf(" [LOCKED UNTIL %v]", transaction.LockTime)
+	}
+
+	if transaction.isOutputBased() {
+		representation += outputsRepresentation(transaction)
+	}
+
+	if transaction.isBatch() {
+		representation += batchRepresentation(transaction)
+	}
+
+	return representation
+}
+
 // A function that validates the signature on a transaction by requesting its validity from a validationServerURL.
+// If the validation server can't be reached, the signature is treated as invalid.
 func ValidateSignature(transaction Transaction, validationServerURL string) bool {
+	// The signature is over the sender as they wrote it, but the key is checked in its canonical form
+	valid, err := validateSignature(transaction.Signature, TransactionRepresentation(transaction), transaction.Sender, validationServerURL)
+	if err != nil {
+		log.Error(err)
+	}
+
+	return valid
+}
+
+// Validates the signatures on a transaction: the signature of its sender, or enough signatures from the keys of a multisig sender.
+// If the validation server can't be reached, the signatures are treated as invalid.
+func ValidateTransactionSignatures(transaction Transaction, validationServerURL string) bool {
+	valid, err := validateTransactionSignatures(transaction, validationServerURL)
+	if err != nil {
+		log.Error(err)
+	}
+
+	return valid
+}
+
+// Validates the signatures on a transaction (see ValidateTransactionSignatures).
+// It returns an error if the validation server couldn't tell us whether they are valid (which isn't the transaction's fault).
+func validateTransactionSignatures(transaction Transaction, validationServerURL string) (bool, error) {
+	if transaction.isMultisig() || len(transaction.Signatures) > 0 {
+		return validateMultisigSignatures(transaction, validationServerURL)
+	}
+
+	return validateSignature(transaction.Signature, TransactionRepresentation(transaction), transaction.Sender, validationServerURL)
+}
+
+// Validates a signature over a transaction representation by a public key (in any form) with a validationServerURL.
+// It returns an error if the validation server couldn't tell us whether the signature is valid.
+func validateSignature(signature string, transactionRepresentation string, publicKey string, validationServerURL string) (bool, error) {
 	client := resty.New()
 
-	// Put the transaction into transactionRep format: SENDER_KEY -AMOUNT-> RECIPIENT_KEY (TIMESTAMP_SECONDS)
-	transactionRepresentation := fmt.Sprintf("%v -%v-> %v (%v)", transaction.Sender, transaction.Amount, transaction.Recipient, transaction.Timestamp)
+	publicKey, err := CanonicalPublicKey(publicKey)
+	if err != nil {
+		return false, nil
+	}
 
 	resp, err := client.R().
 		SetHeader("Content-Type", "application/json").
-		SetBody(map[string]interface{}{"signature": transaction.Signature, "transactionRepresentation": transactionRepresentation, "publicKey": transaction.Sender}).
+		SetBody(map[string]interface{}{"signature": signature, "transactionRepresentation": transactionRepresentation, "publicKey": publicKey}).
 		SetResult(ValidationResponse{}).
 		Post(validationServerURL)
 
 	if err != nil {
-		log.Panic("Signature validation server is returning an error!")
+		return false, fmt.Errorf("signature validation server is returning an error: %w", err)
+	}
+
+	if resp.IsError() {
+		return false, fmt.Errorf("signature validation server responded with %s", resp.Status())
 	}
 
-	return resp.Result().(*ValidationResponse).ValidSignature
+	return resp.Result().(*ValidationResponse).ValidSignature, nil
 }
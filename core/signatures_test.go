@@ -2,9 +2,24 @@ package core
 
 import (
 	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
 	"testing"
 )
 
+// newFakeValidationServer starts a local signature validation server that reports every signature as valid (or invalid),
+// so tests that validate blocks don't need to reach the real validation server.
+func newFakeValidationServer(valid bool) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if valid {
+			w.Write([]byte(`{"valid_signature": true}`))
+		} else {
+			w.Write([]byte(`{"valid_signature": false}`))
+		}
+	}))
+}
+
 func TestValidateSignature(t *testing.T) {
 	// Valid URL
 	transaction := Transaction{Sender: "0458adabe2c014de6c3fd2f2c865c2ca7fe823a4131a4d22f98dcc77f1bffc8aeacf8a0b7949321c33214e9c1b2201063404a321110be8223ad1685ee32c9c02d0", Recipient: "046007e213c57ccab18af3f3b385893da75514ab691216152955d70937744dbe040de0ea504ebe29bce2476ae37c794cf5e7d96c8bc2ad153eb434b148f1af6f6c", Amount: 15, Timestamp: 1586117966, Signature: "3046022100d158259aae3c7c9e3e6cd33a3b47134723ddc4cae25484e8a5df28f45ee462fd022100b6c6600f89a3ef050a8aab14c8a96ca5b5b9c8fa358945c9f53dda1b488dd43c"}
@@ -14,10 +29,46 @@ func TestValidateSignature(t *testing.T) {
 	assert.False(t, ValidateSignature(invalidTransaction, "https://crows.sh/verifySignature"))
 
 	// Invalid URL
-	defer func() {
-		if r := recover(); r == nil {
-			assert.Fail(t, "ValidateSignature did not panic with invalid validationServerURL!")
-		}
-	}()
-	ValidateSignature(transaction, "notreal.google.com")
+	assert.False(t, ValidateSignature(transaction, "notreal.google.com"))
+}
+
+func TestValidateTransactionSignatures_ServerDown(t *testing.T) {
+	transaction := harnessBlock1.Transactions[1]
+
+	// A validation server that can't be reached (or responds with an error) can't tell us whether a signature is invalid
+	unreachable := newFakeValidationServer(true)
+	unreachable.Close()
+
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer failing.Close()
+
+	for _, url := range []string{unreachable.URL, failing.URL} {
+		valid, err := validateTransactionSignatures(transaction, url)
+		assert.False(t, valid)
+		assert.Error(t, err)
+
+		assert.False(t, ValidateTransactionSignatures(transaction, url))
+
+		localNode := newTestMinerNode(url)
+
+		err = localNode.addTransactionToMemPool(transaction, false)
+		assert.Error(t, err)
+		assert.NotEqual(t, errInvalidSignature, err)
+
+		added, err := localNode.addMinedBlockToChain(harnessBlock1)
+		assert.False(t, added)
+		assert.Error(t, err)
+	}
+
+	// Invalid signatures aren't errors
+	invalid := newFakeValidationServer(false)
+	defer invalid.Close()
+
+	valid, err := validateTransactionSignatures(transaction, invalid.URL)
+	assert.False(t, valid)
+	assert.NoError(t, err)
+
+	assert.Equal(t, errInvalidSignature, newTestMinerNode(invalid.URL).addTransactionToMemPool(transaction, false))
 }
@@ -10,7 +10,7 @@ func IsTransactionInMemPool(t Transaction, memPool []Transaction) bool {
 	for i := len(memPool) - 1; i >= 0; i-- {
 		memPoolTransaction := memPool[i]
 
-		if memPoolTransaction.Signature == t.Signature {
+		if memPoolTransaction.replayID() == t.replayID() {
 			return true
 		}
 	}
@@ -28,7 +28,7 @@ func IsTransactionInChain(t Transaction, chain []Block) bool {
 			// If the time of the Block's transaction is more than 25 hours before the time of the incoming transaction,
 			// its safe to assume that its not in the Blockchain.
 
-			if blockTransaction.Signature == t.Signature {
+			if blockTransaction.replayID() == t.replayID() {
 				return true
 			}
 		}
@@ -40,7 +40,7 @@ func IsTransactionInChain(t Transaction, chain []Block) bool {
 // isTransactionConfirmed checks if a transaction is in a list of confirmed transactions.
 func isTransactionConfirmed(transaction Transaction, confirmedTransactions []Transaction) bool {
 	for _, confirmedTransaction := range confirmedTransactions {
-		if transaction == confirmedTransaction {
+		if transaction.hash() == confirmedTransaction.hash() {
 			return true
 		}
 	}
@@ -61,6 +61,66 @@ func RemoveConfirmedTransactions(memPool []Transaction, confirmedTransactions []
 	return filteredMemPool
 }
 
+// TransactionIDs gets the ID (hash) of each transaction in a list of transactions.
+func TransactionIDs(transactions []Transaction) []string {
+	ids := make([]string, 0, len(transactions))
+
+	for _, transaction := range transactions {
+		ids = append(ids, transaction.hash())
+	}
+
+	return ids
+}
+
+// MissingTransactionIDs takes a list of transaction IDs and returns the ones that are not in a given MemPool.
+func MissingTransactionIDs(ids []string, memPool []Transaction) []string {
+	have := make(map[string]bool, len(memPool))
+	for _, id := range TransactionIDs(memPool) {
+		have[id] = true
+	}
+
+	missing := make([]string, 0)
+
+	for _, id := range ids {
+		if !have[id] {
+			missing = append(missing, id)
+			// Don't ask for the same transaction twice
+			have[id] = true
+		}
+	}
+
+	return missing
+}
+
+// TransactionsWithIDs gets the transactions in a MemPool that match a list of transaction IDs.
+func TransactionsWithIDs(memPool []Transaction, ids []string) []Transaction {
+	wanted := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		wanted[id] = true
+	}
+
+	transactions := make([]Transaction, 0)
+
+	for _, transaction := range memPool {
+		if wanted[transaction.hash()] {
+			transactions = append(transactions, transaction)
+		}
+	}
+
+	return transactions
+}
+
+// FindBlockByHash searches a chain for the block with a given hash.
+func FindBlockByHash(chain []Block, hash string) (Block, bool) {
+	for i := len(chain) - 1; i >= 0; i-- {
+		if chain[i].hash() == hash {
+			return chain[i], true
+		}
+	}
+
+	return Block{}, false
+}
+
 // LastBlock gets the most recent link in a chain of blocks.
 func LastBlock(chain []Block) Block {
 	return chain[len(chain)-1]
@@ -55,3 +55,32 @@ func TestCalcMean(t *testing.T) {
 	mean := calcMean([]float64{0.0, 5.0, 10.0})
 	assert.Equal(t, mean, 5.0)
 }
+
+func TestTransactionIDs(t *testing.T) {
+	transactions := []Transaction{{Signature: "test1"}, {Signature: "test2"}}
+	ids := TransactionIDs(transactions)
+	assert.Equal(t, []string{transactions[0].hash(), transactions[1].hash()}, ids)
+}
+
+func TestMissingTransactionIDs(t *testing.T) {
+	memPool := []Transaction{{Signature: "test1"}, {Signature: "test2"}}
+	missing := MissingTransactionIDs([]string{Transaction{Signature: "test1"}.hash(), "unknown", "unknown"}, memPool)
+	assert.Equal(t, []string{"unknown"}, missing)
+}
+
+func TestTransactionsWithIDs(t *testing.T) {
+	memPool := []Transaction{{Signature: "test1"}, {Signature: "test2"}, {Signature: "test3"}}
+	transactions := TransactionsWithIDs(memPool, []string{Transaction{Signature: "test3"}.hash(), "unknown"})
+	assert.Equal(t, []Transaction{{Signature: "test3"}}, transactions)
+}
+
+func TestFindBlockByHash(t *testing.T) {
+	chain := []Block{{BlockHeader: BlockHeader{Transactions: []Transaction{{Signature: "test2"}}}}, {BlockHeader: BlockHeader{Transactions: []Transaction{{Signature: "test3"}}}}}
+
+	block, ok := FindBlockByHash(chain, chain[0].hash())
+	assert.True(t, ok)
+	assert.Equal(t, chain[0], block)
+
+	_, ok = FindBlockByHash(chain, "unknown")
+	assert.False(t, ok)
+}
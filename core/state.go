@@ -0,0 +1,106 @@
+package core
+
+import "sync/atomic"
+
+// A NodeState is a node's Chain, MemPool and UTXO at one moment (see LocalNode.Snapshot).
+type NodeState struct {
+	Chain   []Block
+	MemPool []Transaction
+	UTXO    UTXO
+}
+
+// Snapshot gets our Chain, MemPool and UTXO at one moment. Unlike reading them directly, it is safe to call while the node is running.
+// The node replaces them instead of changing them, so a snapshot never changes. It must not be changed (or appended to) either.
+func (l *LocalNode) Snapshot() NodeState {
+	l.state.RLock()
+	defer l.state.RUnlock()
+
+	return NodeState{Chain: l.Chain, MemPool: l.MemPool, UTXO: l.UTXO}
+}
+
+// mintedSnapshot gets a Snapshot, along with how many coins its chain has minted (see chainMinted).
+// Our chain is valid, so the coins it minted fit in a uint64.
+func (l *LocalNode) mintedSnapshot() (NodeState, uint64) {
+	l.state.Lock()
+	defer l.state.Unlock()
+
+	minted, _ := l.chainMinted()
+
+	return NodeState{Chain: l.Chain, MemPool: l.MemPool, UTXO: l.UTXO}, minted
+}
+
+// addToMemPool adds a transaction to the MemPool. It returns errKnownTransaction if it is already in our MemPool or chain,
+// and errMemPoolFull if our MemPool already has MaxMemPoolSize transactions.
+func (l *LocalNode) addToMemPool(transaction Transaction) error {
+	l.state.Lock()
+	defer l.state.Unlock()
+
+	if IsTransactionAlreadyInMemPoolOrChain(transaction, l.MemPool, l.Chain) {
+		return errKnownTransaction
+	}
+
+	if len(l.MemPool) >= MaxMemPoolSize {
+		return errMemPoolFull
+	}
+
+	l.MemPool = append(l.MemPool, transaction)
+
+	return nil
+}
+
+// switchChain replaces our chain (and UTXO, and the coins it minted) with a valid chain, removes the chain's transactions from the MemPool and cancels mining.
+// It returns false (without changing anything) if our chain has become longer than the new chain.
+func (l *LocalNode) switchChain(chain []Block, utxo UTXO, minted uint64) bool {
+	l.state.Lock()
+	defer l.state.Unlock()
+
+	if len(chain) < len(l.Chain) {
+		return false
+	}
+
+	l.Chain = chain
+	l.UTXO = utxo
+	l.minted, l.mintedTip = minted, LastBlock(chain).hash()
+
+	// Clear the MemPool of any confirmed transactions
+	for _, block := range chain {
+		l.MemPool = RemoveConfirmedTransactions(l.MemPool, block.Transactions)
+	}
+
+	// Cancel mining
+	l.cancelMining()
+
+	return true
+}
+
+// addValidatedBlock replaces our chain with a chain that is our chain plus one valid block (and our UTXO, and the coins our chain minted,
+// with the ones after the block), and removes the block's transactions from the MemPool.
+// It returns false (without changing anything) if our chain changed since the block was validated, so the block isn't on top of it anymore.
+func (l *LocalNode) addValidatedBlock(chain []Block, utxo UTXO, minted uint64) bool {
+	l.state.Lock()
+	defer l.state.Unlock()
+
+	block := LastBlock(chain)
+	if len(chain) != len(l.Chain)+1 || block.PreviousHash != LastBlock(l.Chain).hash() {
+		return false
+	}
+
+	// Clear Mempool of confirmed transactions (transactions that are now in this block)
+	l.MemPool = RemoveConfirmedTransactions(l.MemPool, block.Transactions)
+
+	l.Chain = chain
+	l.UTXO = utxo
+	l.minted, l.mintedTip = minted, block.hash()
+
+	return true
+}
+
+// IsMining checks whether MineBlock is mining.
+func (l *LocalNode) IsMining() bool {
+	return atomic.LoadInt32(&l.mining) == 1
+}
+
+// cancelMining stops MineBlock.
+func (l *LocalNode) cancelMining() {
+	atomic.StoreInt32(&l.mining, 0)
+}
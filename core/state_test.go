@@ -0,0 +1,125 @@
+package core
+
+import (
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestLocalNode_Snapshot(t *testing.T) {
+	fakeValidationServer := newFakeValidationServer(true)
+	defer fakeValidationServer.Close()
+
+	node := newTestMinerNode(fakeValidationServer.URL)
+
+	stale := Transaction{Sender: testGenesisBlock.Transactions[0].Recipient, Recipient: harnessRecipient, Amount: 1, Timestamp: time.Now().Add(-25 * time.Hour).Unix(), Signature: "stale"}
+	assert.True(t, node.AddTransactionToMemPool(stale))
+	assert.True(t, node.AddTransactionToMemPool(harnessBlock1.Transactions[1]))
+
+	before := node.Snapshot()
+
+	assert.True(t, node.AddMinedBlockToChain(harnessBlock1))
+	node.RemoveStaleTransactions(DefaultMemPoolExpiry)
+
+	// Snapshots don't change with the node
+	assert.Equal(t, []Block{testGenesisBlock}, before.Chain)
+	assert.Equal(t, []Transaction{stale, harnessBlock1.Transactions[1]}, before.MemPool)
+	assert.Equal(t, uint64(0), before.UTXO.Balance(harnessRecipient))
+
+	after := node.Snapshot()
+	assert.Equal(t, []Block{testGenesisBlock, harnessBlock1}, after.Chain)
+	assert.Empty(t, after.MemPool)
+	assert.Equal(t, uint64(10), after.UTXO.Balance(harnessRecipient))
+}
+
+func TestLocalNode_ConcurrentUpdates(t *testing.T) {
+	fakeValidationServer := newFakeValidationServer(true)
+	defer fakeValidationServer.Close()
+
+	node := newTestMinerNode(fakeValidationServer.URL)
+
+	// Readers (like the Miner, the API and P2P handlers) run alongside the node's updates (run with -race)
+	var wg sync.WaitGroup
+	done := make(chan struct{})
+
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+
+				state := node.Snapshot()
+				LastBlock(state.Chain).hash()
+				TransactionIDs(state.MemPool)
+				state.UTXO.Balance(harnessRecipient)
+				node.NewBlockTemplate()
+			}
+		}()
+	}
+
+	for _, block := range []Block{harnessBlock1, harnessBlock2} {
+		assert.True(t, node.AddTransactionToMemPool(block.Transactions[1]))
+		node.RemoveStaleTransactions(DefaultMemPoolExpiry)
+		assert.True(t, node.AddMinedBlockToChain(block))
+	}
+
+	// Only one of two competing blocks is added
+	assert.False(t, node.AddMinedBlockToChain(harnessForkBlock))
+	assert.False(t, node.Consensus([]Block{testGenesisBlock, harnessForkBlock}))
+
+	close(done)
+	wg.Wait()
+
+	assert.Equal(t, []Block{testGenesisBlock, harnessBlock1, harnessBlock2}, node.Snapshot().Chain)
+}
+
+func TestLocalNode_AddMinedBlockToChain_ChainChangesWhileValidating(t *testing.T) {
+	var node *LocalNode
+	var changed int32
+
+	// The validation server is slow, and a competing block is added to our chain while it checks harnessBlock1
+	fakeValidationServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.CompareAndSwapInt32(&changed, 0, 1) {
+			// Our state isn't held while signatures are being checked
+			LastBlock(node.Snapshot().Chain)
+
+			assert.True(t, node.AddMinedBlockToChain(harnessForkBlock))
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"valid_signature": true}`))
+	}))
+	defer fakeValidationServer.Close()
+
+	node = newTestMinerNode(fakeValidationServer.URL)
+
+	// harnessBlock1 was valid when we started checking it, but it isn't on top of our chain anymore
+	assert.False(t, node.AddMinedBlockToChain(harnessBlock1))
+
+	state := node.Snapshot()
+	assert.Equal(t, []Block{testGenesisBlock, harnessForkBlock}, state.Chain)
+	assert.Equal(t, uint64(30), state.UTXO.Balance(harnessRecipient))
+}
+
+func TestLocalNode_AddToMemPool_Full(t *testing.T) {
+	localNode := newTestMinerNode(validationServer)
+	localNode.MemPool = make([]Transaction, MaxMemPoolSize-1)
+
+	assert.NoError(t, localNode.addToMemPool(harnessBlock1.Transactions[1]))
+	assert.Equal(t, errKnownTransaction, localNode.addToMemPool(harnessBlock1.Transactions[1]))
+
+	// Once the MemPool is full, new transactions are rejected
+	assert.Equal(t, errMemPoolFull, localNode.addToMemPool(harnessBlock2.Transactions[1]))
+	assert.Len(t, localNode.Snapshot().MemPool, MaxMemPoolSize)
+}
@@ -0,0 +1,113 @@
+package core
+
+import (
+	"sort"
+	"time"
+)
+
+// Lock times below this are block heights, and lock times at or above it are unix timestamps (like in Bitcoin).
+const LockTimeThreshold int64 = 500000000
+
+// How far ahead of our clock a block's timestamp can be. Time locks are checked against block timestamps,
+// so without this a miner could unlock transactions early by stamping their block with a time in the future.
+const MaxFutureBlockTime = 2 * time.Hour
+
+// How far past our chain's height (in blocks) or our clock a transaction's lock can end for us to accept it into our MemPool.
+// Locked transactions wait in the MemPool until they unlock, so without these they could be kept forever.
+const (
+	MaxLockHeightAhead = 1000
+	MaxLockTimeAhead   = 7 * 24 * time.Hour
+)
+
+// The height of the first block whose timestamp is checked (see hasValidTimestamp). Our chain was mined before timestamps were checked,
+// so the blocks before it are exempt (and the chain stays valid).
+var timestampRulesHeight = 20000
+
+// How many of the blocks before a block its timestamp has to be at least the median of (like in Bitcoin).
+const medianTimeSpan = 11
+
+// Gets the median timestamp of the (up to) medianTimeSpan blocks before the block at an index in a chain.
+func medianTimePast(chain []Block, index int) int64 {
+	start := index - medianTimeSpan
+	if start < 0 {
+		start = 0
+	}
+
+	timestamps := make([]int64, 0, index-start)
+	for _, block := range chain[start:index] {
+		timestamps = append(timestamps, block.Timestamp)
+	}
+
+	sort.Slice(timestamps, func(i, j int) bool { return timestamps[i] < timestamps[j] })
+
+	return timestamps[len(timestamps)/2]
+}
+
+// Checks that the timestamp of the block at an index in a chain is at least the median of the blocks before it,
+// and not more than MaxFutureBlockTime ahead of now. Blocks before timestampRulesHeight always pass.
+func hasValidTimestamp(chain []Block, index int, now time.Time) bool {
+	if index < timestampRulesHeight {
+		return true
+	}
+
+	timestamp := chain[index].Timestamp
+
+	return timestamp >= medianTimePast(chain, index) && timestamp <= now.Add(MaxFutureBlockTime).Unix()
+}
+
+// Checks whether a transaction can be put in a block at a height (its index in the chain) with a timestamp.
+// Transactions without a LockTime always can, and locked transactions can once the chain reaches their height or time.
+// Transactions with a negative LockTime never can.
+func (t Transaction) IsFinal(height int, timestamp int64) bool {
+	switch {
+	case t.LockTime == 0:
+		return true
+	case t.LockTime < 0:
+		return false
+	case t.LockTime < LockTimeThreshold:
+		return int64(height) >= t.LockTime
+	default:
+		return timestamp >= t.LockTime
+	}
+}
+
+// Checks whether a transaction would unlock soon enough (see MaxLockHeightAhead and MaxLockTimeAhead) to wait in the MemPool
+// of a node whose chain is a certain height (its length). Transactions with a negative LockTime never unlock, so they never would.
+func (t Transaction) unlocksWithinHorizon(height int, now time.Time) bool {
+	switch {
+	case t.LockTime == 0:
+		return true
+	case t.LockTime < 0:
+		return false
+	case t.LockTime < LockTimeThreshold:
+		return t.LockTime <= int64(height)+MaxLockHeightAhead
+	default:
+		return t.LockTime <= now.Add(MaxLockTimeAhead).Unix()
+	}
+}
+
+// Gets when a transaction (in a MemPool) could first be put in a block on a chain: when it was made, or when its lock expired if that was later.
+// Transactions locked until a height the chain hasn't reached yet can't be put in a block yet, so this returns false for them.
+func (t Transaction) unlockTime(chain []Block) (int64, bool) {
+	switch {
+	case t.LockTime <= 0:
+		// Transactions with a negative LockTime never unlock, so they go stale like any other invalid transaction
+		return t.Timestamp, true
+	case t.LockTime < LockTimeThreshold:
+		if int64(len(chain)) <= t.LockTime {
+			return 0, false
+		}
+
+		return maxInt64(t.Timestamp, chain[t.LockTime].Timestamp), true
+	default:
+		return maxInt64(t.Timestamp, t.LockTime), true
+	}
+}
+
+func maxInt64(a int64, b int64) int64 {
+	if a > b {
+		return a
+	}
+
+	return b
+}
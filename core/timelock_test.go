@@ -0,0 +1,187 @@
+package core
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+// Transactions from testGenesisBlock's key that are locked until height 2, and until a time.
+var heightLockedTransaction = Transaction{Sender: testGenesisBlock.Transactions[0].Recipient, Recipient: harnessRecipient, Amount: 50, Timestamp: 1586200890, Signature: "signature5", LockTime: 2}
+var timeLockedTransaction = Transaction{Sender: testGenesisBlock.Transactions[0].Recipient, Recipient: harnessRecipient, Amount: 60, Timestamp: 1586200890, Signature: "signature6", LockTime: 1586201000}
+
+// Pre-mined blocks with the locked transactions, at heights and times before and after their locks.
+var heightLockedBlock1 = Block{BlockHeader: BlockHeader{Timestamp: 1586200900, Transactions: []Transaction{{Sender: "0", Recipient: "miner1", Amount: 1000, Timestamp: 1586200900}, heightLockedTransaction}, PreviousHash: testGenesisBlock.hash()}, Proof: Proof{Nonce: 227900, DifficultyThreshold: 5}}
+var heightLockedBlock2 = Block{BlockHeader: BlockHeader{Timestamp: 1586200900, Transactions: []Transaction{{Sender: "0", Recipient: "miner1", Amount: 1000, Timestamp: 1586200900}, heightLockedTransaction}, PreviousHash: harnessBlock1.hash()}, Proof: Proof{Nonce: 329387, DifficultyThreshold: 5}}
+var timeLockedBlockEarly = Block{BlockHeader: BlockHeader{Timestamp: 1586200900, Transactions: []Transaction{{Sender: "0", Recipient: "miner1", Amount: 1000, Timestamp: 1586200900}, timeLockedTransaction}, PreviousHash: testGenesisBlock.hash()}, Proof: Proof{Nonce: 782012, DifficultyThreshold: 5}}
+var timeLockedBlockFuture = Block{BlockHeader: BlockHeader{Timestamp: 4102444800, Transactions: []Transaction{{Sender: "0", Recipient: "miner1", Amount: 1000, Timestamp: 4102444800}, timeLockedTransaction}, PreviousHash: testGenesisBlock.hash()}, Proof: Proof{Nonce: 567593, DifficultyThreshold: 5}}
+var timeLockedBlockLate = Block{BlockHeader: BlockHeader{Timestamp: 1586201000, Transactions: []Transaction{{Sender: "0", Recipient: "miner1", Amount: 1000, Timestamp: 1586201000}, timeLockedTransaction}, PreviousHash: testGenesisBlock.hash()}, Proof: Proof{Nonce: 1027280, DifficultyThreshold: 5}}
+
+func TestTransaction_IsFinal(t *testing.T) {
+	assert.True(t, Transaction{}.IsFinal(0, 0))
+
+	// Height locks
+	assert.False(t, heightLockedTransaction.IsFinal(1, 1586201000))
+	assert.True(t, heightLockedTransaction.IsFinal(2, 0))
+	assert.True(t, heightLockedTransaction.IsFinal(3, 0))
+
+	// Time locks
+	assert.False(t, timeLockedTransaction.IsFinal(1000, 1586200999))
+	assert.True(t, timeLockedTransaction.IsFinal(0, 1586201000))
+
+	// Negative lock times are never valid
+	assert.False(t, Transaction{LockTime: -1}.IsFinal(1000, 1586201000))
+}
+
+func TestTransaction_LockIsSigned(t *testing.T) {
+	assert.Equal(t, TransactionRepresentation(Transaction{Sender: "a", Recipient: "b", Amount: 1, Timestamp: 2}), "a -1-> b (2)")
+	assert.Equal(t, TransactionRepresentation(Transaction{Sender: "a", Recipient: "b", Amount: 1, Timestamp: 2, LockTime: 3}), "a -1-> b (2) [LOCKED UNTIL 3]")
+
+	// The lock changes the transaction's hash
+	unlocked := heightLockedTransaction
+	unlocked.LockTime = 0
+	assert.NotEqual(t, unlocked.hash(), heightLockedTransaction.hash())
+}
+
+func TestValidateBlock_LockTime(t *testing.T) {
+	fakeValidationServer := newFakeValidationServer(true)
+	defer fakeValidationServer.Close()
+
+	validate := func(blocks ...Block) bool {
+		valid, _ := ValidateChain(append([]Block{testGenesisBlock}, blocks...), fakeValidationServer.URL)
+		return valid
+	}
+
+	// Locked until height 2
+	assert.False(t, validate(heightLockedBlock1))
+	assert.True(t, validate(harnessBlock1, heightLockedBlock2))
+
+	// Locked until a time
+	assert.False(t, validate(timeLockedBlockEarly))
+	assert.True(t, validate(timeLockedBlockLate))
+
+	// A block can't unlock a transaction early by claiming to be from the future
+	assert.False(t, validate(timeLockedBlockFuture))
+	assert.True(t, hasValidTimestamp([]Block{testGenesisBlock, timeLockedBlockFuture}, 1, time.Unix(timeLockedBlockFuture.Timestamp, 0)))
+}
+
+func TestHasValidTimestamp_ActivationHeight(t *testing.T) {
+	defer func(height int) { timestampRulesHeight = height }(timestampRulesHeight)
+	timestampRulesHeight = 2
+
+	chain := []Block{testGenesisBlock, timeLockedBlockFuture, timeLockedBlockFuture}
+	now := time.Unix(testGenesisBlock.Timestamp, 0)
+
+	// Blocks from before the rule existed are exempt
+	assert.True(t, hasValidTimestamp(chain, 1, now))
+	assert.False(t, hasValidTimestamp(chain, 2, now))
+}
+
+func TestHasValidTimestamp(t *testing.T) {
+	chain := make([]Block, 0)
+	for _, timestamp := range []int64{100, 300, 200, 400, 500} {
+		chain = append(chain, Block{BlockHeader: BlockHeader{Timestamp: timestamp}})
+	}
+
+	assert.Equal(t, int64(100), medianTimePast(chain, 1))
+	assert.Equal(t, int64(300), medianTimePast(chain, 2))
+	assert.Equal(t, int64(200), medianTimePast(chain, 3))
+	assert.Equal(t, int64(300), medianTimePast(chain, 5))
+
+	// Only the last 11 blocks count
+	for i := 0; i < medianTimeSpan; i++ {
+		chain = append(chain, Block{BlockHeader: BlockHeader{Timestamp: int64(1000 + i)}})
+	}
+	assert.Equal(t, int64(1005), medianTimePast(chain, len(chain)))
+
+	now := time.Unix(2000, 0)
+	next := func(timestamp int64) []Block {
+		return append(append([]Block{}, chain...), Block{BlockHeader: BlockHeader{Timestamp: timestamp}})
+	}
+
+	// Blocks can be a little before the last block, but not before the median
+	assert.True(t, hasValidTimestamp(next(1005), len(chain), now))
+	assert.False(t, hasValidTimestamp(next(1004), len(chain), now))
+
+	// Or too far in the future
+	assert.True(t, hasValidTimestamp(next(now.Add(MaxFutureBlockTime).Unix()), len(chain), now))
+	assert.False(t, hasValidTimestamp(next(now.Add(MaxFutureBlockTime).Unix()+1), len(chain), now))
+}
+
+func TestNewBlockTemplate_SkipsLockedTransactions(t *testing.T) {
+	fakeValidationServer := newFakeValidationServer(true)
+	defer fakeValidationServer.Close()
+
+	node := newTestMinerNode(fakeValidationServer.URL)
+
+	futureLocked := Transaction{Sender: testGenesisBlock.Transactions[0].Recipient, Recipient: harnessRecipient, Amount: 70, Timestamp: time.Now().Unix(), Signature: "signature7", LockTime: time.Now().Add(time.Hour).Unix()}
+
+	assert.True(t, node.AddTransactionToMemPool(heightLockedTransaction))
+	assert.True(t, node.AddTransactionToMemPool(futureLocked))
+
+	// Nothing can be mined yet
+	assert.Nil(t, node.NewBlockTemplate())
+
+	// Once the chain reaches height 2, the height locked transaction can be mined (but the time locked one still can't)
+	assert.True(t, node.AddMinedBlockToChain(harnessBlock1))
+
+	template := node.NewBlockTemplate()
+	assert.NotNil(t, template)
+	assert.Equal(t, []Transaction{heightLockedTransaction}, template.Transactions[1:])
+
+	// Both stay in the MemPool
+	assert.Len(t, node.MemPool, 2)
+}
+
+func TestLocalNode_RemoveStaleTransactions_LockTime(t *testing.T) {
+	node := newTestMinerNode(validationServer)
+
+	old := time.Now().Add(-25 * time.Hour).Unix()
+
+	// Locked until a height we haven't reached
+	lockedByHeight := Transaction{Sender: "a", Recipient: "b", Amount: 1, Timestamp: old, Signature: "lockedByHeight", LockTime: 5}
+	// Locked until an hour from now
+	lockedByTime := Transaction{Sender: "a", Recipient: "b", Amount: 1, Timestamp: old, Signature: "lockedByTime", LockTime: time.Now().Add(time.Hour).Unix()}
+	// Unlocked an hour ago
+	recentlyUnlocked := Transaction{Sender: "a", Recipient: "b", Amount: 1, Timestamp: old, Signature: "recentlyUnlocked", LockTime: time.Now().Add(-time.Hour).Unix()}
+	// Unlocked long ago
+	stale := Transaction{Sender: "a", Recipient: "b", Amount: 1, Timestamp: old, Signature: "stale", LockTime: old}
+
+	// Never unlocks
+	negative := Transaction{Sender: "a", Recipient: "b", Amount: 1, Timestamp: old, Signature: "negative", LockTime: -1}
+
+	node.MemPool = []Transaction{lockedByHeight, lockedByTime, recentlyUnlocked, stale, negative}
+
+	node.RemoveStaleTransactions(DefaultMemPoolExpiry)
+	assert.Equal(t, []Transaction{lockedByHeight, lockedByTime, recentlyUnlocked}, node.MemPool)
+
+	// Height locks count from the block that unlocked them
+	node.Chain = []Block{testGenesisBlock, harnessBlock1, harnessBlock2}
+	lockedByHeight.LockTime = 1
+	node.MemPool = []Transaction{lockedByHeight}
+
+	node.RemoveStaleTransactions(DefaultMemPoolExpiry)
+	assert.Empty(t, node.MemPool)
+}
+
+func TestLocalNode_AddTransactionToMemPool_LockHorizon(t *testing.T) {
+	fakeValidationServer := newFakeValidationServer(true)
+	defer fakeValidationServer.Close()
+
+	node := newTestMinerNode(fakeValidationServer.URL)
+
+	locked := func(signature string, lockTime int64) Transaction {
+		return Transaction{Sender: testGenesisBlock.Transactions[0].Recipient, Recipient: harnessRecipient, Amount: 1, Timestamp: time.Now().Unix(), Signature: signature, LockTime: lockTime}
+	}
+
+	// Locks that end within the horizon wait in the MemPool
+	assert.NoError(t, node.addTransactionToMemPool(locked("height", int64(len(node.Chain))+MaxLockHeightAhead), false))
+	assert.NoError(t, node.addTransactionToMemPool(locked("time", time.Now().Add(MaxLockTimeAhead-time.Hour).Unix()), false))
+
+	// Locks that end after it (or never) are rejected
+	assert.Equal(t, errLockTooLong, node.addTransactionToMemPool(locked("farHeight", int64(len(node.Chain))+MaxLockHeightAhead+1), false))
+	assert.Equal(t, errLockTooLong, node.addTransactionToMemPool(locked("farTime", time.Now().Add(MaxLockTimeAhead+time.Hour).Unix()), false))
+	assert.Equal(t, errLockTooLong, node.addTransactionToMemPool(locked("negative", -1), false))
+
+	assert.Len(t, node.Snapshot().MemPool, 2)
+}
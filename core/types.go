@@ -3,11 +3,31 @@ package core
 import (
 	"github.com/perlin-network/noise"
 	"github.com/perlin-network/noise/kademlia"
+	"sync"
+	"time"
 )
 
 // The reward given to miners for mining a block
 var coinbaseReward uint64 = 1000
 
+// How many blocks must be added on top of a block before its coinbase reward can be spent
+// (so a reward can't be spent before we are sure Consensus won't replace the block it was mined in)
+var coinbaseMaturity = 100
+
+// The height of the first block whose coinbase reward has to mature. Our chain was mined before rewards had to mature,
+// so the rewards of the blocks before it were spendable straight away (and the chain stays valid).
+var coinbaseMaturityHeight = 20000
+
+// The height of the first block whose coinbase reward has to go to a valid recipient (see IsValidRecipient). Our chain was mined before
+// that was checked, so the blocks before it are exempt (and the chain stays valid).
+var coinbaseRecipientHeight = 20000
+
+// The most transactions our MemPool holds. New transactions are rejected while it is full (so peers can't make it grow forever).
+const MaxMemPoolSize = 50000
+
+// How long we wait for peers to send us their chains if LocalNode.ConsensusTimeout is not set
+const DefaultConsensusTimeout = 10 * time.Second
+
 // The first block in our Blockchain
 var GenesisBlock = Block{BlockHeader: BlockHeader{Timestamp: 1585852979, Transactions: []Transaction{Transaction{Sender: "0", Recipient: "04500bdac952ec32d5031d6f540e2be9d4ff0d0add0b380b56f452ce5d86e713b78ff4d04a6d4bec5b61759b1d0b588a5ea7b720fb4e245036bfcd00d792fd0094", Amount: 100000000000000, Timestamp: 1585852961, Signature: ""}}, PreviousHash: ""}, Proof: Proof{Nonce: 0, DifficultyThreshold: 0}}
 
@@ -15,25 +35,59 @@ var GenesisBlock = Block{BlockHeader: BlockHeader{Timestamp: 1585852979, Transac
 var testGenesisBlock = Block{BlockHeader: BlockHeader{Timestamp: 1585852979, Transactions: []Transaction{Transaction{Sender: "0", Recipient: "0458adabe2c014de6c3fd2f2c865c2ca7fe823a4131a4d22f98dcc77f1bffc8aeacf8a0b7949321c33214e9c1b2201063404a321110be8223ad1685ee32c9c02d0", Amount: 100000000000000, Timestamp: 1585852961, Signature: ""}}, PreviousHash: ""}, Proof: Proof{Nonce: 0, DifficultyThreshold: 0}}
 
 // The amount of unspent coin each user has associated with their public key
-type UTXO map[string]uint64
+type UTXO map[string]Funds
+
+// The coins an account has
+type Funds struct {
+	Spendable uint64            // The coins the account can spend
+	Immature  []ImmatureCoins   `json:",omitempty"` // Coinbase rewards the account can't spend yet (in the order they mature)
+	Outputs   map[string]uint64 `json:",omitempty"` // The unspent outputs paid to the account (by their ID, TRANSACTION_HASH:INDEX), which only output-based transactions can spend
+}
+
+// A coinbase reward that can't be spent until the chain reaches a height
+type ImmatureCoins struct {
+	Amount    uint64
+	MaturesAt int // The index of the first block that can spend the coins
+}
 
 // A Blockchain is a struct that stores a Chain of Blocks, as well as MemPool and manages its own UTXO map.
-// It also stores a ValidationServerURL and an Operator Public key which is used to identify that node when mining
+// It also stores a ValidationServerURL and an Operator Public key which is used to identify that node when mining.
+// While the node is running, its Chain, MemPool and UTXO must be read through Snapshot.
 type LocalNode struct {
 	Chain   []Block       // The actual chain of transactions that makes up this "Blockchain"
 	MemPool []Transaction // The waiting room of transactions that are yet to be incorporated in a block. These get cleared out every 24 hours.
 	UTXO    UTXO          // The amount of unspent transactions each user has associated with their public key
+	state   sync.RWMutex  // Held while Chain, MemPool or UTXO are read or replaced (as the P2P handlers, the Miner and the API all use them)
+
+	minted    uint64 // The coins our Chain has minted (see mintedCoins), kept so each new block only adds its own reward. Guarded by state.
+	mintedTip string // The hash of the block minted was counted up to (it is recounted if our Chain was set without it)
 
 	ValidationServerURL string // A link to a server that can be used to validate signatures
 	OperatorPublicKey   string // A public key that is used to identify the node when mining (so this node can receive mining rewards
 
-	IsMining bool // Stores whether the node is mining or not. If the node is mining and this bool is set to false, the node will terminate its mining process.
+	mining int32 // 1 while MineBlock is mining (see IsMining). Setting it to 0 terminates the mining process. Only accessed atomically.
 
 	node             *noise.Node        // This node's P2P representation
 	kademliaProtocol *kademlia.Protocol // Stores this block's peers
+	inventory        *knownInventory    // Stores which peers know about which blocks and transactions
+	orphans          *orphanPool        // Stores blocks from peers that arrived before their parents
+	peers            *peerBook          // Stores the peers we have completed a handshake with
+	NetworkMagic     uint32             // Identifies which network this node is on (defaults to MainNetworkMagic)
+
+	lifecycle         lifecycle  // Stores whether this node is running (see Start and Stop)
+	events            *eventFeed // Tells services like the Miner when our MemPool or chain changes
+	ListenAddress     string     // The host:port we listen for peers on (defaults to all interfaces on PortP2P). Use port 0 for a random free port.
+	AdvertisedAddress string     // The host:port peers should reach us on, if it is different to ListenAddress (like behind NAT or in a container)
 
-	incomingChains            chan []Block // Stores incoming chains for our consensus algorithm
-	MinimumChainsForConsensus int          // How many chains we need before we run consensus
+	incomingChains            chan peerChain // Stores incoming chains (and who sent them) for our consensus algorithm
+	isGettingConsensus        int32          // Set to 1 (atomically) while we are waiting on chains for consensus, so only one round runs at a time
+	MinimumChainsForConsensus int            // How many chains we need before we run consensus
+	ConsensusTimeout          time.Duration  // How long we wait for chains before running consensus on the ones we got (defaults to DefaultConsensusTimeout)
+
+	bans         *banList      // Stores how much each peer has misbehaved and which peers are banned
+	BanThreshold int           // How much misbehaviour a peer can get away with before being banned (defaults to DefaultBanThreshold)
+	BanDuration  time.Duration // How long misbehaving peers are banned for (defaults to DefaultBanDuration)
+	BanListPath  string        // A file where banned peers are saved so they stay banned between restarts (bans aren't saved if this is empty)
 }
 
 // A Block is a block header with a proof that when put into the format {Proof}-{BlockHeader}, can be hashed into a hex string with x leading 0s.
@@ -42,6 +96,12 @@ type Block struct {
 	Proof Proof // The nonce and difficulty threshold that validates this block
 }
 
+// A BlockTemplate is everything needed to mine a block: its header and the difficulty threshold its proof needs to meet.
+type BlockTemplate struct {
+	BlockHeader
+	DifficultyThreshold int64 // The number of leading 0s required in the hash
+}
+
 // The nonce and difficulty threshold achieved by the nonce and BlockHeader to generate proof of work.
 type Proof struct {
 	Nonce               int64 // The random factor that changes the hash
@@ -62,4 +122,11 @@ type Transaction struct {
 	Amount    uint64 // The amount of coin transferred
 	Timestamp int64  // The time at which this transaction was made. This value does not need to be accurate, it is only for the purpose of ordering transactions in a BlockHeader.
 	Signature string // A hex string that is an ECDSA signed representation of this transaction ({SENDER} -{AMOUNT}-> {RECIPIENT} ({TIMESTAMP}))
+
+	Multisig   MultisigAccount `json:",omitempty"` // The account a multisig Sender is made of (empty unless Sender is a multisig address)
+	Signatures []string        `json:",omitempty"` // The signatures of a multisig Sender's keys, in the same order as its keys ("" for keys that didn't sign)
+	LockTime   int64           `json:",omitempty"` // The block height (below LockTimeThreshold) or unix time (at or above it) before which the transaction can't be put in a block (0 if it isn't locked)
+	Inputs     []Input         `json:",omitempty"` // The unspent outputs an output-based transaction spends (they must be the Sender's)
+	Outputs    []Output        `json:",omitempty"` // The coins an output-based transaction pays (empty unless the transaction is output-based)
+	Payments   []Payment       `json:",omitempty"` // The payments a batch transaction makes (empty unless the transaction is a batch, which has Amount set to their total)
 }
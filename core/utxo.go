@@ -0,0 +1,180 @@
+package core
+
+// Gets how many coins an account (a public key or an address) can spend.
+// A public key can spend the coins sent to its address as well as the coins sent to the public key itself (like before there were addresses).
+// Merging the two entries here is the whole migration to addresses: the UTXO is rebuilt from the chain whenever it is loaded, so the
+// entries under public keys are never rewritten, and debit spends them first so they empty out over time.
+// Coinbase rewards that haven't matured yet aren't included (see ImmatureBalance).
+func (u UTXO) Balance(account string) uint64 {
+	key := accountKey(account)
+	balance := u[key].Spendable
+
+	if address := accountAddress(account); address != key {
+		balance += u[address].Spendable
+	}
+
+	return balance
+}
+
+// Gets how many coins an account (a public key or an address) has from coinbase rewards that it can't spend yet.
+func (u UTXO) ImmatureBalance(account string) uint64 {
+	key := accountKey(account)
+	balance := u[key].immature()
+
+	if address := accountAddress(account); address != key {
+		balance += u[address].immature()
+	}
+
+	return balance
+}
+
+// Gives coins to a recipient (under the address or canonical public key they were sent to).
+// It returns false (without giving them anything) if their coins would be too many for a uint64.
+func (u UTXO) credit(recipient string, amount uint64) bool {
+	key := accountKey(recipient)
+
+	funds := u[key]
+
+	spendable, ok := addAmounts(funds.Spendable, amount)
+	if !ok {
+		return false
+	}
+
+	funds.Spendable = spendable
+	u[key] = funds
+
+	return true
+}
+
+// Gives a coinbase reward from the block at an index to a miner. It can't be spent until it matures coinbaseMaturity blocks later,
+// unless the block is before coinbaseMaturityHeight. It returns false (without giving them anything) if their coins would be too many for a uint64.
+func (u UTXO) creditCoinbase(recipient string, amount uint64, blockIndex int) bool {
+	if blockIndex < coinbaseMaturityHeight {
+		return u.credit(recipient, amount)
+	}
+
+	key := accountKey(recipient)
+
+	funds := u[key]
+	funds.Immature = append(funds.Immature, ImmatureCoins{Amount: amount, MaturesAt: blockIndex + coinbaseMaturity})
+	u[key] = funds
+
+	return true
+}
+
+// Takes coins from a sender. Coins sent to their public key are spent before coins sent to their address,
+// so the entries from before there were addresses empty out over time.
+// It returns false (without taking anything) if the sender's Balance doesn't cover amount.
+func (u UTXO) debit(sender string, amount uint64) bool {
+	if u.Balance(sender) < amount {
+		return false
+	}
+
+	key := accountKey(sender)
+
+	fromPublicKey := amount
+	if u[key].Spendable < fromPublicKey {
+		fromPublicKey = u[key].Spendable
+	}
+
+	if fromPublicKey > 0 {
+		funds := u[key]
+		funds.Spendable -= fromPublicKey
+		u[key] = funds
+	}
+
+	if fromAddress := amount - fromPublicKey; fromAddress > 0 {
+		address := accountAddress(sender)
+
+		funds := u[address]
+		funds.Spendable -= fromAddress
+		u[address] = funds
+	}
+
+	return true
+}
+
+// Applies a (valid) transaction: the Amount is taken from its Sender and given to its Recipient,
+// or for output-based transactions, its inputs are spent and its outputs paid (see applyOutputs),
+// or for batch transactions, every payment is made (see applyBatch).
+// It returns false if it can't be applied (like when a balance would overflow). The UTXO may have been partly changed then, so it has to be thrown away.
+func (u UTXO) applyTransaction(transaction Transaction) bool {
+	if transaction.isOutputBased() {
+		return u.applyOutputs(transaction)
+	}
+
+	if transaction.isBatch() {
+		return u.applyBatch(transaction)
+	}
+
+	return u.debit(transaction.Sender, transaction.Amount) && u.credit(transaction.Recipient, transaction.Amount)
+}
+
+// Makes the coinbase rewards that mature by the block at an index in a chain spendable (before that block's transactions are applied).
+// A reward matures coinbaseMaturity blocks after the block that paid it, so the chain is the index of pending maturities:
+// only the account paid by the block coinbaseMaturity blocks back has coins to mature, and no other account is looked at.
+// It returns false if the account's spendable coins would overflow. The UTXO may have been partly changed then, so it has to be thrown away.
+func (u UTXO) mature(blockIndex int, chain []Block) bool {
+	paidIn := blockIndex - coinbaseMaturity
+	if paidIn < 0 || paidIn >= len(chain) || len(chain[paidIn].Transactions) == 0 {
+		return true
+	}
+
+	account := accountKey(chain[paidIn].Transactions[0].Recipient)
+
+	funds, ok := u[account]
+	if !ok || len(funds.Immature) == 0 || funds.Immature[0].MaturesAt > blockIndex {
+		return true
+	}
+
+	// Build a new slice, so copies of this UTXO don't change
+	var immature []ImmatureCoins
+	for _, coins := range funds.Immature {
+		if coins.MaturesAt <= blockIndex {
+			if funds.Spendable, ok = addAmounts(funds.Spendable, coins.Amount); !ok {
+				return false
+			}
+		} else {
+			immature = append(immature, coins)
+		}
+	}
+
+	funds.Immature = immature
+	u[account] = funds
+
+	return true
+}
+
+// Makes a copy of the UTXO that can be changed without changing the original.
+func (u UTXO) copy() UTXO {
+	copied := make(UTXO, len(u))
+
+	for account, funds := range u {
+		if funds.Immature != nil {
+			funds.Immature = append([]ImmatureCoins(nil), funds.Immature...)
+		}
+
+		if funds.Outputs != nil {
+			outputs := make(map[string]uint64, len(funds.Outputs))
+			for id, amount := range funds.Outputs {
+				outputs[id] = amount
+			}
+
+			funds.Outputs = outputs
+		}
+
+		copied[account] = funds
+	}
+
+	return copied
+}
+
+// Gets the total of the coinbase rewards that haven't matured.
+func (f Funds) immature() uint64 {
+	var total uint64
+	for _, coins := range f.Immature {
+		total += coins.Amount
+	}
+
+	return total
+}
@@ -0,0 +1,183 @@
+package core
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestUTXO_Balance(t *testing.T) {
+	publicKey := testGenesisBlock.Transactions[0].Recipient
+	utxo := UTXO{publicKey: {Spendable: 10}, testGenesisAddress: {Spendable: 5}, "miner": {Spendable: 1000}}
+
+	// A public key has the coins sent to it and its address
+	assert.Equal(t, uint64(15), utxo.Balance(publicKey))
+	assert.Equal(t, uint64(5), utxo.Balance(testGenesisAddress))
+	assert.Equal(t, uint64(1000), utxo.Balance("miner"))
+	assert.Equal(t, uint64(0), utxo.Balance(harnessRecipient))
+}
+
+func TestUTXO_CreditAndDebit(t *testing.T) {
+	publicKey := testGenesisBlock.Transactions[0].Recipient
+	utxo := UTXO{publicKey: {Spendable: 10}, testGenesisAddress: {Spendable: 5}}
+
+	// Coins sent to the public key are spent first
+	utxo.debit(publicKey, 7)
+	assert.Equal(t, UTXO{publicKey: {Spendable: 3}, testGenesisAddress: {Spendable: 5}}, utxo)
+
+	utxo.debit(publicKey, 6)
+	assert.Equal(t, UTXO{publicKey: {Spendable: 0}, testGenesisAddress: {Spendable: 2}}, utxo)
+
+	utxo.credit(testGenesisAddress, 8)
+	utxo.credit(harnessRecipient, 1)
+	assert.Equal(t, UTXO{publicKey: {Spendable: 0}, testGenesisAddress: {Spendable: 10}, harnessRecipient: {Spendable: 1}}, utxo)
+
+	// Spending only from the address doesn't add an entry for the public key
+	utxo = UTXO{testGenesisAddress: {Spendable: 5}}
+	utxo.debit(publicKey, 5)
+	assert.Equal(t, UTXO{testGenesisAddress: {Spendable: 0}}, utxo)
+}
+
+func TestUTXO_CompressedKeys(t *testing.T) {
+	publicKey := testGenesisBlock.Transactions[0].Recipient
+	utxo := UTXO{publicKey: {Spendable: 10}}
+
+	// Both forms of a key are one account, kept under the uncompressed form
+	assert.Equal(t, uint64(10), utxo.Balance(testGenesisCompressedKey))
+
+	utxo.credit(testGenesisCompressedKey, 5)
+	assert.Equal(t, UTXO{publicKey: {Spendable: 15}}, utxo)
+
+	utxo.debit(testGenesisCompressedKey, 15)
+	assert.Equal(t, UTXO{publicKey: {Spendable: 0}}, utxo)
+}
+
+// coinbaseBlock makes a block that only pays a coinbase reward (only its coinbase transaction is used to mature rewards).
+func coinbaseBlock(recipient string, amount uint64) Block {
+	return Block{BlockHeader: BlockHeader{Transactions: []Transaction{{Sender: "0", Recipient: recipient, Amount: amount}}}}
+}
+
+func TestUTXO_Maturity(t *testing.T) {
+	publicKey := testGenesisBlock.Transactions[0].Recipient
+	utxo := UTXO{publicKey: {Spendable: 10}}
+
+	// Rewards from the blocks at index 1 and 2 (under both forms of the key and its address)
+	chain := []Block{testGenesisBlock, coinbaseBlock(testGenesisCompressedKey, 1000), coinbaseBlock(testGenesisAddress, 500)}
+	utxo.creditCoinbase(testGenesisCompressedKey, 1000, 1)
+	utxo.creditCoinbase(testGenesisAddress, 500, 2)
+
+	assert.Equal(t, uint64(10), utxo.Balance(publicKey))
+	assert.Equal(t, uint64(1500), utxo.ImmatureBalance(publicKey))
+	assert.Equal(t, uint64(500), utxo.ImmatureBalance(testGenesisAddress))
+	assert.Equal(t, []ImmatureCoins{{Amount: 1000, MaturesAt: 1 + coinbaseMaturity}}, utxo[publicKey].Immature)
+
+	copied := utxo.copy()
+
+	// Nothing matures early
+	utxo.mature(coinbaseMaturity, chain)
+	assert.Equal(t, uint64(10), utxo.Balance(publicKey))
+
+	utxo.mature(1+coinbaseMaturity, chain)
+	assert.Equal(t, uint64(1010), utxo.Balance(publicKey))
+	assert.Equal(t, uint64(500), utxo.ImmatureBalance(publicKey))
+	assert.Nil(t, utxo[publicKey].Immature)
+
+	utxo.mature(2+coinbaseMaturity, chain)
+	assert.Equal(t, uint64(1510), utxo.Balance(publicKey))
+	assert.Equal(t, uint64(0), utxo.ImmatureBalance(publicKey))
+
+	// Copies don't change with the original
+	assert.Equal(t, uint64(10), copied.Balance(publicKey))
+	assert.Equal(t, uint64(1500), copied.ImmatureBalance(publicKey))
+
+	// Only the account paid by the block the rewards mature from is looked at
+	utxo = UTXO{harnessRecipient: {Immature: []ImmatureCoins{{Amount: 1000, MaturesAt: 1 + coinbaseMaturity}}}}
+	utxo.mature(1+coinbaseMaturity, chain)
+	assert.Equal(t, uint64(1000), utxo.ImmatureBalance(harnessRecipient))
+
+	chain[1] = coinbaseBlock(harnessRecipient, 1000)
+	utxo.mature(1+coinbaseMaturity, chain)
+	assert.Equal(t, uint64(1000), utxo.Balance(harnessRecipient))
+	assert.Equal(t, uint64(0), utxo.ImmatureBalance(harnessRecipient))
+}
+
+// Blocks where a coinbase reward is paid to harnessRecipient, and then spent in the next block.
+var maturityBlock1 = Block{BlockHeader: BlockHeader{Timestamp: 1586201100, Transactions: []Transaction{{Sender: "0", Recipient: harnessRecipient, Amount: 1000, Timestamp: 1586201100}, {Sender: testGenesisBlock.Transactions[0].Recipient, Recipient: harnessRecipient, Amount: 10, Timestamp: 1586201090, Signature: "signature8"}}, PreviousHash: testGenesisBlock.hash()}, Proof: Proof{Nonce: 2199077, DifficultyThreshold: 5}}
+var maturityBlock2 = Block{BlockHeader: BlockHeader{Timestamp: 1586201200, Transactions: []Transaction{{Sender: "0", Recipient: "miner1", Amount: 1000, Timestamp: 1586201200}, {Sender: harnessRecipient, Recipient: testGenesisBlock.Transactions[0].Recipient, Amount: 1005, Timestamp: 1586201190, Signature: "signature9"}}, PreviousHash: maturityBlock1.hash()}, Proof: Proof{Nonce: 416035, DifficultyThreshold: 5}}
+
+// A block after maturityBlock1 that doesn't spend its reward.
+var maturitySpacerBlock = Block{BlockHeader: BlockHeader{Timestamp: 1586201150, Transactions: []Transaction{{Sender: "0", Recipient: "miner1", Amount: 1000, Timestamp: 1586201150}, {Sender: testGenesisBlock.Transactions[0].Recipient, Recipient: harnessRecipient, Amount: 1, Timestamp: 1586201140, Signature: "signature17"}}, PreviousHash: maturityBlock1.hash()}, Proof: Proof{Nonce: 660717, DifficultyThreshold: 5}}
+
+func TestValidateBlock_CoinbaseMaturity(t *testing.T) {
+	fakeValidationServer := newFakeValidationServer(true)
+	defer fakeValidationServer.Close()
+
+	originalMaturity := coinbaseMaturity
+	defer func() { coinbaseMaturity = originalMaturity }()
+
+	chain := []Block{testGenesisBlock, maturityBlock1, maturityBlock2}
+
+	// The reward from the first block can't be spent in the next one
+	coinbaseMaturity = 2
+	valid, _ := ValidateChain(chain, fakeValidationServer.URL)
+	assert.False(t, valid)
+
+	valid, utxo := ValidateChain(chain[:2], fakeValidationServer.URL)
+	assert.True(t, valid)
+	assert.Equal(t, uint64(10), utxo.Balance(harnessRecipient))
+	assert.Equal(t, uint64(1000), utxo.ImmatureBalance(harnessRecipient))
+
+	// Unless it matures by then
+	coinbaseMaturity = 1
+	valid, utxo = ValidateChain(chain, fakeValidationServer.URL)
+	assert.True(t, valid)
+	assert.Equal(t, uint64(5), utxo.Balance(harnessRecipient))
+	assert.Equal(t, uint64(0), utxo.ImmatureBalance(harnessRecipient))
+	assert.Equal(t, uint64(1000), utxo.ImmatureBalance("miner1"))
+}
+
+func TestValidateBlock_CoinbaseMaturityHeight(t *testing.T) {
+	fakeValidationServer := newFakeValidationServer(true)
+	defer fakeValidationServer.Close()
+
+	defer func(height int) { coinbaseMaturityHeight = height }(coinbaseMaturityHeight)
+
+	// Rewards from blocks before the rule existed can be spent straight away (so chains mined back then stay valid)
+	coinbaseMaturityHeight = 2
+	valid, utxo := ValidateChain([]Block{testGenesisBlock, maturityBlock1, maturityBlock2}, fakeValidationServer.URL)
+	assert.True(t, valid)
+	assert.Equal(t, uint64(5), utxo.Balance(harnessRecipient))
+
+	// But not from the blocks after it
+	assert.Equal(t, uint64(0), utxo.Balance("miner1"))
+	assert.Equal(t, uint64(1000), utxo.ImmatureBalance("miner1"))
+}
+
+func TestNewBlockTemplate_ImmatureCoinbase(t *testing.T) {
+	fakeValidationServer := newFakeValidationServer(true)
+	defer fakeValidationServer.Close()
+
+	originalMaturity := coinbaseMaturity
+	defer func() { coinbaseMaturity = originalMaturity }()
+	coinbaseMaturity = 2
+
+	node := newTestMinerNode(fakeValidationServer.URL)
+	// A reward that matures in the block after next
+	assert.True(t, node.AddMinedBlockToChain(maturityBlock1))
+
+	spend := maturityBlock2.Transactions[1]
+	assert.True(t, node.AddTransactionToMemPool(spend))
+
+	// The reward can't be spent yet
+	assert.Nil(t, node.NewBlockTemplate())
+
+	// Once the next block is the one it matures in, it can be
+	assert.True(t, node.AddMinedBlockToChain(maturitySpacerBlock))
+
+	template := node.NewBlockTemplate()
+	assert.NotNil(t, template)
+	assert.Equal(t, []Transaction{spend}, template.Transactions[1:])
+
+	// The node's own UTXO isn't changed
+	assert.Equal(t, uint64(1000), node.UTXO.ImmatureBalance(harnessRecipient))
+	assert.Equal(t, uint64(11), node.UTXO.Balance(harnessRecipient))
+}
@@ -0,0 +1,431 @@
+package core
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/gob"
+	"encoding/json"
+	"errors"
+	"fmt"
+	log "github.com/sirupsen/logrus"
+)
+
+// The version of our wire format. Bump this whenever the header or the encoding of payloads changes.
+const WireVersion uint8 = 1
+
+// Every wire message starts with these bytes, which lets us tell it apart from the old gob encoded NodeMessages.
+var wireMagic = []byte{0xc0, 0x53, 0x05, 0xe5}
+
+// The size of the header in front of every wire message:
+// magic (4 bytes) | wire version (1 byte) | message type (1 byte) | payload length (4 bytes, big endian)
+const wireHeaderSize = 10
+
+// Whether we still decode the old gob encoded NodeMessages. This lets old nodes keep talking to us while the network migrates
+// to the new wire format. It will be removed once old nodes are gone.
+// While it is set, we also send the old format to peers that haven't shown they understand the new one (see peerBook.needsLegacyEncoding).
+var DecodeLegacyMessages = true
+
+// The type of each wire message. These match the MessageType of the old NodeMessages, so never reorder them.
+const (
+	newBlock             = iota // BlockMessage
+	newTransaction              // TransactionMessage
+	thisIsMyChain               // ChainResponseMessage
+	needChain                   // ChainRequestMessage
+	needMemPool                 // MemPoolRequestMessage
+	thisIsMyMemPool             // MemPoolInventoryMessage
+	needTransactions            // TransactionsRequestMessage
+	theseAreTransactions        // TransactionsMessage
+	newInventory                // InventoryMessage
+	needInventory               // InventoryRequestMessage
+	hello                       // HelloMessage
+)
+
+// A WireMessage is a message that can be sent to peers. Only the message types in this file are WireMessages.
+type WireMessage interface {
+	messageType() int
+}
+
+// A BlockMessage gives a peer a new block.
+type BlockMessage struct {
+	Block Block
+}
+
+// A TransactionMessage gives a peer a new transaction.
+type TransactionMessage struct {
+	Transaction Transaction
+}
+
+// A ChainRequestMessage asks a peer for their chain.
+type ChainRequestMessage struct{}
+
+// A ChainResponseMessage gives a peer our chain (in response to a ChainRequestMessage).
+type ChainResponseMessage struct {
+	Chain []Block
+}
+
+// A MemPoolRequestMessage asks a peer for the IDs of the transactions in their MemPool.
+type MemPoolRequestMessage struct{}
+
+// A MemPoolInventoryMessage gives a peer the IDs of the transactions in our MemPool.
+type MemPoolInventoryMessage struct {
+	TransactionIDs []string
+}
+
+// A TransactionsRequestMessage asks a peer for the transactions in their MemPool with certain IDs.
+type TransactionsRequestMessage struct {
+	TransactionIDs []string
+}
+
+// A TransactionsMessage gives a peer transactions from our MemPool (in response to a TransactionsRequestMessage).
+type TransactionsMessage struct {
+	Transactions []Transaction
+}
+
+// An InventoryMessage announces the blocks and transactions we have to a peer.
+type InventoryMessage struct {
+	Inventory Inventory
+}
+
+// An InventoryRequestMessage asks a peer to send us the blocks and transactions they announced.
+type InventoryRequestMessage struct {
+	Inventory Inventory
+}
+
+// A HelloMessage is the first message we send a peer.
+type HelloMessage struct {
+	Hello Hello
+}
+
+func (BlockMessage) messageType() int               { return newBlock }
+func (TransactionMessage) messageType() int         { return newTransaction }
+func (ChainResponseMessage) messageType() int       { return thisIsMyChain }
+func (ChainRequestMessage) messageType() int        { return needChain }
+func (MemPoolRequestMessage) messageType() int      { return needMemPool }
+func (MemPoolInventoryMessage) messageType() int    { return thisIsMyMemPool }
+func (TransactionsRequestMessage) messageType() int { return needTransactions }
+func (TransactionsMessage) messageType() int        { return theseAreTransactions }
+func (InventoryMessage) messageType() int           { return newInventory }
+func (InventoryRequestMessage) messageType() int    { return needInventory }
+func (HelloMessage) messageType() int               { return hello }
+
+// newWireMessage creates an empty WireMessage of a message type (for decoding into). It returns nil for unknown types.
+func newWireMessage(messageType int) WireMessage {
+	switch messageType {
+	case newBlock:
+		return &BlockMessage{}
+	case newTransaction:
+		return &TransactionMessage{}
+	case thisIsMyChain:
+		return &ChainResponseMessage{}
+	case needChain:
+		return &ChainRequestMessage{}
+	case needMemPool:
+		return &MemPoolRequestMessage{}
+	case thisIsMyMemPool:
+		return &MemPoolInventoryMessage{}
+	case needTransactions:
+		return &TransactionsRequestMessage{}
+	case theseAreTransactions:
+		return &TransactionsMessage{}
+	case newInventory:
+		return &InventoryMessage{}
+	case needInventory:
+		return &InventoryRequestMessage{}
+	case hello:
+		return &HelloMessage{}
+	default:
+		return nil
+	}
+}
+
+// EncodeWireMessage encodes a message into our wire format: a header (see wireHeaderSize) followed by the message as JSON.
+func EncodeWireMessage(message WireMessage) ([]byte, error) {
+	payload, err := json.Marshal(message)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(payload) > MaxMessageSize-wireHeaderSize {
+		return nil, fmt.Errorf("message is %d bytes, which is more than the max of %d bytes", len(payload)+wireHeaderSize, MaxMessageSize)
+	}
+
+	data := make([]byte, wireHeaderSize, wireHeaderSize+len(payload))
+	copy(data, wireMagic)
+	data[4] = WireVersion
+	data[5] = uint8(message.messageType())
+	binary.BigEndian.PutUint32(data[6:wireHeaderSize], uint32(len(payload)))
+
+	return append(data, payload...), nil
+}
+
+// DecodeWireMessage decodes a message sent by a peer (in our wire format, or as an old gob encoded NodeMessage).
+// Peers can send us anything, so this never panics: it returns an error if the message is too big, can't be decoded,
+// is from a newer wire version, or is invalid (like an empty chain).
+func DecodeWireMessage(data []byte) (WireMessage, error) {
+	if len(data) > MaxMessageSize {
+		return nil, fmt.Errorf("message is %d bytes, which is more than the max of %d bytes", len(data), MaxMessageSize)
+	}
+
+	if !bytes.HasPrefix(data, wireMagic) {
+		if !DecodeLegacyMessages {
+			return nil, errors.New("message is not in our wire format")
+		}
+
+		msg, err := unMarshalNodeMessage(data)
+		if err != nil {
+			return nil, err
+		}
+
+		return msg.toWireMessage(), nil
+	}
+
+	if len(data) < wireHeaderSize {
+		return nil, errors.New("message is too short to have a header")
+	}
+
+	if version := data[4]; version > WireVersion {
+		return nil, fmt.Errorf("message is from wire version %d, but we only understand up to version %d", version, WireVersion)
+	}
+
+	payload := data[wireHeaderSize:]
+	if length := binary.BigEndian.Uint32(data[6:wireHeaderSize]); uint64(length) != uint64(len(payload)) {
+		return nil, fmt.Errorf("message header says the payload is %d bytes, but it is %d bytes", length, len(payload))
+	}
+
+	message := newWireMessage(int(data[5]))
+	if message == nil {
+		return nil, fmt.Errorf("unknown message type %d", data[5])
+	}
+
+	// Every field has to be one we know about (so the payload matches its type), and nothing can come after the payload.
+	dec := json.NewDecoder(bytes.NewReader(payload))
+	dec.DisallowUnknownFields()
+
+	if err := dec.Decode(message); err != nil {
+		return nil, err
+	}
+
+	if dec.More() {
+		return nil, errors.New("message has data after its payload")
+	}
+
+	// Turn the pointer we decoded into back into a value, so handlers can switch on the message's type.
+	switch m := message.(type) {
+	case *BlockMessage:
+		return *m, nil
+	case *TransactionMessage:
+		return *m, nil
+	case *ChainResponseMessage:
+		if len(m.Chain) == 0 {
+			return nil, errors.New("chain is empty")
+		}
+		return *m, nil
+	case *ChainRequestMessage:
+		return *m, nil
+	case *MemPoolRequestMessage:
+		return *m, nil
+	case *MemPoolInventoryMessage:
+		return *m, nil
+	case *TransactionsRequestMessage:
+		return *m, nil
+	case *TransactionsMessage:
+		return *m, nil
+	case *InventoryMessage:
+		return *m, nil
+	case *InventoryRequestMessage:
+		return *m, nil
+	case *HelloMessage:
+		return *m, nil
+	}
+
+	return nil, fmt.Errorf("unknown message type %d", data[5])
+}
+
+// wireEnvelope wraps a WireMessage so it can be registered with (and sent by) our noise node.
+type wireEnvelope struct {
+	WireMessage
+	legacy bool // Whether the message was (or is to be) sent as an old gob encoded NodeMessage
+}
+
+// Marshal encodes the wrapped message into our wire format (or as a NodeMessage, if the envelope is legacy).
+func (e wireEnvelope) Marshal() []byte {
+	if e.legacy {
+		msg, ok := toNodeMessage(e.WireMessage)
+		if !ok {
+			// sendMessageToPeer never sends these to old nodes. Peers will just fail to decode it.
+			log.Errorf("Failed to encode a message! [error: old nodes don't understand message type %d]", e.WireMessage.messageType())
+			return nil
+		}
+
+		return msg.Marshal()
+	}
+
+	data, err := EncodeWireMessage(e.WireMessage)
+	if err != nil {
+		// This only happens if we try to send something bigger than MaxMessageSize. Peers will just fail to decode it.
+		log.Errorf("Failed to encode a message! [error: %s]", err)
+	}
+
+	return data
+}
+
+// unMarshalWireEnvelope decodes a message from a peer into a wireEnvelope (it is registered with our noise node).
+func unMarshalWireEnvelope(data []byte) (wireEnvelope, error) {
+	message, err := DecodeWireMessage(data)
+	if err != nil {
+		return wireEnvelope{}, err
+	}
+
+	return wireEnvelope{WireMessage: message, legacy: !bytes.HasPrefix(data, wireMagic)}, nil
+}
+
+// A NodeMessage is the old gob encoded message format. We only use these (see DecodeLegacyMessages) so old nodes
+// can keep talking to us while the network migrates to the new wire format.
+type NodeMessage struct {
+	MessageType int         // Can be: newBlock, newTransaction, thisIsMyChain, needChain, needMemPool, thisIsMyMemPool, needTransactions, theseAreTransactions, newInventory, needInventory, or hello
+	Body        interface{} // The actual payload (it can be many types)
+
+	// Our Hello, sent on a needChain to peers that might be old nodes. Old nodes don't have this field, so gob skips it
+	// (and they just send us their chain), while new nodes treat the message as a HelloMessage.
+	Hello *Hello
+}
+
+func init() {
+	gob.Register([]Block(nil))
+	gob.Register(Block{})
+	gob.Register(Transaction{})
+	gob.Register([]Transaction(nil))
+	gob.Register([]string(nil))
+	gob.Register(Inventory{})
+	gob.Register(Hello{})
+}
+
+// Marshal encodes a NodeMessage with gob (the format old nodes send).
+func (m NodeMessage) Marshal() []byte {
+	var buf bytes.Buffer
+
+	enc := gob.NewEncoder(&buf)
+
+	if err := enc.Encode(m); err != nil {
+		log.Fatal(err)
+	}
+
+	return buf.Bytes()
+}
+
+// unMarshalNodeMessage decodes a NodeMessage sent by a peer. Peers can send us anything, so this never panics or exits:
+// it returns an error if the message is too big, can't be decoded, or has an unknown type or the wrong type of body.
+func unMarshalNodeMessage(input []byte) (msg NodeMessage, err error) {
+	if len(input) > MaxMessageSize {
+		return NodeMessage{}, fmt.Errorf("message is %d bytes, which is more than the max of %d bytes", len(input), MaxMessageSize)
+	}
+
+	// The gob decoder should return errors for malformed input, but a panic here must never take down the node.
+	defer func() {
+		if r := recover(); r != nil {
+			msg, err = NodeMessage{}, fmt.Errorf("decoding message panicked: %v", r)
+		}
+	}()
+
+	buf := bytes.NewBuffer(input)
+	dec := gob.NewDecoder(buf)
+
+	if err := dec.Decode(&msg); err != nil {
+		return NodeMessage{}, err
+	}
+
+	if err := validateNodeMessage(msg); err != nil {
+		return NodeMessage{}, err
+	}
+
+	return msg, nil
+}
+
+// validateNodeMessage checks that a NodeMessage has a known MessageType and the right type of Body for that MessageType.
+func validateNodeMessage(msg NodeMessage) error {
+	var ok bool
+
+	switch msg.MessageType {
+	case newBlock:
+		_, ok = msg.Body.(Block)
+	case newTransaction:
+		_, ok = msg.Body.(Transaction)
+	case thisIsMyChain:
+		var chain []Block
+		if chain, ok = msg.Body.([]Block); ok && len(chain) == 0 {
+			return errors.New("chain is empty")
+		}
+	case needChain, needMemPool:
+		ok = msg.Body == nil
+	case thisIsMyMemPool, needTransactions:
+		_, ok = msg.Body.([]string)
+	case theseAreTransactions:
+		_, ok = msg.Body.([]Transaction)
+	case newInventory, needInventory:
+		_, ok = msg.Body.(Inventory)
+	case hello:
+		_, ok = msg.Body.(Hello)
+	default:
+		return fmt.Errorf("unknown message type %d", msg.MessageType)
+	}
+
+	if !ok {
+		return fmt.Errorf("message type %d has a body of the wrong type (%T)", msg.MessageType, msg.Body)
+	}
+
+	return nil
+}
+
+// toWireMessage converts a (validated) NodeMessage into the WireMessage it represents.
+func (m NodeMessage) toWireMessage() WireMessage {
+	if m.Hello != nil && m.MessageType == needChain {
+		return HelloMessage{Hello: *m.Hello}
+	}
+
+	switch m.MessageType {
+	case newBlock:
+		return BlockMessage{Block: m.Body.(Block)}
+	case newTransaction:
+		return TransactionMessage{Transaction: m.Body.(Transaction)}
+	case thisIsMyChain:
+		return ChainResponseMessage{Chain: m.Body.([]Block)}
+	case needChain:
+		return ChainRequestMessage{}
+	case needMemPool:
+		return MemPoolRequestMessage{}
+	case thisIsMyMemPool:
+		return MemPoolInventoryMessage{TransactionIDs: m.Body.([]string)}
+	case needTransactions:
+		return TransactionsRequestMessage{TransactionIDs: m.Body.([]string)}
+	case theseAreTransactions:
+		return TransactionsMessage{Transactions: m.Body.([]Transaction)}
+	case newInventory:
+		return InventoryMessage{Inventory: m.Body.(Inventory)}
+	case needInventory:
+		return InventoryRequestMessage{Inventory: m.Body.(Inventory)}
+	case hello:
+		return HelloMessage{Hello: m.Body.(Hello)}
+	}
+
+	return nil
+}
+
+// toNodeMessage converts a WireMessage into a NodeMessage old nodes understand. It returns false for messages old nodes
+// don't have (which would crash them).
+func toNodeMessage(message WireMessage) (NodeMessage, bool) {
+	switch m := message.(type) {
+	case BlockMessage:
+		return NodeMessage{MessageType: newBlock, Body: m.Block}, true
+	case TransactionMessage:
+		return NodeMessage{MessageType: newTransaction, Body: m.Transaction}, true
+	case ChainResponseMessage:
+		return NodeMessage{MessageType: thisIsMyChain, Body: m.Chain}, true
+	case ChainRequestMessage:
+		return NodeMessage{MessageType: needChain}, true
+	case HelloMessage:
+		hello := m.Hello
+		return NodeMessage{MessageType: needChain, Hello: &hello}, true
+	}
+
+	return NodeMessage{}, false
+}
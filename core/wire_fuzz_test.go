@@ -0,0 +1,63 @@
+//go:build go1.18
+// +build go1.18
+
+package core
+
+import "testing"
+
+// FuzzUnMarshalNodeMessage checks that no message a peer sends us can make decoding panic,
+// and that every message that decodes is valid. Run it with: go test ./core -fuzz FuzzUnMarshalNodeMessage
+// The seed corpus lives in testdata/fuzz/FuzzUnMarshalNodeMessage.
+func FuzzUnMarshalNodeMessage(f *testing.F) {
+	f.Add(NodeMessage{MessageType: newBlock, Body: testGenesisBlock}.Marshal())
+	f.Add(NodeMessage{MessageType: newTransaction, Body: testGenesisBlock.Transactions[0]}.Marshal())
+	f.Add(NodeMessage{MessageType: thisIsMyChain, Body: []Block{testGenesisBlock}}.Marshal())
+	f.Add(NodeMessage{MessageType: needChain, Body: nil}.Marshal())
+	f.Add(NodeMessage{MessageType: thisIsMyMemPool, Body: []string{"id"}}.Marshal())
+	f.Add(NodeMessage{MessageType: theseAreTransactions, Body: testGenesisBlock.Transactions}.Marshal())
+	f.Add(NodeMessage{MessageType: newInventory, Body: Inventory{Blocks: []string{"hash"}, Transactions: []string{"id"}}}.Marshal())
+	f.Add(NodeMessage{MessageType: hello, Body: Hello{ProtocolVersion: ProtocolVersion, NetworkMagic: MainNetworkMagic, GenesisHash: testGenesisBlock.hash(), UserAgent: UserAgent}}.Marshal())
+
+	f.Fuzz(func(t *testing.T, input []byte) {
+		msg, err := unMarshalNodeMessage(input)
+		if err != nil {
+			return
+		}
+
+		if err := validateNodeMessage(msg); err != nil {
+			t.Fatalf("decoded an invalid message without an error: %s", err)
+		}
+	})
+}
+
+// FuzzDecodeWireMessage checks that no message a peer sends us can make decoding panic,
+// and that every message that decodes survives a round trip. Run it with: go test ./core -fuzz FuzzDecodeWireMessage
+// The seed corpus lives in testdata/fuzz/FuzzDecodeWireMessage.
+func FuzzDecodeWireMessage(f *testing.F) {
+	for _, message := range testWireMessages {
+		data, err := EncodeWireMessage(message)
+		if err != nil {
+			f.Fatal(err)
+		}
+
+		f.Add(data)
+	}
+
+	f.Add(NodeMessage{MessageType: newBlock, Body: testGenesisBlock}.Marshal())
+
+	f.Fuzz(func(t *testing.T, input []byte) {
+		msg, err := DecodeWireMessage(input)
+		if err != nil {
+			return
+		}
+
+		data, err := EncodeWireMessage(msg)
+		if err != nil {
+			t.Fatalf("failed to encode a message we decoded: %s", err)
+		}
+
+		if _, err := DecodeWireMessage(data); err != nil {
+			t.Fatalf("failed to decode a message we encoded: %s", err)
+		}
+	})
+}
@@ -0,0 +1,233 @@
+package core
+
+import (
+	"bytes"
+	"encoding/gob"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+// Every type of WireMessage, for round trip tests
+var testWireMessages = []WireMessage{
+	BlockMessage{Block: testGenesisBlock},
+	TransactionMessage{Transaction: testGenesisBlock.Transactions[0]},
+	ChainRequestMessage{},
+	ChainResponseMessage{Chain: []Block{testGenesisBlock}},
+	MemPoolRequestMessage{},
+	MemPoolInventoryMessage{TransactionIDs: []string{"id"}},
+	TransactionsRequestMessage{TransactionIDs: []string{"id"}},
+	TransactionsMessage{Transactions: testGenesisBlock.Transactions},
+	InventoryMessage{Inventory: Inventory{Blocks: []string{"hash"}}},
+	InventoryRequestMessage{Inventory: Inventory{Transactions: []string{"id"}}},
+	HelloMessage{Hello: Hello{ProtocolVersion: ProtocolVersion, NetworkMagic: MainNetworkMagic, GenesisHash: testGenesisBlock.hash(), BestHeight: 3, UserAgent: UserAgent}},
+}
+
+func TestEncodeWireMessage(t *testing.T) {
+	data, err := EncodeWireMessage(ChainRequestMessage{})
+	assert.NoError(t, err)
+
+	// magic | version | type | length | payload ("{}")
+	assert.Equal(t, append(append([]byte{}, wireMagic...), WireVersion, needChain, 0, 0, 0, 2, '{', '}'), data)
+
+	// Messages that are too big
+	_, err = EncodeWireMessage(MemPoolInventoryMessage{TransactionIDs: []string{string(make([]byte, MaxMessageSize))}})
+	assert.Error(t, err)
+}
+
+func TestDecodeWireMessage(t *testing.T) {
+	// Valid messages decode back into the same message
+	for _, message := range testWireMessages {
+		data, err := EncodeWireMessage(message)
+		assert.NoError(t, err)
+
+		decoded, err := DecodeWireMessage(data)
+		assert.NoError(t, err)
+		assert.Equal(t, message, decoded)
+	}
+
+	// Blocks hash the same after a round trip
+	data, _ := EncodeWireMessage(BlockMessage{Block: testGenesisBlock})
+	decoded, _ := DecodeWireMessage(data)
+	assert.Equal(t, testGenesisBlock.hash(), decoded.(BlockMessage).Block.hash())
+
+	valid, _ := EncodeWireMessage(ChainResponseMessage{Chain: []Block{testGenesisBlock}})
+
+	// Truncated messages
+	_, err := DecodeWireMessage(valid[:len(valid)/2])
+	assert.Error(t, err)
+	_, err = DecodeWireMessage(valid[:wireHeaderSize-1])
+	assert.Error(t, err)
+
+	// Messages from a newer wire version
+	newer := append([]byte{}, valid...)
+	newer[4] = WireVersion + 1
+	_, err = DecodeWireMessage(newer)
+	assert.Error(t, err)
+
+	// Unknown message types
+	unknown := append([]byte{}, valid...)
+	unknown[5] = 255
+	_, err = DecodeWireMessage(unknown)
+	assert.Error(t, err)
+
+	// Payloads that don't match their type
+	wrongType := append([]byte{}, valid...)
+	wrongType[5] = newBlock
+	_, err = DecodeWireMessage(wrongType)
+	assert.Error(t, err)
+
+	// Empty chains
+	empty, _ := EncodeWireMessage(ChainResponseMessage{Chain: []Block{}})
+	_, err = DecodeWireMessage(empty)
+	assert.Error(t, err)
+
+	// Messages that are too big
+	_, err = DecodeWireMessage(append(append([]byte{}, wireMagic...), make([]byte, MaxMessageSize)...))
+	assert.Error(t, err)
+}
+
+func TestDecodeWireMessage_Legacy(t *testing.T) {
+	// Old gob NodeMessages decode into the matching WireMessage
+	legacy := []NodeMessage{
+		{MessageType: newBlock, Body: testGenesisBlock},
+		{MessageType: newTransaction, Body: testGenesisBlock.Transactions[0]},
+		{MessageType: needChain, Body: nil},
+		{MessageType: thisIsMyChain, Body: []Block{testGenesisBlock}},
+		{MessageType: needMemPool, Body: nil},
+		{MessageType: thisIsMyMemPool, Body: []string{"id"}},
+		{MessageType: needTransactions, Body: []string{"id"}},
+		{MessageType: theseAreTransactions, Body: testGenesisBlock.Transactions},
+		{MessageType: newInventory, Body: Inventory{Blocks: []string{"hash"}}},
+		{MessageType: needInventory, Body: Inventory{Transactions: []string{"id"}}},
+		{MessageType: hello, Body: testWireMessages[10].(HelloMessage).Hello},
+	}
+
+	// testWireMessages is in the same order as the old message types
+	for i, message := range legacy {
+		decoded, err := DecodeWireMessage(message.Marshal())
+		assert.NoError(t, err)
+		assert.Equal(t, testWireMessages[i].messageType(), decoded.messageType())
+	}
+
+	decoded, err := DecodeWireMessage(legacy[0].Marshal())
+	assert.NoError(t, err)
+	assert.Equal(t, BlockMessage{Block: testGenesisBlock}, decoded)
+
+	// Invalid old messages are still rejected
+	_, err = DecodeWireMessage(NodeMessage{MessageType: newBlock, Body: testGenesisBlock.Transactions[0]}.Marshal())
+	assert.Error(t, err)
+
+	// Once the migration window is over, old messages are rejected
+	DecodeLegacyMessages = false
+	defer func() { DecodeLegacyMessages = true }()
+
+	_, err = DecodeWireMessage(legacy[0].Marshal())
+	assert.Error(t, err)
+}
+
+func TestWireEnvelope(t *testing.T) {
+	envelope, err := unMarshalWireEnvelope(wireEnvelope{WireMessage: BlockMessage{Block: testGenesisBlock}}.Marshal())
+	assert.NoError(t, err)
+	assert.Equal(t, wireEnvelope{WireMessage: BlockMessage{Block: testGenesisBlock}}, envelope)
+
+	// Legacy envelopes are sent (and decoded) as NodeMessages
+	legacy := wireEnvelope{WireMessage: BlockMessage{Block: testGenesisBlock}, legacy: true}
+	assert.Equal(t, NodeMessage{MessageType: newBlock, Body: testGenesisBlock}.Marshal(), legacy.Marshal())
+
+	envelope, err = unMarshalWireEnvelope(legacy.Marshal())
+	assert.NoError(t, err)
+	assert.Equal(t, legacy, envelope)
+
+	// Messages old nodes don't have can't be sent to them
+	assert.Nil(t, wireEnvelope{WireMessage: MemPoolRequestMessage{}, legacy: true}.Marshal())
+
+	_, err = unMarshalWireEnvelope([]byte("definitely not a message"))
+	assert.Error(t, err)
+}
+
+func TestToNodeMessage(t *testing.T) {
+	// Only the messages old nodes have can be converted
+	for _, message := range testWireMessages {
+		converted, ok := toNodeMessage(message)
+
+		switch message.(type) {
+		case BlockMessage, TransactionMessage, ChainResponseMessage, ChainRequestMessage, HelloMessage:
+			assert.True(t, ok)
+
+			decoded, err := DecodeWireMessage(converted.Marshal())
+			assert.NoError(t, err)
+			assert.Equal(t, message, decoded)
+		default:
+			assert.False(t, ok)
+		}
+	}
+
+	// Our Hello goes on a needChain, which old nodes answer with their chain
+	converted, ok := toNodeMessage(testWireMessages[10])
+	assert.True(t, ok)
+	assert.Equal(t, needChain, converted.MessageType)
+	assert.Nil(t, converted.Body)
+
+	type oldNodeMessage struct {
+		MessageType int
+		Body        interface{}
+	}
+
+	var old oldNodeMessage
+	assert.NoError(t, gob.NewDecoder(bytes.NewReader(converted.Marshal())).Decode(&old))
+	assert.Equal(t, oldNodeMessage{MessageType: needChain}, old)
+}
+
+func TestUnMarshalNodeMessage(t *testing.T) {
+	// Valid messages decode back into the same message
+	messages := []NodeMessage{
+		{MessageType: newBlock, Body: testGenesisBlock},
+		{MessageType: newTransaction, Body: testGenesisBlock.Transactions[0]},
+		{MessageType: thisIsMyChain, Body: []Block{testGenesisBlock}},
+		{MessageType: needChain, Body: nil},
+		{MessageType: needMemPool, Body: nil},
+		{MessageType: thisIsMyMemPool, Body: []string{"id"}},
+		{MessageType: needTransactions, Body: []string{"id"}},
+		{MessageType: theseAreTransactions, Body: testGenesisBlock.Transactions},
+		{MessageType: newInventory, Body: Inventory{Blocks: []string{"hash"}}},
+		{MessageType: needInventory, Body: Inventory{Transactions: []string{"id"}}},
+		{MessageType: hello, Body: Hello{ProtocolVersion: ProtocolVersion, NetworkMagic: MainNetworkMagic, GenesisHash: testGenesisBlock.hash(), UserAgent: UserAgent}},
+	}
+
+	for _, message := range messages {
+		decoded, err := unMarshalNodeMessage(message.Marshal())
+		assert.NoError(t, err)
+		assert.Equal(t, message, decoded)
+	}
+
+	// Garbage
+	_, err := unMarshalNodeMessage([]byte("definitely not gob"))
+	assert.Error(t, err)
+
+	// Truncated messages
+	valid := NodeMessage{MessageType: thisIsMyChain, Body: []Block{testGenesisBlock}}.Marshal()
+	_, err = unMarshalNodeMessage(valid[:len(valid)/2])
+	assert.Error(t, err)
+
+	// Messages that are too big
+	_, err = unMarshalNodeMessage(make([]byte, MaxMessageSize+1))
+	assert.Error(t, err)
+
+	// Unknown message types
+	_, err = unMarshalNodeMessage(NodeMessage{MessageType: 999, Body: nil}.Marshal())
+	assert.Error(t, err)
+
+	// Bodies of the wrong type
+	_, err = unMarshalNodeMessage(NodeMessage{MessageType: newBlock, Body: testGenesisBlock.Transactions[0]}.Marshal())
+	assert.Error(t, err)
+
+	// Empty chains
+	_, err = unMarshalNodeMessage(NodeMessage{MessageType: thisIsMyChain, Body: []Block{}}.Marshal())
+	assert.Error(t, err)
+
+	// Messages that are missing their body
+	var buf bytes.Buffer
+	assert.NoError(t, gob.NewEncoder(&buf).Encode(struct{ MessageType int }{MessageType: newBlock}))
+	_, err = unMarshalNodeMessage(buf.Bytes())
+	assert.Error(t, err)
+}
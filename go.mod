@@ -3,7 +3,7 @@ module github.com/transmissionsdev/cosmosis
 go 1.14
 
 require (
-	github.com/carlescere/scheduler v0.0.0-20170109141437-ee74d2f83d82
+	github.com/decred/dcrd/dcrec/secp256k1/v4 v4.0.1
 	github.com/gin-contrib/cors v1.3.1
 	github.com/gin-gonic/gin v1.6.3
 	github.com/go-resty/resty/v2 v2.3.0
@@ -11,6 +11,7 @@ require (
 	github.com/pkg/errors v0.9.1 // indirect
 	github.com/sirupsen/logrus v1.6.0
 	github.com/stretchr/testify v1.6.1
-	golang.org/x/sys v0.0.0-20200331124033-c3d80250170d // indirect
+	golang.org/x/crypto v0.0.0-20191119213627-4f8c1d86b1ba
+	golang.org/x/term v0.0.0-20201210144234-2321bbc49cbf
 	golang.org/x/tools v0.0.0-20200406172401-903869a8272d // indirect
 )
@@ -1,20 +1,28 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
-	"github.com/carlescere/scheduler"
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
 	log "github.com/sirupsen/logrus"
 	"github.com/transmissionsdev/cosmosis/core"
+	"net"
 	"net/http"
 	"os"
+	"os/signal"
+	"strconv"
 	"strings"
+	"syscall"
 	"time"
 )
 
-var self core.LocalNode
+// Where the JSON endpoints are hosted by default.
+const defaultAPIAddress = ":9000"
+
+// Where the admin endpoints (like banning peers or stopping the miner) are hosted by default. Only this machine can reach them.
+const defaultAdminAddress = "127.0.0.1:9001"
 
 const introMessage = `
 _________                                    _____        
@@ -25,124 +33,359 @@ _  /    _  __ \_  ___/_  __  __ \  __ \_  ___/_  /__  ___/
 `
 
 func main() {
-	fmt.Println(introMessage)
+	// Running cosmosis with just flags (or nothing) runs a node, like before there were subcommands
+	if len(os.Args) < 2 || strings.HasPrefix(os.Args[1], "-") {
+		runNode(os.Args[1:])
+		return
+	}
+
+	if os.Args[1] == "node" {
+		runNode(os.Args[2:])
+		return
+	}
+
+	if err := runCommand(os.Args[1], os.Args[2:], os.Stdout); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+		os.Exit(1)
+	}
+}
+
+// runNode runs a node until it is told to shut down.
+func runNode(args []string) {
+	fmt.Print(introMessage + "\n")
+
+	flags := flag.NewFlagSet("node", flag.ExitOnError)
 
 	var operatorPublicKey string
-	flag.StringVar(&operatorPublicKey, "publicKey", "", "A valid public key where funds from mining can be sent to your account")
+	flags.StringVar(&operatorPublicKey, "publicKey", "", "A valid public key where funds from mining can be sent to your account")
 	var validationServerURL string
-	flag.StringVar(&validationServerURL, "validationServer", "https://crows.sh/verifySignature", "A full url (with http://) that operates as a valid ECDSA SECP256k1 signature validation webserver. We recommend you run one locally. Go to: https://github.com/transmissionsdev/cosmosisUtils to find instructions to run one!")
+	flags.StringVar(&validationServerURL, "validationServer", "https://crows.sh/verifySignature", "A full url (with http://) that operates as a valid ECDSA SECP256k1 signature validation webserver. We recommend you run one locally. Go to: https://github.com/transmissionsdev/cosmosisUtils to find instructions to run one!")
 	var seedNodeIPsRaw string
-	flag.StringVar(&seedNodeIPsRaw, "seedNodes", "", "A list of addresses of other nodes separated by commas (Example: 75.82.156.254,25.92.256.254)")
+	flags.StringVar(&seedNodeIPsRaw, "seedNodes", "", "A list of addresses (host or host:port) of other nodes separated by commas. The port defaults to 7000. (Example: 75.82.156.254,25.92.256.254:7001)")
+	var listenHost string
+	flags.StringVar(&listenHost, "listenHost", "", "The IP to listen for peers on. Listens on all interfaces if empty.")
+	var port uint
+	flags.UintVar(&port, "port", uint(core.PortP2P), "The port to listen for peers on.")
+	var advertisedAddress string
+	flags.StringVar(&advertisedAddress, "advertisedAddress", "", "The host:port other nodes should reach you on, if it is different to the one you listen on (like behind NAT or in a container). Defaults to your outbound IP and port.")
 	var minimumChainsForConsensus int
-	flag.IntVar(&minimumChainsForConsensus, "minimumChainsForConsensus", 4, "How many chains you wish to get before making consensus.")
+	flags.IntVar(&minimumChainsForConsensus, "minimumChainsForConsensus", 4, "How many chains you wish to get before making consensus.")
+	var consensusTimeout time.Duration
+	flags.DurationVar(&consensusTimeout, "consensusTimeout", core.DefaultConsensusTimeout, "How long to wait for chains from peers before making consensus with the chains that arrived.")
+	var banThreshold int
+	flags.IntVar(&banThreshold, "banThreshold", core.DefaultBanThreshold, "How much misbehaviour (sending invalid blocks, chains, transactions or messages) a peer can get away with before being banned.")
+	var banDuration time.Duration
+	flags.DurationVar(&banDuration, "banDuration", core.DefaultBanDuration, "How long misbehaving peers are banned for.")
+	var banListPath string
+	flags.StringVar(&banListPath, "banList", "bans.json", "A file where banned peers are saved so they stay banned between restarts.")
+	var networkMagic uint
+	flags.UintVar(&networkMagic, "networkMagic", uint(core.MainNetworkMagic), "Identifies which network to join. Only change this to run a separate network (like a testnet).")
+	var minimumTransactions int
+	flags.IntVar(&minimumTransactions, "minimumTransactions", 1, "How many transactions need to be waiting before you start mining a block.")
+	var miningDelay time.Duration
+	flags.DurationVar(&miningDelay, "miningDelay", 0, "How long to wait for more transactions once there are enough to mine a block (so more are included in it).")
+	var refreshGrowth float64
+	flags.Float64Var(&refreshGrowth, "refreshGrowth", core.DefaultRefreshGrowth, "How much the MemPool has to grow while mining a block (as a fraction of the transactions in it) before the block is rebuilt with the new transactions.")
 	var hostJSONEndpoints bool
-	flag.BoolVar(&hostJSONEndpoints, "hostJSONEndpoints", false, "Include this flag if you would like a webserver to be hosted alongside the P2P protocol for communicating with wallets, etc.")
+	flags.BoolVar(&hostJSONEndpoints, "hostJSONEndpoints", false, "Include this flag if you would like a webserver to be hosted alongside the P2P protocol for communicating with wallets, etc.")
+	var apiAddress string
+	flags.StringVar(&apiAddress, "apiAddress", defaultAPIAddress, "The host:port to host the JSON endpoints on (if hostJSONEndpoints is set).")
+	var adminAddress string
+	flags.StringVar(&adminAddress, "adminAddress", defaultAdminAddress, "The host:port to host the admin endpoints (like banning peers or stopping the miner) on (if hostJSONEndpoints is set). They aren't authenticated, so only use a loopback host.")
 
-	flag.Parse()
+	flags.Parse(args)
+
+	// ------[Validate Flags]----------
+	if operatorPublicKey == "" {
+		flags.PrintDefaults()
+		os.Exit(1)
+	}
 
-	var seedNodeIPs = make([]string, 0)
+	if !core.IsValidRecipient(operatorPublicKey) {
+		flags.PrintDefaults()
+		log.Fatalf("Your public key (%s) is not a valid address or public key, so nobody could spend the coins you mine!\n", operatorPublicKey)
+	}
 
-	if seedNodeIPsRaw != "" {
-		seedNodeIPs = strings.Split(seedNodeIPsRaw, ",")
+	seedNodeIPs, err := core.ParseSeedNodes(seedNodeIPsRaw)
+	if err != nil {
+		flags.PrintDefaults()
+		log.Fatalf("Your seed nodes are invalid! [error: %s]\n", err)
+	}
 
-		// Add port to each seed node
-		for i, ip := range seedNodeIPs {
-			seedNodeIPs[i] = fmt.Sprintf("%s:%d", ip, core.PortP2P)
-		}
+	if !isLoopbackAddress(adminAddress) {
+		flags.PrintDefaults()
+		log.Fatalf("Your admin address (%s) must be on a loopback host (like 127.0.0.1), as anyone who can reach it can ban peers or stop the miner!\n", adminAddress)
 	}
 
-	// ------[Validate Flags]----------
-	if operatorPublicKey == "" {
-		flag.PrintDefaults()
-		os.Exit(1)
+	if port > 65535 {
+		flags.PrintDefaults()
+		log.Fatalf("Your port (%d) is invalid!\n", port)
 	}
 
 	client := http.Client{
 		Timeout: 1 * time.Second,
 	}
-	_, err := client.Get(validationServerURL)
+	_, err = client.Get(validationServerURL)
 	if err != nil {
-		flag.PrintDefaults()
+		flags.PrintDefaults()
 		log.Fatal("Your validation server URL is unreachable! See instructions to run your own here: https://github.com/transmissionsdev/cosmosisUtils\n")
 	}
 	// --------------------------------
 
-	self = core.LocalNode{Chain: []core.Block{core.GenesisBlock}, MemPool: make([]core.Transaction, 0), UTXO: make(core.UTXO), ValidationServerURL: validationServerURL, OperatorPublicKey: operatorPublicKey, MinimumChainsForConsensus: minimumChainsForConsensus}
-
-	scheduler.Every(1).Minutes().NotImmediately().Run(func() {
-		// Save all young transactions and filter out stale transactions.
-		i := 0
-		for _, transaction := range self.MemPool {
-			// If transaction is younger than 24 hours
-			if time.Now().Sub(time.Unix(transaction.Timestamp, 0)).Hours() < 24 {
-				self.MemPool[i] = transaction
-				i++
-			} else {
-				log.Warnf("Removing a stale transaction from the MemPool.... (%+v)", transaction)
-			}
-		}
-		self.MemPool = self.MemPool[:i]
+	self := &core.LocalNode{Chain: []core.Block{core.GenesisBlock}, MemPool: make([]core.Transaction, 0), UTXO: make(core.UTXO), ValidationServerURL: validationServerURL, OperatorPublicKey: operatorPublicKey, MinimumChainsForConsensus: minimumChainsForConsensus, ConsensusTimeout: consensusTimeout, BanThreshold: banThreshold, BanDuration: banDuration, BanListPath: banListPath, NetworkMagic: uint32(networkMagic), ListenAddress: net.JoinHostPort(listenHost, strconv.Itoa(int(port))), AdvertisedAddress: advertisedAddress}
 
-		// Start mining if we have enough transactions
-		if len(self.MemPool) > 0 && self.IsMining == false {
-			log.Infof("Starting to mine a block with %d transactions...", len(self.MemPool))
+	a := newAPI(self)
+	a.miner.MinimumTransactions = minimumTransactions
+	a.miner.Delay = miningDelay
+	a.miner.RefreshGrowth = refreshGrowth
 
-			block := self.MineBlock(&self.IsMining)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
 
-			// If we finished mining and won the race!
-			if block != nil {
+	if err := self.Start(ctx, seedNodeIPs); err != nil {
+		log.Fatalf("Failed to start our node! [error: %s]\n", err)
+	}
 
-				// If mined block was valid and added to chain:
-				if self.AddMinedBlockToChain(*block) == true {
+	if err := a.miner.Start(); err != nil {
+		log.Fatalf("Failed to start mining! [error: %s]\n", err)
+	}
 
-					// Alert all other nodes of our new valid block.
-					self.BroadcastBlock(*block)
+	if hostJSONEndpoints {
+		router := newRouter(a)
+		go router.Run(apiAddress)
 
-					log.Info("We just mined a new block and added it to the chain!")
-				} else {
-					log.Warn("The block we just mined was not valid! It was not added to the chain and the UTXO was not updated!")
-				}
-			} else {
-				log.Info("We didn't mine a block in time, another node got the next block before us (or mining was canceled as there were no valid transactions).")
-			}
-		}
-	})
+		adminRouter := newAdminRouter(a)
+		go adminRouter.Run(adminAddress)
+	}
 
-	if hostJSONEndpoints {
-		router := gin.Default()
-		router.POST("/cosmosis/newTransaction", newTransaction)
-		router.GET("/cosmosis/getChain", getChain)
-		router.GET("/cosmosis/getUTXOs", getUTXOs)
-		router.GET("/cosmosis/getMemPool", getMemPool)
-		router.Use(cors.Default())
-		go router.Run(":9000")
+	// Run until we are told to shut down
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	<-signals
+
+	if err := self.Stop(); err != nil {
+		log.Errorf("Failed to save our ban list while stopping! [error: %s]", err)
 	}
+}
+
+// api is what our endpoints serve: a node and the miner and work server built on it.
+type api struct {
+	node       *core.LocalNode
+	miner      *core.Miner
+	workServer *core.WorkServer
+}
+
+// newAPI creates the miner and work server for a node.
+func newAPI(node *core.LocalNode) *api {
+	return &api{node: node, miner: core.NewMiner(node), workServer: core.NewWorkServer(node)}
+}
+
+// newRouter creates the JSON endpoints for our node.
+func newRouter(a *api) *gin.Engine {
+	router := gin.Default()
+	router.POST("/cosmosis/newTransaction", a.newTransaction)
+	router.GET("/cosmosis/getChain", a.getChain)
+	router.GET("/cosmosis/getUTXOs", a.getUTXOs)
+	router.GET("/cosmosis/getBalance/:account", a.getBalance)
+	router.GET("/cosmosis/getMemPool", a.getMemPool)
+	router.GET("/cosmosis/getPeers", a.getPeers)
+	router.GET("/cosmosis/getBannedPeers", a.getBannedPeers)
+	router.GET("/cosmosis/getMinerStatus", a.getMinerStatus)
+	router.GET("/cosmosis/getWork", a.getWork)
+	router.POST("/cosmosis/submitWork", a.submitWork)
+	router.Use(cors.Default())
+
+	return router
+}
+
+// newAdminRouter creates the endpoints for managing our node. They aren't authenticated, so they must only be hosted on a loopback address.
+func newAdminRouter(a *api) *gin.Engine {
+	router := gin.Default()
+	router.GET("/cosmosis/getPeerKeys", a.getPeerKeys)
+	router.POST("/cosmosis/banPeer", a.banPeer)
+	router.POST("/cosmosis/unbanPeer", a.unbanPeer)
+	router.POST("/cosmosis/startMining", a.startMining)
+	router.POST("/cosmosis/stopMining", a.stopMining)
 
-	self.Start(seedNodeIPs)
+	return router
 }
 
-func newTransaction(c *gin.Context) {
+// isLoopbackAddress checks whether a host:port is only reachable from this machine.
+func isLoopbackAddress(address string) bool {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return false
+	}
+
+	if host == "localhost" {
+		return true
+	}
+
+	ip := net.ParseIP(host)
+
+	return ip != nil && ip.IsLoopback()
+}
+
+func (a *api) newTransaction(c *gin.Context) {
 	var json core.Transaction
 	if err := c.ShouldBindJSON(&json); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	self.AddTransactionToMemPool(json)
+	if !json.HasValidRecipients() {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "the recipient (or the recipient of every output or payment) must be a valid address or public key"})
+		return
+	}
+
+	if !a.node.AddTransactionToMemPool(json) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "the transaction was rejected (its signature is invalid, it is locked for too long, it is already in the MemPool or chain, or the MemPool is full)"})
+		return
+	}
 
 	c.JSON(200, gin.H{
 		"received": true,
 	})
 }
 
-func getChain(c *gin.Context) {
-	c.JSON(200, self.Chain)
+func (a *api) getChain(c *gin.Context) {
+	c.JSON(200, a.node.Snapshot().Chain)
 }
 
-func getUTXOs(c *gin.Context) {
-	c.JSON(200, self.UTXO)
+// getUTXOs responds with every account's funds (account -> {"Spendable", "Immature", "Outputs"}).
+// This is a breaking change: it used to respond with account -> amount. Clients that only need an account's coins should use getBalance.
+func (a *api) getUTXOs(c *gin.Context) {
+	c.JSON(200, a.node.Snapshot().UTXO)
 }
 
-func getMemPool(c *gin.Context) {
-	c.JSON(200, self.MemPool)
+// How many coins an account has
+type balance struct {
+	Spendable uint64 `json:"spendable"` // The coins the account can spend
+	Immature  uint64 `json:"immature"`  // Coinbase rewards the account can't spend until they mature
+	Outputs   uint64 `json:"outputs"`   // The coins in the account's unspent outputs (which output-based transactions can spend)
+}
+
+// getBalance responds with how many coins an account has (by its public key or address). It replaces reading an amount
+// out of getUTXOs, whose entries are no longer plain amounts (see getUTXOs).
+func (a *api) getBalance(c *gin.Context) {
+	account := c.Param("account")
+	utxo := a.node.Snapshot().UTXO
+
+	c.JSON(200, balance{Spendable: utxo.Balance(account), Immature: utxo.ImmatureBalance(account), Outputs: utxo.OutputBalance(account)})
+}
+
+func (a *api) getMemPool(c *gin.Context) {
+	c.JSON(200, a.node.Snapshot().MemPool)
+}
+
+func (a *api) getPeers(c *gin.Context) {
+	c.JSON(200, a.node.Peers())
+}
+
+func (a *api) getBannedPeers(c *gin.Context) {
+	c.JSON(200, a.node.BannedPeers())
+}
+
+func (a *api) getPeerKeys(c *gin.Context) {
+	c.JSON(200, a.node.ConnectedPeerKeys())
+}
+
+// A request to ban or unban a peer
+type banRequest struct {
+	Key      string `json:"key" binding:"required"` // The peer's key (see getPeerKeys)
+	Duration string `json:"duration"`               // How long to ban the peer for (like "24h"). Defaults to the node's ban duration.
+}
+
+func (a *api) banPeer(c *gin.Context) {
+	var json banRequest
+	if err := c.ShouldBindJSON(&json); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	duration := a.node.BanDuration
+	if json.Duration != "" {
+		var err error
+		if duration, err = time.ParseDuration(json.Duration); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	if err := a.node.BanPeer(json.Key, duration); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(200, gin.H{
+		"banned": true,
+	})
+}
+
+func (a *api) unbanPeer(c *gin.Context) {
+	var json banRequest
+	if err := c.ShouldBindJSON(&json); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := a.node.UnbanPeer(json.Key); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(200, gin.H{
+		"unbanned": true,
+	})
+}
+
+func (a *api) getMinerStatus(c *gin.Context) {
+	c.JSON(200, a.miner.Status())
+}
+
+func (a *api) startMining(c *gin.Context) {
+	if err := a.miner.Start(); err != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(200, a.miner.Status())
+}
+
+func (a *api) stopMining(c *gin.Context) {
+	a.miner.Stop()
+
+	c.JSON(200, a.miner.Status())
+}
+
+func (a *api) getWork(c *gin.Context) {
+	work, err := a.workServer.GetWork()
+	if err != nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(200, work)
+}
+
+// A nonce found by a mining worker
+type workSubmission struct {
+	ID    string `json:"id" binding:"required"` // The ID of the work the nonce is for
+	Nonce int64  `json:"nonce"`                 // The nonce that gives the block a valid proof
+}
+
+func (a *api) submitWork(c *gin.Context) {
+	var json workSubmission
+	if err := c.ShouldBindJSON(&json); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	block, err := a.workServer.SubmitWork(json.ID, json.Nonce)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(200, block)
 }
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"github.com/transmissionsdev/cosmosis/core"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// submit posts a nonce to the submitWork endpoint, and decodes the block it returns (if any).
+func submit(t *testing.T, client nodeClient, id string, nonce int64) (*http.Response, core.Block) {
+	body, err := json.Marshal(workSubmission{ID: id, Nonce: nonce})
+	assert.NoError(t, err)
+
+	resp, err := http.Post(client.endpoint("submitWork"), "application/json", bytes.NewReader(body))
+	assert.NoError(t, err)
+	defer resp.Body.Close()
+
+	var block core.Block
+	if resp.StatusCode == http.StatusOK {
+		assert.NoError(t, json.NewDecoder(resp.Body).Decode(&block))
+	}
+
+	return resp, block
+}
+
+func TestGetWorkAndSubmitWork(t *testing.T) {
+	node, a := startTestNode(t)
+	url := node.URL
+	client := nodeClient{url: &url}
+
+	// Nothing to mine
+	var work core.Work
+	assert.Error(t, client.get("getWork", &work))
+
+	genesisRecipient := core.GenesisBlock.Transactions[0].Recipient
+	genesisAddress, err := core.PublicKeyToAddress(genesisRecipient)
+	assert.NoError(t, err)
+
+	transaction := core.Transaction{Sender: genesisRecipient, Recipient: genesisAddress, Amount: 10, Timestamp: 1586200000, Signature: "signature"}
+	assert.NoError(t, client.post("newTransaction", transaction))
+
+	// A worker gets work over HTTP, and solves it with only what the API told it
+	assert.NoError(t, client.get("getWork", &work))
+	assert.Equal(t, core.SHA256(core.GenesisBlock), work.Header.PreviousHash)
+	assert.Equal(t, []core.Transaction{transaction}, work.Header.Transactions[1:])
+
+	nonce, found := work.Solve(func() bool { return false })
+	assert.True(t, found)
+
+	// Unknown work
+	resp, _ := submit(t, client, "not work", nonce)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	resp, block := submit(t, client, work.ID, nonce)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.True(t, core.ValidateProof(block))
+
+	state := a.node.Snapshot()
+	assert.Equal(t, []core.Block{core.GenesisBlock, block}, state.Chain)
+	assert.Empty(t, state.MemPool)
+
+	// The same work can't be submitted twice
+	resp, _ = submit(t, client, work.ID, nonce)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	// The chain the API serves has the worker's block
+	var chain []core.Block
+	assert.NoError(t, client.get("getChain", &chain))
+	assert.Equal(t, []core.Block{core.GenesisBlock, block}, chain)
+}
+
+func TestNewTransaction_Rejected(t *testing.T) {
+	node, a := startTestNode(t)
+	url := node.URL
+	client := nodeClient{url: &url}
+
+	genesisRecipient := core.GenesisBlock.Transactions[0].Recipient
+	genesisAddress, err := core.PublicKeyToAddress(genesisRecipient)
+	assert.NoError(t, err)
+
+	transaction := core.Transaction{Sender: genesisRecipient, Recipient: genesisAddress, Amount: 10, Timestamp: 1586200000, Signature: "signature"}
+	assert.NoError(t, client.post("newTransaction", transaction))
+
+	// The node already has it
+	body, err := json.Marshal(transaction)
+	assert.NoError(t, err)
+
+	resp, err := http.Post(client.endpoint("newTransaction"), "application/json", bytes.NewReader(body))
+	assert.NoError(t, err)
+	defer resp.Body.Close()
+
+	var response map[string]string
+	assert.NoError(t, json.NewDecoder(resp.Body).Decode(&response))
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	assert.Contains(t, response["error"], "rejected")
+
+	assert.Equal(t, []core.Transaction{transaction}, a.node.Snapshot().MemPool)
+}
+
+func TestAdminRouter(t *testing.T) {
+	node, a := startTestNode(t)
+	admin := httptest.NewServer(newAdminRouter(a))
+	defer admin.Close()
+
+	// Bans are kept once our node is on the P2P network
+	a.node.ListenAddress = "127.0.0.1:0"
+	assert.NoError(t, a.node.Start(context.Background(), nil))
+	defer a.node.Stop()
+
+	body := []byte(`{"key": "peer1", "duration": "1h"}`)
+
+	// Anyone can reach the JSON endpoints, so peers can't be banned through them
+	resp, err := http.Post(node.URL+"/cosmosis/banPeer", "application/json", bytes.NewReader(body))
+	assert.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+	resp, err = http.Post(admin.URL+"/cosmosis/banPeer", "application/json", bytes.NewReader(body))
+	assert.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.True(t, a.node.IsPeerBanned("peer1"))
+
+	resp, err = http.Post(admin.URL+"/cosmosis/unbanPeer", "application/json", bytes.NewReader(body))
+	assert.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.False(t, a.node.IsPeerBanned("peer1"))
+}
+
+func TestAdminRouter_Mining(t *testing.T) {
+	node, a := startTestNode(t)
+	admin := httptest.NewServer(newAdminRouter(a))
+	defer admin.Close()
+
+	assert.NoError(t, a.miner.Start())
+	defer a.miner.Stop()
+
+	// Anyone can reach the JSON endpoints, so the miner (which also expires the MemPool) can't be stopped through them
+	resp, err := http.Post(node.URL+"/cosmosis/stopMining", "application/json", nil)
+	assert.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+	assert.True(t, a.miner.Status().Running)
+
+	resp, err = http.Post(admin.URL+"/cosmosis/stopMining", "application/json", nil)
+	assert.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.False(t, a.miner.Status().Running)
+
+	resp, err = http.Post(node.URL+"/cosmosis/startMining", "application/json", nil)
+	assert.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+	resp, err = http.Post(admin.URL+"/cosmosis/startMining", "application/json", nil)
+	assert.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.True(t, a.miner.Status().Running)
+}
+
+func TestIsLoopbackAddress(t *testing.T) {
+	assert.True(t, isLoopbackAddress("127.0.0.1:9001"))
+	assert.True(t, isLoopbackAddress("[::1]:9001"))
+	assert.True(t, isLoopbackAddress("localhost:9001"))
+
+	assert.False(t, isLoopbackAddress(":9001"))
+	assert.False(t, isLoopbackAddress("0.0.0.0:9001"))
+	assert.False(t, isLoopbackAddress("75.82.156.254:9001"))
+	assert.False(t, isLoopbackAddress("127.0.0.1"))
+}
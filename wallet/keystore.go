@@ -0,0 +1,244 @@
+package wallet
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"golang.org/x/crypto/scrypt"
+	"io/ioutil"
+	"os"
+	"sync"
+)
+
+// The scrypt parameters used to derive the key that encrypts new keys.
+const (
+	scryptN      = 1 << 15
+	scryptR      = 8
+	scryptP      = 1
+	scryptKeyLen = 32
+)
+
+// The most expensive scrypt parameters we accept from a keystore file. Deriving a key with them takes 128*N*R bytes of memory
+// (256 MiB at the max) and P times as long, so a keystore from someone else can't make us run out of memory or hang.
+const (
+	maxScryptN = 1 << 18
+	maxScryptR = 8
+	maxScryptP = 4
+)
+
+// The version of the keystore file format.
+const keystoreVersion = 1
+
+var ErrWrongPassphrase = errors.New("the passphrase is wrong")
+
+// An EncryptedKey is a private key encrypted (with AES-GCM) by a key derived from a passphrase (with scrypt).
+type EncryptedKey struct {
+	PublicKey  string `json:"publicKey"`  // The key's public key (uncompressed hex), so keys can be listed without a passphrase
+	Salt       string `json:"salt"`       // The scrypt salt (hex)
+	N          int    `json:"n"`          // The scrypt parameters
+	R          int    `json:"r"`          //
+	P          int    `json:"p"`          //
+	Nonce      string `json:"nonce"`      // The AES-GCM nonce (hex)
+	CipherText string `json:"cipherText"` // The encrypted private key (hex)
+}
+
+// EncryptKey encrypts a key with a passphrase.
+func EncryptKey(key *Key, passphrase string) (EncryptedKey, error) {
+	salt := make([]byte, 32)
+	if _, err := rand.Read(salt); err != nil {
+		return EncryptedKey{}, err
+	}
+
+	gcm, err := newGCM(passphrase, salt, scryptN, scryptR, scryptP)
+	if err != nil {
+		return EncryptedKey{}, err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return EncryptedKey{}, err
+	}
+
+	publicKey := key.PublicKey()
+
+	// The public key is authenticated so it can't be swapped for another
+	cipherText := gcm.Seal(nil, nonce, key.private.Serialize(), []byte(publicKey))
+
+	return EncryptedKey{
+		PublicKey:  publicKey,
+		Salt:       hex.EncodeToString(salt),
+		N:          scryptN,
+		R:          scryptR,
+		P:          scryptP,
+		Nonce:      hex.EncodeToString(nonce),
+		CipherText: hex.EncodeToString(cipherText),
+	}, nil
+}
+
+// Decrypt decrypts the key with its passphrase. It returns ErrWrongPassphrase if the passphrase is wrong.
+func (e EncryptedKey) Decrypt(passphrase string) (*Key, error) {
+	salt, err := hex.DecodeString(e.Salt)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce, err := hex.DecodeString(e.Nonce)
+	if err != nil {
+		return nil, err
+	}
+
+	cipherText, err := hex.DecodeString(e.CipherText)
+	if err != nil {
+		return nil, err
+	}
+
+	if e.N > maxScryptN || e.R > maxScryptR || e.P > maxScryptP {
+		return nil, fmt.Errorf("the scrypt parameters are too expensive (n=%d, r=%d, p=%d, max n=%d, r=%d, p=%d)", e.N, e.R, e.P, maxScryptN, maxScryptR, maxScryptP)
+	}
+
+	gcm, err := newGCM(passphrase, salt, e.N, e.R, e.P)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(nonce) != gcm.NonceSize() {
+		return nil, fmt.Errorf("the nonce must be %d bytes (got %d)", gcm.NonceSize(), len(nonce))
+	}
+
+	privateKey, err := gcm.Open(nil, nonce, cipherText, []byte(e.PublicKey))
+	if err != nil {
+		return nil, ErrWrongPassphrase
+	}
+
+	key, err := ImportKey(hex.EncodeToString(privateKey))
+	if err != nil {
+		return nil, err
+	}
+
+	if key.PublicKey() != e.PublicKey {
+		return nil, errors.New("the decrypted key does not match its public key")
+	}
+
+	return key, nil
+}
+
+// newGCM derives an AES-GCM cipher from a passphrase.
+func newGCM(passphrase string, salt []byte, n int, r int, p int) (cipher.AEAD, error) {
+	derivedKey, err := scrypt.Key([]byte(passphrase), salt, n, r, p, scryptKeyLen)
+	if err != nil {
+		return nil, err
+	}
+
+	block, err := aes.NewCipher(derivedKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
+
+// A Keystore is a file of passphrase encrypted keys.
+type Keystore struct {
+	sync.Mutex
+
+	path string
+	keys []EncryptedKey
+}
+
+// The format a Keystore is saved in.
+type keystoreFile struct {
+	Version int            `json:"version"`
+	Keys    []EncryptedKey `json:"keys"`
+}
+
+// OpenKeystore opens the keystore at path. The file is created when the first key is added.
+func OpenKeystore(path string) (*Keystore, error) {
+	ks := &Keystore{path: path}
+
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return ks, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	var file keystoreFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, err
+	}
+
+	if file.Version != keystoreVersion {
+		return nil, fmt.Errorf("unsupported keystore version %d (we support %d)", file.Version, keystoreVersion)
+	}
+
+	ks.keys = file.Keys
+
+	return ks, nil
+}
+
+// Add encrypts a key with a passphrase and saves it to the keystore.
+func (ks *Keystore) Add(key *Key, passphrase string) error {
+	encryptedKey, err := EncryptKey(key, passphrase)
+	if err != nil {
+		return err
+	}
+
+	ks.Lock()
+	defer ks.Unlock()
+
+	for _, k := range ks.keys {
+		if k.PublicKey == encryptedKey.PublicKey {
+			return fmt.Errorf("the keystore already has the key %s", encryptedKey.PublicKey)
+		}
+	}
+
+	ks.keys = append(ks.keys, encryptedKey)
+
+	if err := ks.save(); err != nil {
+		ks.keys = ks.keys[:len(ks.keys)-1]
+		return err
+	}
+
+	return nil
+}
+
+// PublicKeys gets the public key of every key in the keystore.
+func (ks *Keystore) PublicKeys() []string {
+	ks.Lock()
+	defer ks.Unlock()
+
+	publicKeys := make([]string, 0, len(ks.keys))
+	for _, k := range ks.keys {
+		publicKeys = append(publicKeys, k.PublicKey)
+	}
+
+	return publicKeys
+}
+
+// Key decrypts the key with a public key.
+func (ks *Keystore) Key(publicKey string, passphrase string) (*Key, error) {
+	ks.Lock()
+	defer ks.Unlock()
+
+	for _, k := range ks.keys {
+		if k.PublicKey == publicKey {
+			return k.Decrypt(passphrase)
+		}
+	}
+
+	return nil, fmt.Errorf("the keystore doesn't have the key %s", publicKey)
+}
+
+// save writes the keystore to its file (only readable by its owner). The keystore must be locked.
+func (ks *Keystore) save() error {
+	data, err := json.MarshalIndent(keystoreFile{Version: keystoreVersion, Keys: ks.keys}, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(ks.path, data, 0600)
+}
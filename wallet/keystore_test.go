@@ -0,0 +1,95 @@
+package wallet
+
+import (
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestEncryptKey(t *testing.T) {
+	key, err := GenerateKey()
+	assert.NoError(t, err)
+
+	encryptedKey, err := EncryptKey(key, "passphrase")
+	assert.NoError(t, err)
+	assert.Equal(t, key.PublicKey(), encryptedKey.PublicKey)
+	assert.NotContains(t, encryptedKey.CipherText, key.PrivateKey())
+
+	decrypted, err := encryptedKey.Decrypt("passphrase")
+	assert.NoError(t, err)
+	assert.Equal(t, key.PrivateKey(), decrypted.PrivateKey())
+
+	_, err = encryptedKey.Decrypt("wrong")
+	assert.Equal(t, ErrWrongPassphrase, err)
+
+	// The public key can't be swapped for another
+	other, err := GenerateKey()
+	assert.NoError(t, err)
+
+	encryptedKey.PublicKey = other.PublicKey()
+	_, err = encryptedKey.Decrypt("passphrase")
+	assert.Error(t, err)
+}
+
+func TestEncryptedKey_Decrypt_ScryptLimits(t *testing.T) {
+	key, err := GenerateKey()
+	assert.NoError(t, err)
+
+	encryptedKey, err := EncryptKey(key, "passphrase")
+	assert.NoError(t, err)
+
+	// Keystores can't make us use too much memory or time deriving their key
+	for _, tooExpensive := range []EncryptedKey{{N: maxScryptN << 1, R: scryptR, P: scryptP}, {N: scryptN, R: maxScryptR + 1, P: scryptP}, {N: scryptN, R: scryptR, P: maxScryptP + 1}} {
+		modified := encryptedKey
+		modified.N, modified.R, modified.P = tooExpensive.N, tooExpensive.R, tooExpensive.P
+
+		_, err = modified.Decrypt("passphrase")
+		assert.Error(t, err)
+		assert.NotEqual(t, ErrWrongPassphrase, err)
+	}
+}
+
+func TestKeystore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "keystore")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "keystore.json")
+
+	ks, err := OpenKeystore(path)
+	assert.NoError(t, err)
+	assert.Empty(t, ks.PublicKeys())
+
+	key, err := GenerateKey()
+	assert.NoError(t, err)
+
+	assert.NoError(t, ks.Add(key, "passphrase"))
+	assert.Error(t, ks.Add(key, "passphrase"))
+	assert.Equal(t, []string{key.PublicKey()}, ks.PublicKeys())
+
+	// The keystore is saved (and only readable by us)
+	info, err := os.Stat(path)
+	assert.NoError(t, err)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+
+	reopened, err := OpenKeystore(path)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{key.PublicKey()}, reopened.PublicKeys())
+
+	loaded, err := reopened.Key(key.PublicKey(), "passphrase")
+	assert.NoError(t, err)
+	assert.Equal(t, key.PrivateKey(), loaded.PrivateKey())
+
+	_, err = reopened.Key(key.PublicKey(), "wrong")
+	assert.Equal(t, ErrWrongPassphrase, err)
+
+	_, err = reopened.Key("04", "passphrase")
+	assert.Error(t, err)
+
+	// Corrupt keystores aren't opened
+	assert.NoError(t, ioutil.WriteFile(path, []byte("not json"), 0600))
+	_, err = OpenKeystore(path)
+	assert.Error(t, err)
+}
@@ -0,0 +1,178 @@
+// Package wallet creates secp256k1 keys and signs Cosmosis transactions with them, so transactions don't have to be signed externally.
+package wallet
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/decred/dcrd/dcrec/secp256k1/v4"
+	"github.com/decred/dcrd/dcrec/secp256k1/v4/ecdsa"
+	"github.com/transmissionsdev/cosmosis/core"
+)
+
+// A Key is a secp256k1 private key that can spend the coins sent to its public key.
+type Key struct {
+	private *secp256k1.PrivateKey
+}
+
+// GenerateKey creates a new random key.
+func GenerateKey() (*Key, error) {
+	private, err := secp256k1.GeneratePrivateKey()
+	if err != nil {
+		return nil, err
+	}
+
+	return &Key{private: private}, nil
+}
+
+// ImportKey creates a key from a hex encoded 32 byte private key. It must be between 1 and the order of the curve (n - 1).
+func ImportKey(privateKeyHex string) (*Key, error) {
+	privateKey, err := hex.DecodeString(privateKeyHex)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(privateKey) != secp256k1.PrivKeyBytesLen {
+		return nil, fmt.Errorf("private keys must be %d bytes (got %d)", secp256k1.PrivKeyBytesLen, len(privateKey))
+	}
+
+	// PrivKeyFromBytes would silently reduce keys that are too big (and zero isn't a key at all)
+	var scalar secp256k1.ModNScalar
+	if overflow := scalar.SetByteSlice(privateKey); overflow || scalar.IsZero() {
+		return nil, errors.New("private keys must be between 1 and the order of the curve")
+	}
+
+	return &Key{private: secp256k1.NewPrivateKey(&scalar)}, nil
+}
+
+// PublicKey gets the key's public key as uncompressed hex (04...), the format used for senders and recipients in transactions.
+func (k *Key) PublicKey() string {
+	return hex.EncodeToString(k.private.PubKey().SerializeUncompressed())
+}
+
+// CompressedPublicKey gets the key's public key as compressed hex (02... or 03...). Nodes treat it as the same account as PublicKey.
+func (k *Key) CompressedPublicKey() string {
+	return hex.EncodeToString(k.private.PubKey().SerializeCompressed())
+}
+
+// Address gets the key's address, the checksummed form of its public key to give people who want to send you coins.
+func (k *Key) Address() string {
+	// Our public keys are always valid
+	address, _ := core.PublicKeyToAddress(k.PublicKey())
+
+	return address
+}
+
+// PrivateKey gets the key's private key as hex. Anyone with it can spend the key's coins.
+func (k *Key) PrivateKey() string {
+	return hex.EncodeToString(k.private.Serialize())
+}
+
+// Sign signs a message, returning the hex encoded DER signature over the message's SHA256 hash.
+func (k *Key) Sign(message string) string {
+	hash := sha256.Sum256([]byte(message))
+
+	return hex.EncodeToString(ecdsa.Sign(k.private, hash[:]).Serialize())
+}
+
+// SignTransaction signs a transaction from the key's public key (compressed or uncompressed), returning the transaction with its Signature set.
+func SignTransaction(transaction core.Transaction, key *Key) (core.Transaction, error) {
+	if sender, err := core.CanonicalPublicKey(transaction.Sender); err != nil || sender != key.PublicKey() {
+		return transaction, fmt.Errorf("the transaction is sent from %s, not this key (%s)", transaction.Sender, key.PublicKey())
+	}
+
+	transaction.Signature = key.Sign(core.TransactionRepresentation(transaction))
+
+	return transaction, nil
+}
+
+// SignMultisigTransaction adds the key's signature to a transaction from a multisig account the key is part of,
+// returning the transaction with the key's entry in Signatures set. Once enough of the account's keys have signed it, it can be sent.
+func SignMultisigTransaction(transaction core.Transaction, key *Key) (core.Transaction, error) {
+	address, err := transaction.Multisig.Address()
+	if err != nil {
+		return transaction, err
+	}
+
+	if transaction.Sender != address {
+		return transaction, fmt.Errorf("the transaction is sent from %s, not its multisig account (%s)", transaction.Sender, address)
+	}
+
+	index := -1
+	for i, publicKey := range transaction.Multisig.PublicKeys {
+		if canonical, err := core.CanonicalPublicKey(publicKey); err == nil && canonical == key.PublicKey() {
+			index = i
+		}
+	}
+
+	if index < 0 {
+		return transaction, fmt.Errorf("this key (%s) isn't part of the multisig account", key.PublicKey())
+	}
+
+	// Don't change the signatures of the transaction we were given
+	signatures := make([]string, len(transaction.Multisig.PublicKeys))
+	copy(signatures, transaction.Signatures)
+
+	signatures[index] = key.Sign(core.TransactionRepresentation(transaction))
+	transaction.Signatures = signatures
+
+	return transaction, nil
+}
+
+// VerifySignature checks a transaction's signature locally (the same check a validation server does).
+// For multisig transactions, it checks that enough of the account's keys signed it.
+func VerifySignature(transaction core.Transaction) bool {
+	message := core.TransactionRepresentation(transaction)
+
+	if transaction.Multisig.Threshold == 0 && len(transaction.Multisig.PublicKeys) == 0 {
+		return verify(transaction.Signature, message, transaction.Sender)
+	}
+
+	address, err := transaction.Multisig.Address()
+	if err != nil || address != transaction.Sender || len(transaction.Signatures) != len(transaction.Multisig.PublicKeys) {
+		return false
+	}
+
+	signed := 0
+	for i, signature := range transaction.Signatures {
+		if signature == "" {
+			continue
+		}
+
+		if !verify(signature, message, transaction.Multisig.PublicKeys[i]) {
+			return false
+		}
+
+		signed++
+	}
+
+	return signed >= transaction.Multisig.Threshold
+}
+
+// verify checks a hex DER signature over a message's SHA256 hash by a hex public key.
+func verify(signatureHex string, message string, publicKeyHex string) bool {
+	publicKey, err := hex.DecodeString(publicKeyHex)
+	if err != nil {
+		return false
+	}
+
+	pub, err := secp256k1.ParsePubKey(publicKey)
+	if err != nil {
+		return false
+	}
+
+	signatureBytes, err := hex.DecodeString(signatureHex)
+	if err != nil {
+		return false
+	}
+
+	signature, err := ecdsa.ParseDERSignature(signatureBytes)
+	if err != nil {
+		return false
+	}
+
+	hash := sha256.Sum256([]byte(message))
+
+	return signature.Verify(hash[:], pub)
+}
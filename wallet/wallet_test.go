@@ -0,0 +1,155 @@
+package wallet
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/transmissionsdev/cosmosis/core"
+	"strings"
+	"testing"
+)
+
+// The key and signature from core's signature tests (which a validation server accepts).
+var testTransaction = core.Transaction{Sender: "0458adabe2c014de6c3fd2f2c865c2ca7fe823a4131a4d22f98dcc77f1bffc8aeacf8a0b7949321c33214e9c1b2201063404a321110be8223ad1685ee32c9c02d0", Recipient: "046007e213c57ccab18af3f3b385893da75514ab691216152955d70937744dbe040de0ea504ebe29bce2476ae37c794cf5e7d96c8bc2ad153eb434b148f1af6f6c", Amount: 15, Timestamp: 1586117966, Signature: "3046022100d158259aae3c7c9e3e6cd33a3b47134723ddc4cae25484e8a5df28f45ee462fd022100b6c6600f89a3ef050a8aab14c8a96ca5b5b9c8fa358945c9f53dda1b488dd43c"}
+
+func TestGenerateKey(t *testing.T) {
+	key, err := GenerateKey()
+	assert.NoError(t, err)
+
+	// The same format as the keys in GenesisBlock
+	assert.Len(t, key.PublicKey(), len(core.GenesisBlock.Transactions[0].Recipient))
+	assert.True(t, strings.HasPrefix(key.PublicKey(), "04"))
+
+	// The compressed form of the same key
+	assert.Len(t, key.CompressedPublicKey(), 66)
+	compressed, err := core.CanonicalPublicKey(key.CompressedPublicKey())
+	assert.NoError(t, err)
+	assert.Equal(t, key.PublicKey(), compressed)
+
+	other, err := GenerateKey()
+	assert.NoError(t, err)
+	assert.NotEqual(t, key.PublicKey(), other.PublicKey())
+}
+
+func TestImportKey(t *testing.T) {
+	key, err := GenerateKey()
+	assert.NoError(t, err)
+
+	imported, err := ImportKey(key.PrivateKey())
+	assert.NoError(t, err)
+	assert.Equal(t, key.PublicKey(), imported.PublicKey())
+
+	_, err = ImportKey("not hex")
+	assert.Error(t, err)
+
+	_, err = ImportKey("abcd")
+	assert.Error(t, err)
+
+	// Keys have to be between 1 and the order of the curve
+	_, err = ImportKey(strings.Repeat("00", 32))
+	assert.Error(t, err)
+
+	_, err = ImportKey("fffffffffffffffffffffffffffffffebaaedce6af48a03bbfd25e8cd0364141")
+	assert.Error(t, err)
+
+	_, err = ImportKey(strings.Repeat("ff", 32))
+	assert.Error(t, err)
+
+	_, err = ImportKey("fffffffffffffffffffffffffffffffebaaedce6af48a03bbfd25e8cd0364140")
+	assert.NoError(t, err)
+}
+
+func TestVerifySignature(t *testing.T) {
+	// A signature made externally
+	assert.True(t, VerifySignature(testTransaction))
+
+	tampered := testTransaction
+	tampered.Amount = 16
+	assert.False(t, VerifySignature(tampered))
+
+	tampered = testTransaction
+	tampered.Signature = "not hex"
+	assert.False(t, VerifySignature(tampered))
+
+	tampered = testTransaction
+	tampered.Sender = "0"
+	assert.False(t, VerifySignature(tampered))
+}
+
+func TestSignTransaction(t *testing.T) {
+	key, err := GenerateKey()
+	assert.NoError(t, err)
+
+	transaction := core.Transaction{Sender: key.PublicKey(), Recipient: testTransaction.Recipient, Amount: 15, Timestamp: 1586117966}
+
+	signed, err := SignTransaction(transaction, key)
+	assert.NoError(t, err)
+	assert.NotEmpty(t, signed.Signature)
+	assert.True(t, VerifySignature(signed))
+
+	// Only the signature is changed
+	signed.Signature = ""
+	assert.Equal(t, transaction, signed)
+
+	// Transactions from the compressed form of the key can be signed too
+	transaction.Sender = key.CompressedPublicKey()
+
+	signed, err = SignTransaction(transaction, key)
+	assert.NoError(t, err)
+	assert.True(t, VerifySignature(signed))
+
+	// The inputs and outputs of output-based transactions are signed too
+	transaction = core.Transaction{Sender: key.PublicKey(), Timestamp: 1586117966, Inputs: []core.Input{{TransactionHash: "hash", Index: 0}}, Outputs: []core.Output{{Recipient: testTransaction.Recipient, Amount: 15}}}
+
+	signed, err = SignTransaction(transaction, key)
+	assert.NoError(t, err)
+	assert.True(t, VerifySignature(signed))
+
+	signed.Outputs = []core.Output{{Recipient: testTransaction.Recipient, Amount: 16}}
+	assert.False(t, VerifySignature(signed))
+
+	// Keys can only sign their own transactions
+	_, err = SignTransaction(testTransaction, key)
+	assert.Error(t, err)
+}
+
+func TestSignMultisigTransaction(t *testing.T) {
+	keys := make([]*Key, 3)
+	publicKeys := make([]string, 3)
+	for i := range keys {
+		key, err := GenerateKey()
+		assert.NoError(t, err)
+
+		keys[i] = key
+		publicKeys[i] = key.PublicKey()
+	}
+
+	account, err := core.NewMultisigAccount(2, publicKeys)
+	assert.NoError(t, err)
+	address, err := account.Address()
+	assert.NoError(t, err)
+
+	transaction := core.Transaction{Sender: address, Recipient: testTransaction.Recipient, Amount: 15, Timestamp: 1586117966, Multisig: account}
+
+	// One signature isn't enough
+	once, err := SignMultisigTransaction(transaction, keys[0])
+	assert.NoError(t, err)
+	assert.False(t, VerifySignature(once))
+	assert.Empty(t, transaction.Signatures)
+
+	twice, err := SignMultisigTransaction(once, keys[2])
+	assert.NoError(t, err)
+	assert.True(t, VerifySignature(twice))
+	assert.Len(t, twice.Signatures, 3)
+	assert.Len(t, once.Signatures, 3)
+	assert.NotEqual(t, once.Signatures, twice.Signatures)
+
+	// Keys outside the account can't sign
+	outsider, err := GenerateKey()
+	assert.NoError(t, err)
+	_, err = SignMultisigTransaction(transaction, outsider)
+	assert.Error(t, err)
+
+	// Neither can transactions from other accounts
+	transaction.Sender = keys[0].Address()
+	_, err = SignMultisigTransaction(transaction, keys[0])
+	assert.Error(t, err)
+}